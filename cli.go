@@ -1,115 +1,163 @@
 package main
+
 import (
-    "flag"
-    "fmt"
-    "time"
-    "os"
-    "net"
-    "strings"
-    "strconv"
-    "regexp"
-    "crypto/sha256"
-    "encoding/json"
-    "encoding/base64"
-)
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
 
+	"totalrecall/pkg/encoding"
+	"totalrecall/pkg/envfilter"
+	"totalrecall/pkg/eventsink"
+	"totalrecall/pkg/jetstream"
+	"totalrecall/pkg/schema"
+	"totalrecall/pkg/spool"
+)
 
 func parseTimestamp(t string) time.Time {
-    startRune := []rune(t)
-    startRune[10] = 'T'
+	startRune := []rune(t)
+	startRune[10] = 'T'
 	ts, err := time.Parse(time.RFC3339Nano, string(startRune))
 	if err != nil {
 		fmt.Println("error:", err)
 		panic(err)
 	}
-    return ts
-}
-
-func getMaskedEnvVar(key string, value string) string {
-    patterns := []string{"secret", "password", "key"}
-	for _, pattern := range patterns {
-		matched, err := regexp.MatchString("(?i)" + pattern, key)
-		if err != nil {
-			fmt.Println("error:", err)
-			panic(err)
-		}
-		if matched {
-            return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(value)))
-		}
-	}
-	return value
+	return ts
 }
 
-func shouldSkipEnvVar(key string, value string) bool {
-    patterns := []string{"^_+", "^PS1$", "^TERM$", "TOTALRECALLROOT"}
-	for _, pattern := range patterns {
-		matched, err := regexp.MatchString("(?i)" + pattern, key)
-		if err != nil {
-			fmt.Println("error:", err)
-			panic(err)
-		}
-		if matched {
-            return matched
-		}
-	}
-	return false
+func main() {
+	// `totalrecall consume` binds a durable pull consumer and forwards
+	// published command events to the ES/Kibana path instead of recording
+	// a new one. Every other invocation keeps the original postexec
+	// recording behavior for backwards compatibility with existing hooks.
+	if len(os.Args) > 1 && os.Args[1] == "consume" {
+		runConsume(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "flush" {
+		runFlush(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "netcapture-daemon" {
+		runNetcaptureDaemon(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		runDecrypt(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "env" {
+		runEnv(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "train" {
+		runTrain(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		runExport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+	runRecord()
 }
 
+func runRecord() {
+	commandPtr := flag.String("command", "", "Command.")
+	returnCodePtr := flag.String("return-code", "", "Return code.")
+	startTimestampPtr := flag.String("start-timestamp", "", "Start timestamp.")
+	endTimestampPtr := flag.String("end-timestamp", "", "End timestamp.")
+	natsURLPtr := flag.String("nats-url", nats.DefaultURL, "NATS server URL.")
+	ackTimeoutPtr := flag.Duration("ack-timeout", 5*time.Second, "Max time to wait for the publish ack before exiting.")
+	encodingPtr := flag.String("encoding", string(encoding.JSON), "Wire encoding for the published event: json or protobuf.")
+	envConfigPtr := flag.String("env-config", "", "Path to environment filtering configuration file.")
+	flag.Parse()
 
-
-func main() {
-    commandPtr := flag.String("command", "", "Command.")
-    returnCodePtr := flag.String("return-code", "", "Return code.")
-    startTimestampPtr := flag.String("start-timestamp", "", "Start timestamp.")
-    endTimestampPtr := flag.String("end-timestamp", "", "End timestamp.")
-    flag.Parse()
-
-    event := make(map[string]interface{})
 	data, err := base64.StdEncoding.DecodeString(*commandPtr)
 	if err != nil {
 		fmt.Println("error:", err)
 		return
 	}
-    event["command"] = strings.TrimSpace(string(data))
+	command := strings.TrimSpace(string(data))
 
-    returnCode, err := strconv.Atoi(*returnCodePtr)
+	returnCode, err := strconv.Atoi(*returnCodePtr)
 	if err != nil {
 		fmt.Println("error:", err)
 		return
 	}
-    event["return_code"] = returnCode
-    event["start_timestamp"] = parseTimestamp(*startTimestampPtr)
-    event["end_timestamp"] = parseTimestamp(*endTimestampPtr)
 
-    env := map[string]string{}
-    for _, e := range os.Environ() {
-        pair := strings.SplitN(e, "=", 2)
-        key := string(pair[0])
-        value := string(pair[1])
-        if shouldSkipEnvVar(key, value) { 
-            continue
-        }
-        env[key] = getMaskedEnvVar(key, value)
-       }
-    event["env"] = env
+	envConfig, err := envfilter.LoadConfig(*envConfigPtr)
+	if err != nil {
+		fmt.Println("error loading environment config:", err)
+		return
+	}
+
+	rawEnv := map[string]string{}
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		rawEnv[pair[0]] = pair[1]
+	}
+	env := envConfig.FilterEnvironment(rawEnv)
+
+	ev := schema.NewCommandEvent(command, "", parseTimestamp(*startTimestampPtr), parseTimestamp(*endTimestampPtr), returnCode, env)
+	ev.Host = hostnameOrUnknown()
 
-    j, err := json.Marshal(event)
+	enc, err := encoding.New(encoding.Name(*encodingPtr))
 	if err != nil {
 		fmt.Println("error:", err)
 		return
 	}
 
-    timeout, err := time.ParseDuration("50ms") 
+	j, err := enc.Marshal(ev)
 	if err != nil {
 		fmt.Println("error:", err)
 		return
 	}
-    conn, _ := net.DialTimeout("tcp", "127.0.0.1:5170", timeout)
+
+	subject := fmt.Sprintf("%s.%s", jetstream.SubjectPrefix, hostnameOrUnknown())
+
+	cfg := jetstream.DefaultConfig()
+	cfg.URL = *natsURLPtr
+	nc, js, err := jetstream.Connect(cfg)
 	if err != nil {
-		fmt.Println("error:", err)
+		spoolEvent(j)
 		return
 	}
-	fmt.Fprintf(conn, string(j) + "\n")
-    conn.Close()
+	defer nc.Close()
 
+	var sink eventsink.EventSink = jetstream.Sink{JS: js, Subject: subject, AckTimeout: *ackTimeoutPtr}
+	if err := sink.Publish(context.Background(), j); err != nil {
+		spoolEvent(j)
+		return
+	}
+}
+
+// spoolEvent persists an event that could not be published so the `flush`
+// daemon can retry it later, instead of dropping it on the floor.
+func spoolEvent(data []byte) {
+	s, err := spool.Open(spool.Root(), 64*1024*1024)
+	if err != nil {
+		fmt.Println("error opening spool:", err)
+		return
+	}
+	if _, err := s.Write(data); err != nil {
+		fmt.Println("error spooling event:", err)
+	}
+}
+
+func hostnameOrUnknown() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/jetstream"
+)
+
+// runConsume binds a durable JetStream pull consumer on the TOTALRECALL
+// stream and forwards each command event to Elasticsearch through the
+// existing proxied client, acking only once the forward succeeds so a
+// crashed consumer replays from where it left off.
+func runConsume(args []string) {
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+	natsURLPtr := fs.String("nats-url", nats.DefaultURL, "NATS server URL.")
+	durablePtr := fs.String("durable", "totalrecall-consume", "Durable consumer name.")
+	subjectPtr := fs.String("subject", jetstream.Subjects, "Subject filter to bind the pull consumer to.")
+	socketPathPtr := fs.String("socket-path", "/tmp/totalrecall-proxy.sock", "Unix domain socket path for the ES proxy.")
+	batchPtr := fs.Int("batch", 10, "Number of messages to fetch per pull.")
+	fs.Parse(args)
+
+	cfg := jetstream.DefaultConfig()
+	cfg.URL = *natsURLPtr
+	nc, js, err := jetstream.Connect(cfg)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	sub, err := jetstream.DurableConsumer(js, *durablePtr, *subjectPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer sub.Unsubscribe()
+
+	client, err := estransport.NewProxiedESClient(*socketPathPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("consuming %s as durable %q, forwarding to %s\n", *subjectPtr, *durablePtr, *socketPathPtr)
+
+	for {
+		msgs, err := sub.Fetch(*batchPtr, nats.MaxWait(5*time.Second))
+		if err != nil {
+			if err == nats.ErrTimeout {
+				continue
+			}
+			fmt.Println("error fetching messages:", err)
+			continue
+		}
+
+		for _, msg := range msgs {
+			if err := forwardToES(client, msg.Data); err != nil {
+				fmt.Println("error forwarding event, leaving unacked for redelivery:", err)
+				msg.Nak()
+				continue
+			}
+			msg.Ack()
+		}
+	}
+}
+
+func forwardToES(client *estransport.ProxiedESClient, data []byte) error {
+	var cmd estransport.Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("decoding command event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return client.IndexCommand(ctx, cmd)
+}
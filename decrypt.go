@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"totalrecall/pkg/envfilter"
+)
+
+// runDecrypt reverses a value an EnvConfig with EncryptSensitiveValues set
+// redacted, using the age identity under --key-dir. It's the recovery path
+// that makes AgeRedactor's output forensically useful instead of a dead end.
+func runDecrypt(args []string) {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	valuePtr := fs.String("value", "", "The age1_-prefixed value to decrypt. Reads from stdin if not set.")
+	keyDirPtr := fs.String("key-dir", "", "Directory holding the age identity (defaults to ~/.config/totalrecall/keys).")
+	fs.Parse(args)
+
+	value := *valuePtr
+	if value == "" {
+		scanner := bufio.NewScanner(os.Stdin)
+		if !scanner.Scan() {
+			fmt.Println("error: no --value given and nothing to read on stdin")
+			os.Exit(1)
+		}
+		value = strings.TrimSpace(scanner.Text())
+	}
+
+	identity, err := envfilter.LoadOrCreateIdentity(*keyDirPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	plaintext, err := envfilter.DecryptValue(value, identity)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Println(plaintext)
+}
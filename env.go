@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"totalrecall/pkg/envfilter"
+)
+
+// runEnv is the `totalrecall env` subcommand. Today its only mode is
+// --dry-run, which runs the configured Transforms/allowlist/redaction
+// pipeline against the current process environment and prints the decision
+// trail per variable instead of emitting a command event, so a user can
+// check a Transforms change before trusting it in production.
+func runEnv(args []string) {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	configPtr := fs.String("config", "", "Path to env-config.json (defaults to the usual search locations).")
+	dryRunPtr := fs.Bool("dry-run", false, "Print the before/after value and matched rule for each env var instead of filtering silently.")
+	fs.Parse(args)
+
+	if !*dryRunPtr {
+		fmt.Println("error: `totalrecall env` currently only supports --dry-run")
+		os.Exit(1)
+	}
+
+	config, err := envfilter.LoadConfig(*configPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	env := map[string]string{}
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		env[pair[0]] = pair[1]
+	}
+
+	explanations := config.Explain(env)
+	sort.Slice(explanations, func(i, j int) bool { return explanations[i].Key < explanations[j].Key })
+
+	for _, exp := range explanations {
+		if !exp.Included {
+			fmt.Printf("%s: dropped\n", exp.Key)
+			continue
+		}
+
+		rule := "none"
+		switch {
+		case exp.RedactionReason != "":
+			rule = exp.RedactionReason
+		case exp.TransformOp != "":
+			rule = "transform:" + exp.TransformOp
+		}
+
+		if exp.RawValue == exp.FinalValue {
+			fmt.Printf("%s: %s (rule: %s)\n", exp.Key, exp.RawValue, rule)
+			continue
+		}
+		fmt.Printf("%s: %s -> %s (rule: %s)\n", exp.Key, exp.RawValue, exp.FinalValue, rule)
+	}
+}
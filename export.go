@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/spool"
+)
+
+// defaultCheckpointPath is where runExport records the end_timestamp of the
+// last command it wrote, so a killed or restarted export resumes instead of
+// re-streaming the whole index.
+func defaultCheckpointPath() string {
+	return spool.Root() + "/export-checkpoint.json"
+}
+
+// exportCheckpoint is the on-disk shape defaultCheckpointPath's file holds.
+type exportCheckpoint struct {
+	LastEndTimestamp string `json:"last_end_timestamp"`
+}
+
+func readCheckpoint(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	var cp exportCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return "", err
+	}
+	return cp.LastEndTimestamp, nil
+}
+
+func writeCheckpoint(path, lastEndTimestamp string) error {
+	data, err := json.Marshal(exportCheckpoint{LastEndTimestamp: lastEndTimestamp})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// endpointListFlag collects repeated -es flag values in order, letting
+// callers try a Unix-socket proxy first and fall back to a direct
+// connection, the same flag shape tools/dirjump uses.
+type endpointListFlag []string
+
+func (f *endpointListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *endpointListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// defaultESEndpoints is the fallback chain used when no -es flags are given.
+var defaultESEndpoints = []string{
+	"unix:///tmp/totalrecall-proxy.sock",
+	"https://localhost:9243",
+}
+
+// connectES resolves esFlags (or defaultESEndpoints/$ES_URL if empty) into
+// endpoints and dials the first one that responds.
+func connectES(esFlags endpointListFlag) (*estransport.ProxiedESClient, error) {
+	if len(esFlags) == 0 {
+		esFlags = defaultESEndpoints
+		if esURL := os.Getenv("ES_URL"); esURL != "" {
+			esFlags = endpointListFlag{esURL}
+		}
+	}
+
+	endpoints := make([]estransport.Endpoint, 0, len(esFlags))
+	for _, raw := range esFlags {
+		ep, err := estransport.ParseEndpoint(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -es endpoint: %v", err)
+		}
+		endpoints = append(endpoints, ep)
+	}
+
+	return estransport.NewESClientWithFallback(endpoints)
+}
+
+// runExport is the `totalrecall export` subcommand: it streams every
+// totalrecall* command as newline-delimited JSON (one estransport.Command
+// per line), oldest first, via the ES Scroll API, checkpointing the last
+// end_timestamp written after every page so a restart can pick up where a
+// previous run left off instead of re-exporting from scratch.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var esFlags endpointListFlag
+	fs.Var(&esFlags, "es", "ES endpoint to try, in order. May be repeated; defaults to the proxy socket then the direct HAProxy endpoint.")
+	outPathPtr := fs.String("out", "", "File to write NDJSON to; defaults to stdout.")
+	sincePtr := fs.String("since", "", "Only export commands ending at or after this RFC3339 timestamp; overrides the checkpoint file when set.")
+	checkpointPtr := fs.String("checkpoint", defaultCheckpointPath(), "State file recording the last end_timestamp exported.")
+	pageSizePtr := fs.Int("page-size", 1000, "Documents fetched per scroll page.")
+	fs.Parse(args)
+
+	client, err := connectES(esFlags)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	since := *sincePtr
+	if since == "" {
+		if cp, err := readCheckpoint(*checkpointPtr); err != nil {
+			fmt.Println("error reading checkpoint:", err)
+		} else {
+			since = cp
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPathPtr != "" {
+		f, err := os.Create(*outPathPtr)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	query := map[string]interface{}{
+		"sort": []map[string]interface{}{{"end_timestamp": "asc"}},
+	}
+	if since != "" {
+		query["query"] = map[string]interface{}{
+			"range": map[string]interface{}{
+				"end_timestamp": map[string]interface{}{"gte": since},
+			},
+		}
+	}
+
+	ctx := context.Background()
+	cursor, err := client.Scroll(ctx, query, *pageSizePtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	defer cursor.Close(ctx)
+
+	w := bufio.NewWriter(out)
+
+	var total int
+	for {
+		hits, err := cursor.Next(ctx)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		if len(hits) == 0 {
+			break
+		}
+
+		var lastEnd string
+		for _, hit := range hits {
+			data, err := json.Marshal(hit.Source)
+			if err != nil {
+				fmt.Println("error encoding command:", err)
+				continue
+			}
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				fmt.Println("error:", err)
+				os.Exit(1)
+			}
+			total++
+			lastEnd = hit.Source.EndTimestamp.Format(time.RFC3339Nano)
+		}
+
+		if err := w.Flush(); err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		if lastEnd != "" {
+			if err := writeCheckpoint(*checkpointPtr, lastEnd); err != nil {
+				fmt.Println("error writing checkpoint:", err)
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %d commands\n", total)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"totalrecall/pkg/jetstream"
+	"totalrecall/pkg/spool"
+)
+
+// runFlush walks the on-disk spool at a configurable interval, retrying
+// delivery of each pending event. It follows the same retries/retry-delay/
+// retry-timeout shape as the Kibana bootstrap's wait-for-green loop: give up
+// on an individual event after `retries` attempts spaced `retry-delay`
+// apart, and exit non-zero if the spool isn't fully drained within
+// `retry-timeout` overall (with --once, if that one sweep leaves it undrained).
+func runFlush(args []string) {
+	fs := flag.NewFlagSet("flush", flag.ExitOnError)
+	natsURLPtr := fs.String("nats-url", nats.DefaultURL, "NATS server URL.")
+	intervalPtr := fs.Duration("interval", 10*time.Second, "Interval between spool sweeps.")
+	maxBytesPtr := fs.Int64("max-bytes", 64*1024*1024, "Spool size cap in bytes; oldest files are evicted first.")
+	retriesPtr := fs.Int("retries", 3, "Delivery attempts per event before leaving it for the next sweep.")
+	retryDelayPtr := fs.Duration("retry-delay", 2*time.Second, "Delay between delivery attempts.")
+	retryTimeoutPtr := fs.Duration("retry-timeout", 0, "If >0, exit non-zero if the spool isn't fully drained within this overall duration.")
+	oncePtr := fs.Bool("once", false, "Run a single sweep and exit instead of running as a daemon.")
+	fs.Parse(args)
+
+	s, err := spool.Open(spool.Root(), *maxBytesPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	startTime := time.Now()
+	var deadline time.Time
+	if *retryTimeoutPtr > 0 {
+		deadline = startTime.Add(*retryTimeoutPtr)
+	}
+
+	for {
+		drained, err := sweep(s, *natsURLPtr, *retriesPtr, *retryDelayPtr)
+		if err != nil {
+			fmt.Println("error during sweep:", err)
+		}
+
+		if *oncePtr {
+			if !drained && !deadline.IsZero() {
+				os.Exit(1)
+			}
+			return
+		}
+
+		if drained {
+			// Nothing left, but keep running as a daemon watching for new spool files.
+		} else if !deadline.IsZero() && time.Now().After(deadline) {
+			fmt.Printf("timed out after %s with events still spooled\n", *retryTimeoutPtr)
+			os.Exit(1)
+		}
+
+		time.Sleep(*intervalPtr)
+	}
+}
+
+// sweep attempts delivery of every pending spool file, returning true if the
+// spool ended up empty.
+func sweep(s *spool.Spool, natsURL string, retries int, retryDelay time.Duration) (bool, error) {
+	pending, err := s.Pending()
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		return true, nil
+	}
+
+	cfg := jetstream.DefaultConfig()
+	cfg.URL = natsURL
+	nc, js, err := jetstream.Connect(cfg)
+	if err != nil {
+		return false, fmt.Errorf("connecting to nats: %v", err)
+	}
+	defer nc.Close()
+
+	allDelivered := true
+	for _, path := range pending {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("error reading spooled event %s: %v\n", path, err)
+			allDelivered = false
+			continue
+		}
+
+		subject := fmt.Sprintf("%s.%s", jetstream.SubjectPrefix, hostnameOrUnknown())
+		if !deliver(js, subject, data, retries, retryDelay) {
+			allDelivered = false
+			continue
+		}
+
+		if err := s.Delete(path); err != nil {
+			fmt.Printf("error removing delivered spool file %s: %v\n", path, err)
+		}
+	}
+
+	return allDelivered, nil
+}
+
+func deliver(js nats.JetStreamContext, subject string, data []byte, retries int, retryDelay time.Duration) bool {
+	for attempt := 0; attempt < retries; attempt++ {
+		if _, err := js.PublishAsync(subject, data); err == nil {
+			if err := jetstream.DrainAcks(js, 5*time.Second); err == nil {
+				return true
+			}
+		}
+		if attempt < retries-1 {
+			time.Sleep(retryDelay)
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"totalrecall/pkg/estransport"
+)
+
+// runImport is the `totalrecall import` subcommand: it reads NDJSON
+// (one estransport.Command per line, the shape runExport writes) from a file
+// or stdin, validates each line against that struct, and pushes valid
+// commands through a BulkIndexer. --dry-run validates and counts without
+// indexing anything; --since drops commands that ended before a cutoff;
+// --rename-index indexes into a different index than "totalrecall", e.g.
+// when replaying an export into a freshly Reindexed mapping.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var esFlags endpointListFlag
+	fs.Var(&esFlags, "es", "ES endpoint to try, in order. May be repeated; defaults to the proxy socket then the direct HAProxy endpoint.")
+	inPathPtr := fs.String("in", "", "NDJSON file to read; defaults to stdin.")
+	dryRunPtr := fs.Bool("dry-run", false, "Validate and count commands without indexing them.")
+	sincePtr := fs.String("since", "", "Skip commands that ended before this RFC3339 timestamp.")
+	renameIndexPtr := fs.String("rename-index", "", "Index to write into instead of \"totalrecall\".")
+	fs.Parse(args)
+
+	var since time.Time
+	if *sincePtr != "" {
+		t, err := time.Parse(time.RFC3339, *sincePtr)
+		if err != nil {
+			fmt.Println("error parsing -since:", err)
+			os.Exit(1)
+		}
+		since = t
+	}
+
+	var in io.Reader = os.Stdin
+	if *inPathPtr != "" {
+		f, err := os.Open(*inPathPtr)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var indexer *estransport.BulkIndexer
+	if !*dryRunPtr {
+		client, err := connectES(esFlags)
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		defer client.Close()
+
+		indexer, err = client.NewBulkIndexer(estransport.BulkIndexerConfig{
+			OnError: func(item estransport.BulkItem, err error) {
+				fmt.Println("error indexing command:", err)
+			},
+		})
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx := context.Background()
+
+	var total, skipped, invalid int
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var cmd estransport.Command
+		if err := json.Unmarshal(line, &cmd); err != nil {
+			fmt.Println("error: invalid command line:", err)
+			invalid++
+			continue
+		}
+
+		if !since.IsZero() && cmd.EndTimestamp.Before(since) {
+			skipped++
+			continue
+		}
+
+		total++
+		if *dryRunPtr {
+			continue
+		}
+
+		body, err := json.Marshal(cmd)
+		if err != nil {
+			fmt.Println("error re-encoding command:", err)
+			invalid++
+			continue
+		}
+		if err := indexer.Add(ctx, estransport.BulkItem{Index: *renameIndexPtr, Body: body}); err != nil {
+			fmt.Println("error queuing command:", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Println("error reading input:", err)
+		os.Exit(1)
+	}
+
+	if indexer != nil {
+		closeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if err := indexer.Close(closeCtx); err != nil {
+			fmt.Println("error flushing indexer:", err)
+		}
+	}
+
+	if *dryRunPtr {
+		fmt.Fprintf(os.Stderr, "dry run: %d valid, %d skipped, %d invalid\n", total, skipped, invalid)
+	} else {
+		fmt.Fprintf(os.Stderr, "imported %d commands, %d skipped, %d invalid\n", total, skipped, invalid)
+	}
+}
@@ -23,6 +23,32 @@ type StatusResponse struct {
 	} `json:"status"`
 }
 
+//go:generate mockgen -source=wait-for-kibana.go -destination=mock_kibana.go -package=main
+
+// KibanaAPI abstracts the two outbound calls this tool makes, so the
+// retry/timeout logic around them can be tested against a fake instead of a
+// real Kibana instance.
+type KibanaAPI interface {
+	WaitHealthy(maxWaitTime, checkInterval, retries, retryDelay int, verbose bool) error
+	ImportSavedObjects(jsonFile string, retries, retryDelay int, verbose bool) error
+}
+
+// httpKibanaClient is the KibanaAPI backed by a real *http.Client talking to
+// a Kibana instance's HTTP API.
+type httpKibanaClient struct {
+	client           *http.Client
+	baseURL          string
+	savedObjEndpoint string
+}
+
+func (k *httpKibanaClient) WaitHealthy(maxWaitTime, checkInterval, retries, retryDelay int, verbose bool) error {
+	return waitForGreenStatus(k.client, fmt.Sprintf("%s/api/status", k.baseURL), maxWaitTime, checkInterval, retries, retryDelay, verbose)
+}
+
+func (k *httpKibanaClient) ImportSavedObjects(jsonFile string, retries, retryDelay int, verbose bool) error {
+	return postSavedObjects(k.client, fmt.Sprintf("%s%s", k.baseURL, k.savedObjEndpoint), jsonFile, retries, retryDelay, verbose)
+}
+
 func main() {
 	// Common flags
 	url := flag.String("url", "http://kibana:5601", "Kibana base URL")
@@ -79,54 +105,60 @@ func main() {
 		Transport: transport,
 	}
 
-        statusUrl := fmt.Sprintf("%s/api/status", *url)
-        waitForGreenStatus(client, statusUrl, *maxWaitTime, *checkInterval, *retries, *retryDelay, *verbose)
+        api := KibanaAPI(&httpKibanaClient{client: client, baseURL: *url, savedObjEndpoint: *savedObjEndpoint})
+
+        if err := api.WaitHealthy(*maxWaitTime, *checkInterval, *retries, *retryDelay, *verbose); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+        }
         if *jsonFile == "" {
                 fmt.Println("Error: --json flag required for savedobj operation")
                 os.Exit(1)
         }
-        savedObjUrl := fmt.Sprintf("%s%s", *url, *savedObjEndpoint)
-        postSavedObjects(client, savedObjUrl, *jsonFile, *retries, *retryDelay, *verbose)
+        if err := api.ImportSavedObjects(*jsonFile, *retries, *retryDelay, *verbose); err != nil {
+                fmt.Println(err)
+                os.Exit(1)
+        }
+        fmt.Println("Successfully posted saved objects to Kibana")
 }
 
 // Wait for Kibana status to turn green with a maximum wait time
-func waitForGreenStatus(client *http.Client, url string, maxWaitTime int, checkInterval int, retries int, retryDelay int, verbose bool) {
+func waitForGreenStatus(client *http.Client, url string, maxWaitTime int, checkInterval int, retries int, retryDelay int, verbose bool) error {
 	if verbose {
 		fmt.Printf("Waiting for Kibana status to turn green (max %d seconds)\n", maxWaitTime)
 	}
-	
+
 	startTime := time.Now()
 	endTime := startTime.Add(time.Duration(maxWaitTime) * time.Second)
-	
+
 	for time.Now().Before(endTime) {
 		status, err := getKibanaStatus(client, url, verbose)
-		
+
 		if err == nil {
 			if status == "green" {
 				fmt.Println("Kibana status is green")
-				return
+				return nil
 			} else if verbose {
 				fmt.Printf("Current status: %s (waiting for green)\n", status)
 			}
 		} else if verbose {
 			fmt.Printf("Error checking status: %v\n", err)
 		}
-		
+
 		timeLeft := endTime.Sub(time.Now()).Seconds()
 		if timeLeft <= 0 {
 			break
 		}
-		
+
 		if verbose {
-			fmt.Printf("Waiting %d seconds before next check (%.0f seconds remaining)\n", 
+			fmt.Printf("Waiting %d seconds before next check (%.0f seconds remaining)\n",
 				checkInterval, timeLeft)
 		}
-		
+
 		time.Sleep(time.Duration(checkInterval) * time.Second)
 	}
-	
-	fmt.Printf("Timed out after %d seconds waiting for Kibana to turn green\n", maxWaitTime)
-	os.Exit(1)
+
+	return fmt.Errorf("timed out after %d seconds waiting for Kibana to turn green", maxWaitTime)
 }
 
 func getKibanaStatus(client *http.Client, url string, verbose bool) (string, error) {
@@ -170,39 +202,36 @@ func getKibanaStatus(client *http.Client, url string, verbose bool) (string, err
 	return statusResp.Status.Overall.State, nil
 }
 
-func postSavedObjects(client *http.Client, url string, jsonFile string, retries int, retryDelay int, verbose bool) {
+func postSavedObjects(client *http.Client, url string, jsonFile string, retries int, retryDelay int, verbose bool) error {
 	// Read the JSON file
 	jsonData, err := os.ReadFile(jsonFile)
 	if err != nil {
-		fmt.Printf("Error reading JSON file: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error reading JSON file: %v", err)
 	}
-	
+
 	// Try to post saved objects with retries
 	var lastErr error
 	for attempt := 0; attempt < retries; attempt++ {
 		if verbose && attempt > 0 {
 			fmt.Printf("Retry attempt %d/%d\n", attempt+1, retries)
 		}
-		
+
 		err := postMultipartToKibana(client, url, jsonData, verbose)
 		if err == nil {
-			fmt.Println("Successfully posted saved objects to Kibana")
-			os.Exit(0)
+			return nil
 		}
-		
+
 		lastErr = err
 		if verbose {
 			fmt.Printf("Error: %v\n", err)
 		}
-		
+
 		if attempt < retries-1 {
 			time.Sleep(time.Duration(retryDelay) * time.Second)
 		}
 	}
-	
-	fmt.Printf("Failed after %d attempts: %v\n", retries, lastErr)
-	os.Exit(1)
+
+	return fmt.Errorf("failed after %d attempts: %v", retries, lastErr)
 }
 
 func postMultipartToKibana(client *http.Client, url string, fileData []byte, verbose bool) error {
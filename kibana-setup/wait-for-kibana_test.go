@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWaitForGreenStatusTimesOut covers the never-green scenario: Kibana
+// keeps reporting a non-green overall status, so waitForGreenStatus must
+// give up once maxWaitTime elapses instead of polling forever.
+func TestWaitForGreenStatusTimesOut(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":{"overall":{"state":"red"}}}`)
+	}))
+	defer srv.Close()
+
+	err := waitForGreenStatus(srv.Client(), srv.URL, 1, 1, 0, 0, false)
+	if err == nil {
+		t.Fatal("expected a timeout error, got none")
+	}
+	want := "timed out after 1 seconds waiting for Kibana to turn green"
+	if err.Error() != want {
+		t.Errorf("got error %q, want %q", err.Error(), want)
+	}
+}
+
+// TestWaitForGreenStatusSucceeds confirms the happy path still works once
+// the status turns green.
+func TestWaitForGreenStatusSucceeds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":{"overall":{"state":"green"}}}`)
+	}))
+	defer srv.Close()
+
+	if err := waitForGreenStatus(srv.Client(), srv.URL, 5, 1, 0, 0, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// TestPostSavedObjectsRetryExhaustion covers the multipart import 4xx
+// retry-exhaustion scenario: Kibana keeps rejecting the import with a 400,
+// so postSavedObjects must retry exactly `retries` times and then return
+// an error wrapping the last response, instead of retrying forever or
+// masking the failure.
+func TestPostSavedObjectsRetryExhaustion(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"bad request"}`)
+	}))
+	defer srv.Close()
+
+	jsonFile := filepath.Join(t.TempDir(), "import.ndjson")
+	if err := os.WriteFile(jsonFile, []byte(`{"type":"dashboard"}`), 0o644); err != nil {
+		t.Fatalf("writing fixture file: %v", err)
+	}
+
+	err := postSavedObjects(srv.Client(), srv.URL, jsonFile, 3, 0, false)
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries, got none")
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want exactly 3", attempts)
+	}
+	wantSubstr := "failed after 3 attempts"
+	if !strings.Contains(err.Error(), wantSubstr) {
+		t.Errorf("got error %q, want it to contain %q", err.Error(), wantSubstr)
+	}
+	if !strings.Contains(err.Error(), "400") {
+		t.Errorf("got error %q, want it to mention the 400 status", err.Error())
+	}
+}
+
+// TestPostSavedObjectsSucceedsAfterTransientFailure confirms a later
+// success within the retry budget still counts as success, not exhaustion.
+func TestPostSavedObjectsSucceedsAfterTransientFailure(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	jsonFile := filepath.Join(t.TempDir(), "import.ndjson")
+	if err := os.WriteFile(jsonFile, []byte(`{"type":"dashboard"}`), 0o644); err != nil {
+		t.Fatalf("writing fixture file: %v", err)
+	}
+
+	if err := postSavedObjects(srv.Client(), srv.URL, jsonFile, 3, 0, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want exactly 2", attempts)
+	}
+}
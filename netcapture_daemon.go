@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"totalrecall/pkg/netcapture"
+)
+
+// runNetcaptureDaemon runs the long-lived side of --capture-network: it
+// opens the pcap handle for a shell session and serves aggregation queries
+// over a Unix socket until it receives SIGINT or SIGTERM; it does not watch
+// the shell, so it keeps running after the shell exits. preexec-hook launches
+// this detached the first time a shell requests network capture; postexec
+// queries it via netcapture.Query.
+func runNetcaptureDaemon(args []string) {
+	fs := flag.NewFlagSet("netcapture-daemon", flag.ExitOnError)
+	iface := fs.String("iface", "any", "Interface to capture on.")
+	socketPath := fs.String("socket", "", "Unix socket path to serve aggregation queries on.")
+	pidFile := fs.String("pidfile", "", "Pidfile to write once the capture socket is listening.")
+	ringSize := fs.Int("ring-size", 100000, "Max packets retained in the in-memory ring buffer.")
+	fs.Parse(args)
+
+	if *socketPath == "" {
+		fmt.Fprintln(os.Stderr, "netcapture-daemon: --socket is required")
+		os.Exit(1)
+	}
+
+	capturer, err := netcapture.Open(*iface, *ringSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "netcapture-daemon: %v\n", err)
+		os.Exit(1)
+	}
+	defer capturer.Close()
+
+	if err := capturer.Serve(*socketPath); err != nil {
+		fmt.Fprintf(os.Stderr, "netcapture-daemon: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *pidFile != "" {
+		if err := netcapture.WritePidFile(*pidFile, *iface, "", *socketPath); err != nil {
+			fmt.Fprintf(os.Stderr, "netcapture-daemon: %v\n", err)
+		}
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	<-sigChan
+}
@@ -0,0 +1,140 @@
+// Package auth implements pluggable authentication and per-credential
+// authorization for the unix-socket control plane tls-proxy exposes:
+// SUBSCRIBE, fluent-bit ingest, and the Elasticsearch proxy path. A bare
+// unix socket only gates access by filesystem permissions, which stops
+// working once different credentials need different capabilities (a
+// dashboard that may only subscribe vs. a collector that may only
+// publish), so every NewAuth scheme decides both "who is this" and "what
+// can they do" from one set of Credentials.
+package auth
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Capability is one action a Principal may be authorized to perform
+// against the control plane.
+type Capability string
+
+const (
+	// CapSubscribe allows SUBSCRIBE and history replay.
+	CapSubscribe Capability = "subscribe"
+	// CapPublish allows sending fluent-bit/command events for fanout.
+	CapPublish Capability = "publish"
+	// CapQuery allows issuing requests through the Elasticsearch proxy path.
+	CapQuery Capability = "query"
+	// CapAdmin allows administrative verbs against the control plane, such
+	// as the FAULT fault-injection command.
+	CapAdmin Capability = "admin"
+)
+
+// Principal is the authenticated identity behind a connection, plus what
+// it's authorized to do.
+type Principal struct {
+	Name string
+	// FilterPrefix, if non-empty, restricts CapSubscribe to subfilter
+	// expressions starting with this prefix, so a credential can be scoped
+	// to (say) only host=web1's events instead of the whole stream.
+	FilterPrefix string
+
+	caps map[Capability]bool
+}
+
+// NewPrincipal builds a Principal from a name and its granted capabilities.
+// Every Auth implementation below uses it to build its Authenticate result.
+func NewPrincipal(name, filterPrefix string, caps ...Capability) *Principal {
+	set := make(map[Capability]bool, len(caps))
+	for _, c := range caps {
+		set[c] = true
+	}
+	return &Principal{Name: name, FilterPrefix: filterPrefix, caps: set}
+}
+
+// Can reports whether the principal holds capability c. A nil Principal
+// can do nothing, so callers can skip a separate nil check.
+func (p *Principal) Can(c Capability) bool {
+	return p != nil && p.caps[c]
+}
+
+// Credentials is what a connection presents to Authenticate: a
+// username/password pair for the credentialed schemes, and the underlying
+// net.Conn for schemes (cert://) that authenticate the connection itself
+// rather than a secret it sends.
+type Credentials struct {
+	User string
+	Pass string
+	Conn net.Conn
+}
+
+//go:generate mockgen -source=auth.go -destination=mock_auth.go -package=auth
+
+// Auth authenticates Credentials and returns the resulting Principal, or
+// an error if they're rejected.
+type Auth interface {
+	Authenticate(creds Credentials) (*Principal, error)
+}
+
+// NewAuth parses a URL-style auth spec into an Auth implementation:
+//
+//	none://                                          no authentication; every connection gets every capability
+//	static://?users=name:pass:caps[;name:pass:caps]  credentials and capabilities held in memory
+//	basicfile:///path/to/htpasswd?caps=...           htpasswd-style file, hot-reloaded on change
+//	cert://?uids=0,1000                              trust the connecting process's local uid (SO_PEERCRED)
+//
+// caps is a comma-separated list of "subscribe", "subscribe=<prefix>",
+// "publish", "query", and "admin".
+func NewAuth(spec string) (Auth, error) {
+	scheme, rest, ok := strings.Cut(spec, "://")
+	if !ok {
+		return nil, fmt.Errorf("parsing auth spec %q: missing scheme (want e.g. none://)", spec)
+	}
+
+	switch scheme {
+	case "none":
+		return NoneAuth{}, nil
+	case "static":
+		return newStaticAuth(rest)
+	case "basicfile":
+		return newBasicFileAuth(rest)
+	case "cert":
+		return newCertAuth(rest)
+	default:
+		return nil, fmt.Errorf("parsing auth spec %q: unknown scheme %q", spec, scheme)
+	}
+}
+
+// parseCaps parses a comma-separated capability list, e.g.
+// "subscribe=host=web1,publish", into the capabilities it grants and the
+// subscribe filter prefix (if any) that restricts CapSubscribe.
+func parseCaps(s string) ([]Capability, string, error) {
+	var caps []Capability
+	var filterPrefix string
+
+	for _, tok := range strings.Split(s, ",") {
+		tok = strings.TrimSpace(tok)
+		if tok == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(tok, "=")
+		switch name {
+		case "subscribe":
+			caps = append(caps, CapSubscribe)
+			if hasValue {
+				filterPrefix = value
+			}
+		case "publish":
+			caps = append(caps, CapPublish)
+		case "query":
+			caps = append(caps, CapQuery)
+		case "admin":
+			caps = append(caps, CapAdmin)
+		default:
+			return nil, "", fmt.Errorf("unknown capability %q", name)
+		}
+	}
+
+	return caps, filterPrefix, nil
+}
@@ -0,0 +1,119 @@
+package auth
+
+import "testing"
+
+// TestNewAuthDispatch covers NewAuth's scheme dispatch, including the
+// malformed-spec and unknown-scheme error paths.
+func TestNewAuthDispatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Auth
+		wantErr bool
+	}{
+		{name: "none", spec: "none://", want: NoneAuth{}},
+		{name: "static", spec: "static://?users=alice:secret:publish"},
+		{name: "basicfile missing path", spec: "basicfile://", wantErr: true},
+		{name: "cert missing uids", spec: "cert://", wantErr: true},
+		{name: "unknown scheme", spec: "ldap://", wantErr: true},
+		{name: "missing scheme", spec: "no-scheme-here", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewAuth(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NewAuth(%q): expected error, got none", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewAuth(%q): unexpected error: %v", tt.spec, err)
+			}
+			if tt.want != nil && got != tt.want {
+				t.Errorf("NewAuth(%q) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrincipalCan covers capability gating, including the nil-Principal
+// case every auth failure path returns.
+func TestPrincipalCan(t *testing.T) {
+	p := NewPrincipal("alice", "", CapSubscribe, CapQuery)
+	if !p.Can(CapSubscribe) {
+		t.Error("expected alice to have CapSubscribe")
+	}
+	if !p.Can(CapQuery) {
+		t.Error("expected alice to have CapQuery")
+	}
+	if p.Can(CapPublish) {
+		t.Error("expected alice not to have CapPublish")
+	}
+	if p.Can(CapAdmin) {
+		t.Error("expected alice not to have CapAdmin")
+	}
+
+	var nilP *Principal
+	if nilP.Can(CapSubscribe) {
+		t.Error("expected a nil Principal to have no capabilities")
+	}
+}
+
+// TestPrincipalFilterPrefix covers that a capability list with a scoped
+// subscribe=<prefix> entry records the prefix for callers to enforce.
+func TestPrincipalFilterPrefix(t *testing.T) {
+	p := NewPrincipal("bob", "host=web1", CapSubscribe)
+	if p.FilterPrefix != "host=web1" {
+		t.Errorf("FilterPrefix = %q, want %q", p.FilterPrefix, "host=web1")
+	}
+}
+
+// TestParseCaps covers the capability-list grammar, including the scoped
+// subscribe=<prefix> form and the unknown-capability error path.
+func TestParseCaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		s          string
+		wantCaps   []Capability
+		wantPrefix string
+		wantErr    bool
+	}{
+		{name: "empty", s: "", wantCaps: nil, wantPrefix: ""},
+		{name: "single", s: "publish", wantCaps: []Capability{CapPublish}},
+		{name: "multiple", s: "subscribe,publish,query,admin",
+			wantCaps: []Capability{CapSubscribe, CapPublish, CapQuery, CapAdmin}},
+		{name: "scoped subscribe", s: "subscribe=host=web1,publish",
+			wantCaps: []Capability{CapSubscribe, CapPublish}, wantPrefix: "host=web1"},
+		{name: "whitespace and blanks", s: " publish , , query ",
+			wantCaps: []Capability{CapPublish, CapQuery}},
+		{name: "unknown capability", s: "superuser", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps, prefix, err := parseCaps(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCaps(%q): expected error, got none", tt.s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCaps(%q): unexpected error: %v", tt.s, err)
+			}
+			if len(caps) != len(tt.wantCaps) {
+				t.Fatalf("parseCaps(%q) caps = %v, want %v", tt.s, caps, tt.wantCaps)
+			}
+			for i, c := range caps {
+				if c != tt.wantCaps[i] {
+					t.Errorf("parseCaps(%q) caps[%d] = %q, want %q", tt.s, i, c, tt.wantCaps[i])
+				}
+			}
+			if prefix != tt.wantPrefix {
+				t.Errorf("parseCaps(%q) prefix = %q, want %q", tt.s, prefix, tt.wantPrefix)
+			}
+		})
+	}
+}
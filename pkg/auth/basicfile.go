@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadInterval is how often a BasicFileAuth checks its backing file's
+// mtime for changes, trading off picking up htpasswd edits quickly against
+// stat-ing the file forever.
+const reloadInterval = 5 * time.Second
+
+// BasicFileAuth authenticates against an htpasswd-style file
+// (name:hash[:caps] per line; blank lines and '#' comments ignored),
+// re-reading it in the background whenever its mtime changes so rotating
+// or revoking a credential doesn't require restarting the proxy. A line
+// without a caps field falls back to the caps query parameter the file
+// was opened with. Built by NewAuth("basicfile:///path/to/htpasswd").
+type BasicFileAuth struct {
+	path          string
+	defaultCaps   []Capability
+	defaultPrefix string
+
+	mu      sync.RWMutex
+	users   map[string]credEntry
+	modTime time.Time
+}
+
+func newBasicFileAuth(rest string) (*BasicFileAuth, error) {
+	path, query, _ := strings.Cut(rest, "?")
+	if path == "" {
+		return nil, fmt.Errorf("parsing basicfile auth spec: missing file path")
+	}
+
+	a := &BasicFileAuth{path: path}
+
+	if query != "" {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("parsing basicfile auth query %q: %v", query, err)
+		}
+		if capsStr := values.Get("caps"); capsStr != "" {
+			a.defaultCaps, a.defaultPrefix, err = parseCaps(capsStr)
+			if err != nil {
+				return nil, fmt.Errorf("parsing basicfile auth caps: %v", err)
+			}
+		}
+	}
+
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	go a.watch()
+	return a, nil
+}
+
+func (a *BasicFileAuth) reload() error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return fmt.Errorf("opening htpasswd file %s: %v", a.path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat htpasswd file %s: %v", a.path, err)
+	}
+
+	users := make(map[string]credEntry)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 {
+			return fmt.Errorf("parsing htpasswd line %q: want name:hash[:caps]", line)
+		}
+
+		caps, prefix := a.defaultCaps, a.defaultPrefix
+		if len(fields) == 3 {
+			caps, prefix, err = parseCaps(fields[2])
+			if err != nil {
+				return fmt.Errorf("parsing htpasswd line %q: %v", line, err)
+			}
+		}
+
+		users[fields[0]] = credEntry{hash: fields[1], caps: caps, filterPrefix: prefix}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading htpasswd file %s: %v", a.path, err)
+	}
+
+	a.mu.Lock()
+	a.users = users
+	a.modTime = info.ModTime()
+	a.mu.Unlock()
+	return nil
+}
+
+// watch polls a.path's mtime every reloadInterval and reloads whenever it
+// changes. A failed reload (the file mid-write, say) logs and keeps
+// serving the last good table rather than locking everyone out.
+func (a *BasicFileAuth) watch() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(a.path)
+		if err != nil {
+			log.Printf("auth: stat %s failed: %v", a.path, err)
+			continue
+		}
+
+		a.mu.RLock()
+		changed := !info.ModTime().Equal(a.modTime)
+		a.mu.RUnlock()
+
+		if changed {
+			if err := a.reload(); err != nil {
+				log.Printf("auth: reloading %s failed: %v", a.path, err)
+			}
+		}
+	}
+}
+
+// Authenticate checks creds against the current htpasswd table.
+func (a *BasicFileAuth) Authenticate(creds Credentials) (*Principal, error) {
+	a.mu.RLock()
+	entry, ok := a.users[creds.User]
+	a.mu.RUnlock()
+
+	if !ok || !checkHtpasswd(entry.hash, creds.Pass) {
+		return nil, fmt.Errorf("invalid credentials for %q", creds.User)
+	}
+	return NewPrincipal(creds.User, entry.filterPrefix, entry.caps...), nil
+}
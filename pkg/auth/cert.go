@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CertAuth trusts the connecting process's local identity instead of a
+// secret it presents. The proxy's control plane is a bare unix domain
+// socket with no TLS layer of its own (mTLS is only between the proxy and
+// fluent-bit/Elasticsearch upstream), so there's no client certificate to
+// check here; what the kernel *can* tell us for a unix socket peer is its
+// uid via SO_PEERCRED, which is the closest equivalent "strong" identity
+// available, and what peerCredUID (cert_linux.go/cert_other.go) returns.
+// Built by NewAuth("cert://?uids=0,1000&caps=...").
+type CertAuth struct {
+	uids         map[int]bool
+	caps         []Capability
+	filterPrefix string
+}
+
+func newCertAuth(rest string) (*CertAuth, error) {
+	_, query, _ := strings.Cut(rest, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cert auth query %q: %v", query, err)
+	}
+
+	uids := make(map[int]bool)
+	for _, group := range values["uids"] {
+		for _, one := range strings.Split(group, ",") {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+			uid, err := strconv.Atoi(one)
+			if err != nil {
+				return nil, fmt.Errorf("parsing cert auth uids %q: %v", group, err)
+			}
+			uids[uid] = true
+		}
+	}
+	if len(uids) == 0 {
+		return nil, fmt.Errorf("parsing cert auth spec: at least one uid is required")
+	}
+
+	caps, filterPrefix, err := parseCaps(values.Get("caps"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing cert auth caps: %v", err)
+	}
+	if len(caps) == 0 {
+		caps = []Capability{CapSubscribe, CapPublish, CapQuery}
+	}
+
+	return &CertAuth{uids: uids, caps: caps, filterPrefix: filterPrefix}, nil
+}
+
+// Authenticate ignores creds.User/Pass and instead authorizes the peer uid
+// of creds.Conn, which must be a *net.UnixConn.
+func (a *CertAuth) Authenticate(creds Credentials) (*Principal, error) {
+	uid, err := peerCredUID(creds.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("reading peer credentials: %v", err)
+	}
+	if !a.uids[uid] {
+		return nil, fmt.Errorf("uid %d is not a trusted peer", uid)
+	}
+	return NewPrincipal(fmt.Sprintf("uid:%d", uid), a.filterPrefix, a.caps...), nil
+}
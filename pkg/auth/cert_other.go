@@ -0,0 +1,14 @@
+//go:build !linux
+
+package auth
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerCredUID is only implemented on Linux, where SO_PEERCRED is
+// available; cert:// isn't usable on other platforms.
+func peerCredUID(conn net.Conn) (int, error) {
+	return 0, fmt.Errorf("cert:// auth is only supported on linux")
+}
@@ -0,0 +1,105 @@
+//go:build linux
+
+package auth
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// TestNewCertAuthParsing covers the query grammar: the required uids
+// list, the default caps granted when none are specified, and the
+// missing-uids error.
+func TestNewCertAuthParsing(t *testing.T) {
+	a, err := newCertAuth("?uids=0,1000")
+	if err != nil {
+		t.Fatalf("newCertAuth: %v", err)
+	}
+	if !a.uids[0] || !a.uids[1000] {
+		t.Errorf("got uids %v, want {0, 1000}", a.uids)
+	}
+	if len(a.caps) == 0 {
+		t.Error("expected default caps to be granted when caps= is omitted")
+	}
+
+	if _, err := newCertAuth("?caps=query"); err == nil {
+		t.Error("expected error when uids is missing, got none")
+	}
+	if _, err := newCertAuth("?uids=notanumber"); err == nil {
+		t.Error("expected error for a non-numeric uid, got none")
+	}
+}
+
+// TestCertAuthAuthenticateRequiresUnixConn covers that cert:// rejects any
+// connection that isn't a *net.UnixConn, since peerCredUID has nothing to
+// read SO_PEERCRED off of otherwise.
+func TestCertAuthAuthenticateRequiresUnixConn(t *testing.T) {
+	a, err := newCertAuth("?uids=0")
+	if err != nil {
+		t.Fatalf("newCertAuth: %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	if _, err := a.Authenticate(Credentials{Conn: client}); err == nil {
+		t.Error("expected an error authenticating a non-unix connection, got none")
+	}
+}
+
+// TestCertAuthAuthenticateTrustsOwnUID exercises the real SO_PEERCRED path
+// over an actual unix socket pair: connecting as ourselves, our own uid
+// must be trusted when it's in the allowed set and rejected when it isn't.
+func TestCertAuthAuthenticateTrustsOwnUID(t *testing.T) {
+	dir := t.TempDir()
+	sockPath := dir + "/test.sock"
+
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	defer ln.Close()
+
+	serverConnCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			serverConnCh <- conn
+		}
+	}()
+
+	client, err := net.Dial("unix", sockPath)
+	if err != nil {
+		t.Fatalf("net.Dial: %v", err)
+	}
+	defer client.Close()
+
+	server := <-serverConnCh
+	defer server.Close()
+
+	uid := os.Getuid()
+
+	trusted, err := newCertAuth("?uids=" + strconv.Itoa(uid))
+	if err != nil {
+		t.Fatalf("newCertAuth: %v", err)
+	}
+	p, err := trusted.Authenticate(Credentials{Conn: server})
+	if err != nil {
+		t.Fatalf("Authenticate: unexpected error: %v", err)
+	}
+	wantName := "uid:" + strconv.Itoa(uid)
+	if p.Name != wantName {
+		t.Errorf("principal name = %q, want %q", p.Name, wantName)
+	}
+
+	untrusted, err := newCertAuth("?uids=" + strconv.Itoa(uid+1))
+	if err != nil {
+		t.Fatalf("newCertAuth: %v", err)
+	}
+	if _, err := untrusted.Authenticate(Credentials{Conn: server}); err == nil {
+		t.Error("expected an untrusted uid to be rejected, got none")
+	}
+}
@@ -0,0 +1,17 @@
+package auth
+
+import "crypto/subtle"
+
+// credEntry is one parsed user:hash:caps line or query entry, shared by
+// StaticAuth (held in memory) and BasicFileAuth (re-parsed from a file).
+type credEntry struct {
+	hash         string
+	caps         []Capability
+	filterPrefix string
+}
+
+// constantTimeEqual compares two plaintext secrets without leaking timing
+// information about where they first differ.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
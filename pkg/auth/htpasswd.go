@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// checkHtpasswd reports whether pass matches an htpasswd-style hash:
+// bcrypt ($2a$/$2b$/$2y$), Apache's {SHA} (base64 of a raw SHA1 digest), or
+// a plaintext line for deployments that don't care. Plaintext and {SHA}
+// both compare in constant time; bcrypt's own compare already does.
+func checkHtpasswd(hash, pass string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) == nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(pass))
+		want := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(want), []byte(hash)) == 1
+
+	default:
+		return constantTimeEqual(hash, pass)
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestCheckHtpasswd covers all three hash formats checkHtpasswd dispatches
+// on (bcrypt, Apache's {SHA}, and plaintext), plus their rejection paths.
+func TestCheckHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+
+	shaSum := sha1.Sum([]byte("secret"))
+	shaHash := "{SHA}" + base64.StdEncoding.EncodeToString(shaSum[:])
+
+	tests := []struct {
+		name string
+		hash string
+		pass string
+		want bool
+	}{
+		{name: "bcrypt $2a$ match", hash: string(bcryptHash), pass: "secret", want: true},
+		{name: "bcrypt mismatch", hash: string(bcryptHash), pass: "wrong", want: false},
+		{name: "sha match", hash: shaHash, pass: "secret", want: true},
+		{name: "sha mismatch", hash: shaHash, pass: "wrong", want: false},
+		{name: "plaintext match", hash: "secret", pass: "secret", want: true},
+		{name: "plaintext mismatch", hash: "secret", pass: "wrong", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkHtpasswd(tt.hash, tt.pass); got != tt.want {
+				t.Errorf("checkHtpasswd(%q, %q) = %v, want %v", tt.hash, tt.pass, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckHtpasswdBcryptVariants confirms the $2b$ and $2y$ bcrypt prefix
+// variants are dispatched the same as $2a$, not just the one GenerateFromPassword
+// happens to produce.
+func TestCheckHtpasswdBcryptVariants(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt.GenerateFromPassword: %v", err)
+	}
+
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		variant := prefix + string(hash)[4:]
+		if !checkHtpasswd(variant, "secret") {
+			t.Errorf("checkHtpasswd with %s prefix: expected match", prefix)
+		}
+	}
+}
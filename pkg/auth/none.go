@@ -0,0 +1,12 @@
+package auth
+
+// NoneAuth grants every capability to every connection, reproducing the
+// proxy's historical behavior where filesystem permissions on the unix
+// socket were the only gate. It's what -auth defaults to, so existing
+// deployments keep working without setting the flag.
+type NoneAuth struct{}
+
+// Authenticate always succeeds; creds is ignored.
+func (NoneAuth) Authenticate(Credentials) (*Principal, error) {
+	return NewPrincipal("anonymous", "", CapSubscribe, CapPublish, CapQuery, CapAdmin), nil
+}
@@ -0,0 +1,19 @@
+package auth
+
+import "testing"
+
+// TestNoneAuthGrantsEverything confirms NoneAuth reproduces the proxy's
+// historical filesystem-permissions-only behavior: any credentials,
+// including the zero value, get every capability.
+func TestNoneAuthGrantsEverything(t *testing.T) {
+	p, err := NoneAuth{}.Authenticate(Credentials{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, c := range []Capability{CapSubscribe, CapPublish, CapQuery, CapAdmin} {
+		if !p.Can(c) {
+			t.Errorf("expected NoneAuth principal to have capability %q", c)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// StaticAuth authenticates against a fixed, in-memory table of
+// name:pass:caps entries, for small deployments or ad hoc testing where a
+// credentials file isn't worth managing. Passwords are compared as
+// plaintext in constant time; use basicfile:// if hashed storage matters.
+// Built by NewAuth("static://?users=...").
+type StaticAuth struct {
+	users map[string]credEntry
+}
+
+func newStaticAuth(query string) (*StaticAuth, error) {
+	query = strings.TrimPrefix(query, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("parsing static auth query %q: %v", query, err)
+	}
+
+	users := make(map[string]credEntry)
+	for _, group := range values["users"] {
+		for _, one := range strings.Split(group, ";") {
+			one = strings.TrimSpace(one)
+			if one == "" {
+				continue
+			}
+
+			fields := strings.SplitN(one, ":", 3)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("parsing static auth user %q: want name:pass:caps", one)
+			}
+
+			caps, prefix, err := parseCaps(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("parsing static auth user %q: %v", fields[0], err)
+			}
+			users[fields[0]] = credEntry{hash: fields[1], caps: caps, filterPrefix: prefix}
+		}
+	}
+
+	return &StaticAuth{users: users}, nil
+}
+
+// Authenticate checks creds against the in-memory table.
+func (a *StaticAuth) Authenticate(creds Credentials) (*Principal, error) {
+	entry, ok := a.users[creds.User]
+	if !ok || !constantTimeEqual(entry.hash, creds.Pass) {
+		return nil, fmt.Errorf("invalid credentials for %q", creds.User)
+	}
+	return NewPrincipal(creds.User, entry.filterPrefix, entry.caps...), nil
+}
@@ -0,0 +1,73 @@
+package auth
+
+import "testing"
+
+// TestStaticAuthAuthenticate covers the happy path, wrong password, and
+// unknown-user rejection against an in-memory static table.
+func TestStaticAuthAuthenticate(t *testing.T) {
+	// url.ParseQuery rejects a literal ';' in the raw query (it used to be
+	// accepted as a second pair separator), so a real caller must
+	// percent-encode the ';' that separates entries within one users=
+	// value, same as we do here.
+	a, err := newStaticAuth("users=alice:secret:publish%3Bbob:hunter2:subscribe=host=web1,query")
+	if err != nil {
+		t.Fatalf("newStaticAuth: %v", err)
+	}
+
+	p, err := a.Authenticate(Credentials{User: "alice", Pass: "secret"})
+	if err != nil {
+		t.Fatalf("Authenticate(alice): unexpected error: %v", err)
+	}
+	if !p.Can(CapPublish) || p.Can(CapSubscribe) {
+		t.Errorf("alice principal has wrong capabilities: %+v", p)
+	}
+
+	p, err = a.Authenticate(Credentials{User: "bob", Pass: "hunter2"})
+	if err != nil {
+		t.Fatalf("Authenticate(bob): unexpected error: %v", err)
+	}
+	if !p.Can(CapSubscribe) || !p.Can(CapQuery) || p.FilterPrefix != "host=web1" {
+		t.Errorf("bob principal has wrong grants: %+v", p)
+	}
+
+	if _, err := a.Authenticate(Credentials{User: "alice", Pass: "wrong"}); err == nil {
+		t.Error("expected error for wrong password, got none")
+	}
+	if _, err := a.Authenticate(Credentials{User: "carol", Pass: "anything"}); err == nil {
+		t.Error("expected error for unknown user, got none")
+	}
+}
+
+// TestNewStaticAuthMultipleUsersGroups covers that repeated "users" query
+// parameters (not just ';'-joined entries within one) all get parsed.
+func TestNewStaticAuthMultipleUsersGroups(t *testing.T) {
+	a, err := newStaticAuth("users=alice:secret:publish&users=bob:hunter2:query")
+	if err != nil {
+		t.Fatalf("newStaticAuth: %v", err)
+	}
+	if len(a.users) != 2 {
+		t.Fatalf("got %d users, want 2", len(a.users))
+	}
+}
+
+// TestNewStaticAuthMalformed covers the parse-error paths: a user entry
+// missing the caps field, and an unparseable capability.
+func TestNewStaticAuthMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "missing caps field", query: "users=alice:secret"},
+		{name: "too few fields", query: "users=alice"},
+		{name: "bad capability", query: "users=alice:secret:superuser"},
+		{name: "invalid query escape", query: "users=%zz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newStaticAuth(tt.query); err == nil {
+				t.Errorf("newStaticAuth(%q): expected error, got none", tt.query)
+			}
+		})
+	}
+}
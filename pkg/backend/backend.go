@@ -0,0 +1,32 @@
+// Package backend selects and opens an estransport.IndexBackend per
+// TOTALRECALL_BACKEND, so consumers like dirjump don't each need to
+// reimplement the es/local switch themselves.
+package backend
+
+import (
+	"fmt"
+	"os"
+
+	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/localindex"
+)
+
+// Open connects an estransport.IndexBackend: TOTALRECALL_BACKEND=local
+// opens an embedded pkg/localindex.Backend (configured via
+// localindex.ConfigFromEnv); anything else, including unset, dials
+// endpoints via estransport.NewESClientWithFallback as before this
+// package existed.
+func Open(endpoints []estransport.Endpoint) (estransport.IndexBackend, error) {
+	switch mode := os.Getenv("TOTALRECALL_BACKEND"); mode {
+	case "", "es":
+		return estransport.NewESClientWithFallback(endpoints)
+	case "local":
+		b, err := localindex.Open(localindex.ConfigFromEnv())
+		if err != nil {
+			return nil, fmt.Errorf("opening local index backend: %v", err)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown TOTALRECALL_BACKEND %q (want \"es\" or \"local\")", mode)
+	}
+}
@@ -0,0 +1,203 @@
+// Package dirsuggest predicts the next shell command for a directory from
+// the command history observed so far. It replaces the old
+// reactive-tui.suggestCommands heuristic (a hardcoded git/src check with a
+// shadowed-variable bug that meant it never actually fired) with a real
+// per-directory model: a unigram frequency table, a command_{t-1} ->
+// command_t bigram, and an exit-code-weighted success rate, blended into one
+// score and reused by anything that wants "what would I run here" -
+// reactive-tui today, a shell-completion helper later.
+package dirsuggest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Weights tunes how much each term of the suggestion score contributes:
+// Alpha*P(c|dir) + Beta*P(c|prevCmd,dir) + Gamma*successRate(c,dir).
+type Weights struct {
+	Alpha float64 `json:"alpha"`
+	Beta  float64 `json:"beta"`
+	Gamma float64 `json:"gamma"`
+}
+
+// DefaultWeights favors raw frequency slightly over the bigram term, with a
+// smaller nudge from the success rate so a command that usually fails is
+// demoted without being ruled out entirely.
+func DefaultWeights() Weights {
+	return Weights{Alpha: 0.45, Beta: 0.4, Gamma: 0.15}
+}
+
+// dirStats holds the counts a single directory's model is built from.
+// Bigram is keyed prevCmd -> cmd -> count.
+type dirStats struct {
+	CommandCounts map[string]int            `json:"command_counts"`
+	Total         int                       `json:"total"`
+	Bigram        map[string]map[string]int `json:"bigram"`
+	Successes     map[string]int            `json:"successes"`
+	Failures      map[string]int            `json:"failures"`
+}
+
+func newDirStats() *dirStats {
+	return &dirStats{
+		CommandCounts: make(map[string]int),
+		Bigram:        make(map[string]map[string]int),
+		Successes:     make(map[string]int),
+		Failures:      make(map[string]int),
+	}
+}
+
+// Model is a collection of per-directory dirStats plus the weights used to
+// blend them into a score. The zero value is not usable; build one with
+// NewModel or Load.
+type Model struct {
+	Weights Weights              `json:"weights"`
+	Dirs    map[string]*dirStats `json:"dirs"`
+}
+
+// NewModel returns an empty model with DefaultWeights.
+func NewModel() *Model {
+	return &Model{Weights: DefaultWeights(), Dirs: make(map[string]*dirStats)}
+}
+
+// Suggestion is one scored candidate returned by Suggest.
+type Suggestion struct {
+	Command string
+	Score   float64
+}
+
+// Observe folds one more executed command into dir's model. prevCmd is the
+// command that ran immediately before cmd in dir, or "" if cmd was the
+// first command observed there (or the caller doesn't track sequence).
+func (m *Model) Observe(dir, prevCmd, cmd string, returnCode int) {
+	if cmd == "" {
+		return
+	}
+
+	dm, ok := m.Dirs[dir]
+	if !ok {
+		dm = newDirStats()
+		m.Dirs[dir] = dm
+	}
+
+	dm.CommandCounts[cmd]++
+	dm.Total++
+	if returnCode == 0 {
+		dm.Successes[cmd]++
+	} else {
+		dm.Failures[cmd]++
+	}
+
+	if prevCmd != "" {
+		next := dm.Bigram[prevCmd]
+		if next == nil {
+			next = make(map[string]int)
+			dm.Bigram[prevCmd] = next
+		}
+		next[cmd]++
+	}
+}
+
+// Suggest returns up to k commands predicted for dir, ranked by
+// Alpha*P(c|dir) + Beta*P(c|prevCmd,dir) + Gamma*successRate(c,dir), all
+// three Laplace-smoothed so a command seen once isn't scored as certain and
+// one never seen in this dir isn't scored as impossible. Returns nil if dir
+// has no history yet.
+func (m *Model) Suggest(dir, prevCmd string, k int) []Suggestion {
+	dm, ok := m.Dirs[dir]
+	if !ok || len(dm.CommandCounts) == 0 {
+		return nil
+	}
+
+	vocab := len(dm.CommandCounts)
+	bigramTotal := 0
+	if prevCmd != "" {
+		for _, count := range dm.Bigram[prevCmd] {
+			bigramTotal += count
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, vocab)
+	for cmd, count := range dm.CommandCounts {
+		pDir := laplace(count, dm.Total, vocab)
+
+		pBigram := 0.0
+		if prevCmd != "" {
+			pBigram = laplace(dm.Bigram[prevCmd][cmd], bigramTotal, vocab)
+		}
+
+		successRate := laplace(dm.Successes[cmd], dm.Successes[cmd]+dm.Failures[cmd], 2)
+
+		score := m.Weights.Alpha*pDir + m.Weights.Beta*pBigram + m.Weights.Gamma*successRate
+		suggestions = append(suggestions, Suggestion{Command: cmd, Score: score})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Command < suggestions[j].Command // stable tie-break
+	})
+
+	if k > 0 && len(suggestions) > k {
+		suggestions = suggestions[:k]
+	}
+	return suggestions
+}
+
+// laplace add-one-smooths count out of total across classes distinct
+// outcomes, so an unseen outcome scores low instead of zero and a single
+// observation doesn't score as certainty.
+func laplace(count, total, classes int) float64 {
+	return float64(count+1) / float64(total+classes)
+}
+
+// DefaultPath returns ~/.totalrecall/dirsuggest-model.json.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "dirsuggest-model.json")
+}
+
+// Load reads a Model from path, returning a fresh NewModel if the file
+// doesn't exist yet.
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewModel(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading dirsuggest model %s: %v", path, err)
+	}
+
+	m := NewModel()
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing dirsuggest model %s: %v", path, err)
+	}
+	if m.Dirs == nil {
+		m.Dirs = make(map[string]*dirStats)
+	}
+	return m, nil
+}
+
+// Save writes m to path as indented JSON, creating path's directory if
+// necessary.
+func Save(path string, m *Model) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating directory for dirsuggest model %s: %v", path, err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding dirsuggest model: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing dirsuggest model %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Package encoding selects a wire format for a schema.CommandEvent. It
+// exists so preexec, postexec, and the NATS publisher can all share the
+// same `--encoding` flag and the same set of encoders instead of each
+// hand-rolling json.Marshal on three slightly different shapes.
+package encoding
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+
+	"totalrecall/pkg/schema"
+)
+
+// Name identifies an encoder. The zero value is Unspecified and callers
+// should treat it as JSON for backwards compatibility with events recorded
+// before this package existed.
+type Name string
+
+const (
+	Unspecified Name = ""
+	JSON        Name = "json"
+	Protobuf    Name = "protobuf"
+)
+
+// Encoder turns a CommandEvent into bytes and back.
+type Encoder interface {
+	Name() Name
+	Marshal(ev *schema.CommandEvent) ([]byte, error)
+	Unmarshal(data []byte, ev *schema.CommandEvent) error
+}
+
+// New resolves a Name into an Encoder, defaulting to JSON.
+func New(name Name) (Encoder, error) {
+	switch name {
+	case Unspecified, JSON:
+		return jsonEncoder{}, nil
+	case Protobuf:
+		return protobufEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() Name { return JSON }
+
+func (jsonEncoder) Marshal(ev *schema.CommandEvent) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+func (jsonEncoder) Unmarshal(data []byte, ev *schema.CommandEvent) error {
+	return json.Unmarshal(data, ev)
+}
+
+// protobufEncoder uses the same wire encoder NATS' protobuf codec relies
+// on, so a JetStream subscriber using nats.go's "protobuf" encoded
+// connection can decode these messages without totalrecall-specific glue.
+type protobufEncoder struct{}
+
+func (protobufEncoder) Name() Name { return Protobuf }
+
+func (protobufEncoder) Marshal(ev *schema.CommandEvent) ([]byte, error) {
+	return proto.Marshal(ev)
+}
+
+func (protobufEncoder) Unmarshal(data []byte, ev *schema.CommandEvent) error {
+	return proto.Unmarshal(data, ev)
+}
@@ -0,0 +1,121 @@
+package envfilter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// agePrefix marks a redacted value as age-encrypted rather than hashed, so
+// (*Config).DecryptValue can tell the two redaction schemes apart.
+const agePrefix = "age1_"
+
+// DefaultKeyDir is where a generated or user-supplied age identity lives
+// when a Config doesn't set KeyDir explicitly.
+func DefaultKeyDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".config", "totalrecall", "keys")
+}
+
+// LoadOrCreateIdentity loads the age identity at <dir>/identity.txt,
+// generating one (and the directory) on first use.
+func LoadOrCreateIdentity(dir string) (*age.X25519Identity, error) {
+	if dir == "" {
+		dir = DefaultKeyDir()
+	}
+	path := filepath.Join(dir, "identity.txt")
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		id, err := age.ParseX25519Identity(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age identity %s: %v", path, err)
+		}
+		return id, nil
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("generating age identity: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating key directory %s: %v", dir, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(id.String()+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("writing age identity %s: %v", path, err)
+	}
+	return id, nil
+}
+
+// ParseRecipients turns configured recipient strings (age1... public keys,
+// or scrypt passphrase recipients) into age.Recipient values. A string that
+// doesn't parse as an X25519 public key is treated as a scrypt passphrase
+// instead of failing outright. age's ScryptRecipient can't be combined with
+// other recipients or used more than once for the same file, so a
+// passphrase entry is only accepted when it's the only recipient given.
+func ParseRecipients(recipients []string) ([]age.Recipient, error) {
+	out := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		if rec, err := age.ParseX25519Recipient(r); err == nil {
+			out = append(out, rec)
+			continue
+		}
+
+		if len(recipients) != 1 {
+			return nil, fmt.Errorf("parsing recipient %q: scrypt passphrase recipients can't be combined with other recipients", r)
+		}
+		rec, err := age.NewScryptRecipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("parsing recipient %q: %v", r, err)
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// EncryptValue encrypts value to recipients and returns an "age1_"-prefixed,
+// base64-encoded ciphertext short enough to live in a single env var value.
+func EncryptValue(value string, recipients []age.Recipient) (string, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipients...)
+	if err != nil {
+		return "", fmt.Errorf("preparing age encryption: %v", err)
+	}
+	if _, err := io.WriteString(w, value); err != nil {
+		return "", fmt.Errorf("encrypting value: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("finalizing encrypted value: %v", err)
+	}
+	return agePrefix + base64.RawStdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecryptValue reverses EncryptValue using identity.
+func DecryptValue(value string, identity age.Identity) (string, error) {
+	if !strings.HasPrefix(value, agePrefix) {
+		return "", fmt.Errorf("value is not an age-encrypted value")
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, agePrefix))
+	if err != nil {
+		return "", fmt.Errorf("decoding age ciphertext: %v", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(raw), identity)
+	if err != nil {
+		return "", fmt.Errorf("decrypting value: %v", err)
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("reading decrypted value: %v", err)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,711 @@
+// Package envfilter decides which environment variables a recorded command
+// carries along and how sensitive ones are redacted. It started as
+// tools/precmd-hook's EnvConfig and moved here so the totalrecall binary's
+// `decrypt` subcommand can share the same redaction logic instead of
+// duplicating it.
+//
+// The filtering logic works as follows:
+// 1. Absolute deny patterns are checked first (these vars are never included)
+// 2. Variables must match the allowlist (exact or pattern) to be considered
+// 3. Allowed variables that match denylist patterns are REDACTED but INCLUDED
+// 4. Other allowed variables are included in plaintext
+//
+// This design ensures sensitive variables provide context without exposing secrets.
+package envfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// absoluteDenyPatterns are variables that are never included, even
+// redacted, regardless of user config. Declared once at package scope
+// (rather than rebuilt per ShouldIncludeEnvVar call) since they're folded
+// into absoluteDenyRe at config-compile time.
+var absoluteDenyPatterns = []string{
+	`^___PREEXEC_`,         // Our temporary variables
+	`^__`,                  // Double underscore variables (usually internal)
+	`^BASH_FUNC_`,          // Bash function exports
+	`^_$`,                  // Last argument of previous command
+	`^PS[1-4]$`,            // Prompt strings
+	`^TERM$`,               // Terminal type
+	`^LINES$`, `^COLUMNS$`, // Terminal dimensions
+	`^HIST`,                                 // History settings
+	`^IFS$`,                                 // Internal field separator
+	`^OPT`,                                  // getopt variables
+	`^RANDOM$`,                              // Random number
+	`^SECONDS$`,                             // Seconds since shell start
+	`^BASH_`,                                // Most bash internals
+	`^FUNCNAME$`, `^PIPESTATUS$`, `^REPLY$`, // Bash internals
+	`^SHELLOPTS$`, `^BASHOPTS$`, // Shell options
+	`TOTALRECALLROOT`, // Our own variable
+}
+
+// sensitivePatterns are built-in name patterns that suggest a value might
+// be sensitive, used to redact (not exclude) an otherwise-allowed variable
+// when HashSensitiveValues or EncryptSensitiveValues is set.
+var sensitivePatterns = []string{
+	`(?i)password`,   // Any variable with "password"
+	`(?i)secret`,     // Any variable with "secret"
+	`(?i)key`,        // Any variable with "key" (API keys, etc.)
+	`(?i)token`,      // Any variable with "token"
+	`(?i)auth`,       // Any variable with "auth"
+	`(?i)credential`, // Any variable with "credential"
+	`(?i)private`,    // Any variable with "private"
+	`(?i)session`,    // Any variable with "session"
+	`(?i)cookie`,     // Any variable with "cookie"
+	`(?i)cert`,       // Any variable with "cert"
+	`(?i)ssl`,        // Any variable with "ssl"
+	`(?i)tls`,        // Any variable with "tls"
+	`(?i)oauth`,      // Any variable with "oauth"
+	`(?i)jwt`,        // Any variable with "jwt"
+	`(?i)bearer`,     // Any variable with "bearer"
+	`(?i)access`,     // Any variable with "access"
+	`(?i)refresh`,    // Any variable with "refresh"
+	`(?i)salt`,       // Any variable with "salt"
+	`(?i)hash`,       // Any variable with "hash"
+	`(?i)signature`,  // Any variable with "signature"
+	`(?i)license`,    // Any variable with "license"
+	`(?i)serial`,     // Any variable with "serial"
+	`(?i)url`,        // URLs might contain credentials
+	`(?i)dsn`,        // Database connection strings
+	`(?i)connection`, // Connection strings
+	`(?i)endpoint`,   // API endpoints might be sensitive
+}
+
+// compileAlternation compiles patterns into a single regex joining them
+// with alternation, so matching costs one regex evaluation instead of
+// O(len(patterns)) recompiles-and-matches. label identifies the bucket in
+// error messages.
+func compileAlternation(patterns []string, label string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	wrapped := make([]string, len(patterns))
+	for i, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("%s pattern %d (%q): %v", label, i, p, err)
+		}
+		wrapped[i] = "(?:" + p + ")"
+	}
+	re, err := regexp.Compile(strings.Join(wrapped, "|"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", label, err)
+	}
+	return re, nil
+}
+
+// mustCompileAlternation is compileAlternation for the package's own
+// built-in pattern lists: a failure there is a bug in this file, not bad
+// user input, so it panics like DefaultValueScanner does for the same
+// reason.
+func mustCompileAlternation(patterns []string, label string) *regexp.Regexp {
+	re, err := compileAlternation(patterns, label)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// Config holds the configuration for environment variable filtering.
+type Config struct {
+	// High-value environment variables that provide context for command prediction
+	Allowlist struct {
+		// Exact matches (case-sensitive)
+		Exact []string `json:"exact"`
+		// Regex patterns for matching variable names
+		Patterns []string `json:"patterns"`
+	} `json:"allowlist"`
+
+	// Sensitive or low-value variables (different handling)
+	Denylist struct {
+		// Exact matches that should NEVER be included (case-sensitive)
+		Exact []string `json:"exact"`
+		// Regex patterns for variables that should be REDACTED but INCLUDED (case-insensitive)
+		Patterns []string `json:"patterns"`
+	} `json:"denylist"`
+
+	// Whether to redact allowed variables that match sensitive patterns.
+	// When true, variables matching denylist patterns are redacted but still
+	// included. When false (and EncryptSensitiveValues is also false),
+	// sensitive variables are included in plaintext (not recommended).
+	HashSensitiveValues bool `json:"hash_sensitive_values"`
+
+	// EncryptSensitiveValues switches redaction from the one-way h8_<hex>
+	// hash to age envelope encryption (age1_<base64>), so a variable's value
+	// stays recoverable by its owner via (*Config).DecryptValue. Takes
+	// precedence over HashSensitiveValues.
+	EncryptSensitiveValues bool `json:"encrypt_sensitive_values,omitempty"`
+
+	// Recipients are the age recipients (public keys, including team/shared
+	// keys and passphrase recipients) sensitive values are encrypted to when
+	// EncryptSensitiveValues is set. Defaults to the identity loaded/created
+	// under KeyDir.
+	Recipients []string `json:"recipients,omitempty"`
+
+	// KeyDir overrides where the local age identity is stored/generated.
+	// Defaults to DefaultKeyDir().
+	KeyDir string `json:"key_dir,omitempty"`
+
+	// Scanners are value-level secret detectors, run against every value
+	// regardless of whether the variable's name looked sensitive. A nil or
+	// empty list uses DefaultValueScanner's built-in detectors.
+	Scanners []*Detector `json:"value_scanners,omitempty"`
+
+	// Transforms rewrite a variable's value before it's redacted, so e.g. a
+	// DATABASE_URL can have its credentials stripped before the value
+	// scanner sees it. They run in order, between allowlist admission and
+	// redaction; the first match for a given variable wins. A variable whose
+	// name matches a sensitive pattern is still redacted after its transform.
+	Transforms []*Transform `json:"transforms,omitempty"`
+
+	identity       age.Identity  // lazily loaded, unexported so it's never serialized
+	redactor       ValueRedactor // lazily built, unexported so it's never serialized
+	scannerCache   *ValueScanner // lazily built, unexported so it's never serialized
+	transformsDone bool          // whether Transforms has been compiled
+
+	// Precompiled regexes, populated by compilePatterns (called from
+	// LoadConfig/DefaultConfig, and lazily by ShouldIncludeEnvVar for a
+	// Config built by hand). Each bucket is one alternation regex instead
+	// of a slice of patterns, so ShouldIncludeEnvVar does one match per
+	// bucket instead of recompiling and matching every pattern in turn.
+	absoluteDenyRe     *regexp.Regexp
+	sensitiveRe        *regexp.Regexp
+	allowlistPatternRe *regexp.Regexp
+	denylistPatternRe  *regexp.Regexp
+	patternsCompiled   bool
+}
+
+// compilePatterns precompiles the built-in and user-configured name
+// patterns into one alternation regex per bucket. Built-in patterns always
+// compile (mustCompileAlternation panics otherwise, since that'd be a bug
+// in this file); user patterns in Allowlist.Patterns/Denylist.Patterns can
+// come from an untrusted config file, so a bad one is reported with its
+// index and text instead of panicking.
+func (config *Config) compilePatterns() error {
+	config.absoluteDenyRe = mustCompileAlternation(absoluteDenyPatterns, "built-in absolute deny")
+	config.sensitiveRe = mustCompileAlternation(sensitivePatterns, "built-in sensitive")
+
+	var err error
+	if config.allowlistPatternRe, err = compileAlternation(config.Allowlist.Patterns, "allowlist pattern"); err != nil {
+		return err
+	}
+	if config.denylistPatternRe, err = compileAlternation(config.Denylist.Patterns, "denylist pattern"); err != nil {
+		return err
+	}
+	config.patternsCompiled = true
+	return nil
+}
+
+// ensurePatternsCompiled lazily runs compilePatterns for a Config that
+// wasn't built via LoadConfig/DefaultConfig (e.g. a struct literal in a
+// test), swallowing a bad user pattern rather than panicking mid-filter: the
+// bucket holding it is left nil and matches nothing, and a bad allowlist
+// pattern also leaves the denylist bucket uncompiled.
+func (config *Config) ensurePatternsCompiled() {
+	if config.patternsCompiled {
+		return
+	}
+	if err := config.compilePatterns(); err != nil {
+		config.patternsCompiled = true
+	}
+}
+
+// DefaultConfig returns a sensible default configuration
+func DefaultConfig() *Config {
+	config := &Config{
+		Allowlist: struct {
+			Exact    []string `json:"exact"`
+			Patterns []string `json:"patterns"`
+		}{
+			// High-value exact matches
+			Exact: []string{
+				"PWD",             // Current directory (critical for context)
+				"OLDPWD",          // Previous directory
+				"USER",            // Current user
+				"HOME",            // Home directory
+				"SHELL",           // Current shell
+				"LANG",            // Locale (affects command behavior)
+				"LC_ALL",          // Locale override
+				"TZ",              // Timezone
+				"EDITOR",          // Default editor
+				"PAGER",           // Default pager
+				"BROWSER",         // Default browser
+				"TMPDIR",          // Temporary directory
+				"XDG_CONFIG_HOME", // Config directory
+				"XDG_DATA_HOME",   // Data directory
+				"XDG_CACHE_HOME",  // Cache directory
+
+				// Common development environment indicators
+				"NODE_ENV",               // Node.js environment
+				"RAILS_ENV",              // Rails environment
+				"DJANGO_SETTINGS_MODULE", // Django settings
+				"FLASK_ENV",              // Flask environment
+				"ENVIRONMENT",            // Generic environment indicator
+				"ENV",                    // Generic environment indicator
+				"STAGE",                  // Deployment stage
+				"DEPLOY_ENV",             // Deployment environment
+
+				// Version managers
+				"RBENV_VERSION", // Ruby version
+				"PYENV_VERSION", // Python version
+				"NVM_CURRENT",   // Node version
+				"JAVA_HOME",     // Java installation
+				"GOPATH",        // Go workspace
+				"GOROOT",        // Go installation
+				"CARGO_HOME",    // Rust cargo home
+				"RUSTUP_HOME",   // Rust installation
+
+				// Cloud provider indicators
+				"AWS_PROFILE",          // AWS profile
+				"AWS_REGION",           // AWS region
+				"GOOGLE_CLOUD_PROJECT", // GCP project
+				"AZURE_RESOURCE_GROUP", // Azure resource group
+
+				// Container/orchestration
+				"DOCKER_HOST",          // Docker daemon
+				"KUBERNETES_NAMESPACE", // K8s namespace
+				"KUBECTL_CONTEXT",      // kubectl context
+
+				// CI/CD indicators
+				"CI",             // CI environment flag
+				"GITHUB_ACTIONS", // GitHub Actions
+				"JENKINS_URL",    // Jenkins
+				"GITLAB_CI",      // GitLab CI
+				"TRAVIS",         // Travis CI
+				"CIRCLECI",       // CircleCI
+			},
+
+			// High-value patterns (case-sensitive regex)
+			Patterns: []string{
+				`^[A-Z_]+_ENV$`,         // *_ENV variables
+				`^[A-Z_]+_ENVIRONMENT$`, // *_ENVIRONMENT variables
+				`^[A-Z_]+_STAGE$`,       // *_STAGE variables
+				`^[A-Z_]+_PROFILE$`,     // *_PROFILE variables
+				`^[A-Z_]+_NAMESPACE$`,   // *_NAMESPACE variables
+				`^[A-Z_]+_CLUSTER$`,     // *_CLUSTER variables
+				`^[A-Z_]+_REGION$`,      // *_REGION variables
+				`^[A-Z_]+_ZONE$`,        // *_ZONE variables
+				`^[A-Z_]+_BRANCH$`,      // *_BRANCH variables (git branch indicators)
+				`^[A-Z_]+_VERSION$`,     // *_VERSION variables
+				`^[A-Z_]+_PATH$`,        // *_PATH variables (tool paths)
+				`^[A-Z_]+_HOME$`,        // *_HOME variables (tool homes)
+				`^[A-Z_]+_ROOT$`,        // *_ROOT variables (project roots)
+				`^[A-Z_]+_CONFIG$`,      // *_CONFIG variables
+				`^[A-Z_]+_URL$`,         // *_URL variables (service URLs)
+				`^[A-Z_]+_HOST$`,        // *_HOST variables (service hosts)
+				`^[A-Z_]+_PORT$`,        // *_PORT variables (service ports)
+				`^[A-Z_]+_KEY$`,         // *_KEY variables (API keys, etc.)
+				`^GIT_`,                 // Git-related variables
+				`^DOCKER_`,              // Docker-related variables
+				`^K8S_`,                 // Kubernetes-related variables
+				`^KUBE_`,                // Kubernetes-related variables
+				`^HELM_`,                // Helm-related variables
+				`^TERRAFORM_`,           // Terraform-related variables
+			},
+		},
+
+		Denylist: struct {
+			Exact    []string `json:"exact"`
+			Patterns []string `json:"patterns"`
+		}{
+			// Always exclude these exact matches (never include, even redacted)
+			Exact: []string{
+				"_",                        // Last argument of previous command
+				"PS1", "PS2", "PS3", "PS4", // Prompt strings
+				"TERM",             // Terminal type
+				"LINES", "COLUMNS", // Terminal dimensions
+				"HISTFILE", "HISTSIZE", "HISTCONTROL", "HISTTIMEFORMAT", // History settings
+				"IFS",                        // Internal field separator
+				"OPTIND", "OPTARG", "OPTERR", // getopt variables
+				"RANDOM",                        // Random number
+				"SECONDS",                       // Seconds since shell start
+				"BASH_VERSINFO", "BASH_VERSION", // Shell version info
+				"BASH_ARGC", "BASH_ARGV", "BASH_ARGV0", // Bash internals
+				"BASH_COMMAND", "BASH_EXECUTION_STRING", // Bash internals
+				"BASH_LINENO", "BASH_SOURCE", "BASH_SUBSHELL", // Bash internals
+				"FUNCNAME", "BASH_REMATCH", // Bash internals
+				"PIPESTATUS",            // Pipeline status
+				"REPLY",                 // read builtin variable
+				"SHELLOPTS", "BASHOPTS", // Shell options
+				"TOTALRECALLROOT", // Our own variable
+			},
+
+			// Sensitive patterns that should be REDACTED but INCLUDED (not excluded)
+			// These variables have value for context but contain sensitive data
+			Patterns: []string{
+				`(?i)password`,   // Any variable with "password"
+				`(?i)secret`,     // Any variable with "secret"
+				`(?i)key`,        // Any variable with "key" (API keys, etc.)
+				`(?i)token`,      // Any variable with "token"
+				`(?i)auth`,       // Any variable with "auth"
+				`(?i)credential`, // Any variable with "credential"
+				`(?i)private`,    // Any variable with "private"
+				`(?i)session`,    // Any variable with "session"
+				`(?i)cookie`,     // Any variable with "cookie"
+				`(?i)cert`,       // Any variable with "cert"
+				`(?i)ssl`,        // Any variable with "ssl"
+				`(?i)tls`,        // Any variable with "tls"
+				`(?i)oauth`,      // Any variable with "oauth"
+				`(?i)jwt`,        // Any variable with "jwt"
+				`(?i)bearer`,     // Any variable with "bearer"
+				`(?i)access`,     // Any variable with "access"
+				`(?i)refresh`,    // Any variable with "refresh"
+				`(?i)salt`,       // Any variable with "salt"
+				`(?i)hash`,       // Any variable with "hash"
+				`(?i)signature`,  // Any variable with "signature"
+				`(?i)license`,    // Any variable with "license"
+				`(?i)serial`,     // Any variable with "serial"
+			},
+		},
+
+		HashSensitiveValues: true,
+	}
+	if err := config.compilePatterns(); err != nil {
+		// The built-in defaults always compile; a failure here is a bug in
+		// this file, not bad user input.
+		panic(err)
+	}
+	return config
+}
+
+// LoadConfig loads configuration from a file, falling back to defaults
+func LoadConfig(configPath string) (*Config, error) {
+	// Try to load from config file
+	if configPath != "" {
+		data, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %v", configPath, err)
+		}
+
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %v", configPath, err)
+		}
+		if err := config.compilePatterns(); err != nil {
+			return nil, fmt.Errorf("config file %s: %v", configPath, err)
+		}
+
+		return &config, nil
+	}
+
+	// Try to load from default locations
+	defaultPaths := []string{
+		filepath.Join(os.Getenv("HOME"), ".totalrecall", "env-config.json"),
+		filepath.Join(os.Getenv("HOME"), ".config", "totalrecall", "env-config.json"),
+		"env-config.json",
+	}
+
+	for _, path := range defaultPaths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			continue
+		}
+		if err := config.compilePatterns(); err != nil {
+			return nil, fmt.Errorf("config file %s: %v", path, err)
+		}
+		return &config, nil
+	}
+
+	// Fall back to default configuration
+	return DefaultConfig(), nil
+}
+
+// SaveDefaultConfig saves the default configuration to a file
+func SaveDefaultConfig(path string) error {
+	config := DefaultConfig()
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	// Ensure directory exists
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ShouldIncludeEnvVar determines if an environment variable should be included
+func (config *Config) ShouldIncludeEnvVar(key, value string) (include bool, shouldRedact bool) {
+	config.ensurePatternsCompiled()
+
+	// First check absolute denylist (things that should NEVER be included, even redacted)
+	if config.absoluteDenyRe.MatchString(key) {
+		return false, false
+	}
+
+	// Check user-defined absolute denylists
+	for _, denied := range config.Denylist.Exact {
+		if key == denied {
+			return false, false
+		}
+	}
+
+	// Check allowlist to see if this variable has value
+	allowed := false
+
+	// Check exact matches
+	for _, allowedVar := range config.Allowlist.Exact {
+		if key == allowedVar {
+			allowed = true
+			break
+		}
+	}
+
+	// Check patterns if not already allowed
+	if !allowed && config.allowlistPatternRe != nil && config.allowlistPatternRe.MatchString(key) {
+		allowed = true
+	}
+
+	if !allowed {
+		return false, false
+	}
+
+	// Now the variable is allowed, but should we redact it?
+
+	// Check user-defined sensitive patterns (these get redacted but included)
+	if config.denylistPatternRe != nil && config.denylistPatternRe.MatchString(key) {
+		return true, true // Include but redact
+	}
+
+	// Check built-in patterns that suggest the value might be sensitive
+	if (config.HashSensitiveValues || config.EncryptSensitiveValues) && config.sensitiveRe.MatchString(key) {
+		return true, true // Include but redact
+	}
+
+	return true, false
+}
+
+// FilterEnvironment filters environment variables according to the configuration
+func (config *Config) FilterEnvironment(env map[string]string) map[string]string {
+	values, _ := config.FilterEnvironmentWithReasons(env)
+	return values
+}
+
+// FilterEnvironmentWithReasons is FilterEnvironment, plus a reasons map
+// recording, for every redacted variable, what forced the redaction —
+// "name_pattern" for the existing allowlist/denylist logic, or
+// "value_pattern:<detector-name>" when a ValueScanner detector fired against
+// the value itself, even though the variable's name was on the allowlist.
+func (config *Config) FilterEnvironmentWithReasons(env map[string]string) (values map[string]string, reasons map[string]string) {
+	values = make(map[string]string)
+	reasons = make(map[string]string)
+
+	for key, value := range env {
+		include, shouldRedact, reason, _, finalValue := config.classify(key, value)
+		if !include {
+			continue
+		}
+		if !shouldRedact {
+			values[key] = finalValue
+			continue
+		}
+
+		redacted, err := config.redact(key, finalValue)
+		if err != nil {
+			// Fail safe: never emit a value we couldn't redact.
+			continue
+		}
+		values[key] = redacted
+		reasons[key] = reason
+	}
+
+	return values, reasons
+}
+
+// classify combines the name-based allowlist/denylist decision, the
+// transform pipeline, and the value-level scanner: a detector hit forces
+// redaction even if the key was on the plaintext allowlist, and it's run
+// against the transformed value so e.g. redact_userinfo can strip
+// credentials that would otherwise trip a detector. A name-pattern match
+// forces redaction of the transformed value whatever transform ran. op
+// reports which Transform (if any) fired, for Explain.
+func (config *Config) classify(key, value string) (include, shouldRedact bool, reason, op, finalValue string) {
+	includeVar, shouldRedactByName := config.ShouldIncludeEnvVar(key, value)
+	if !includeVar {
+		return false, false, "", "", ""
+	}
+
+	transformed, matchedOp := config.transformedValue(key, value)
+
+	if d, hit := config.scanner().Scan(transformed); hit {
+		return true, true, fmt.Sprintf("value_pattern:%s", d.Name), matchedOp, transformed
+	}
+	if shouldRedactByName {
+		return true, true, "name_pattern", matchedOp, transformed
+	}
+	return true, false, "", matchedOp, transformed
+}
+
+// transforms lazily compiles config.Transforms, dropping any whose selector
+// fails to compile rather than failing the whole config.
+func (config *Config) transforms() []*Transform {
+	if config.transformsDone {
+		return config.Transforms
+	}
+	compiled := make([]*Transform, 0, len(config.Transforms))
+	for _, t := range config.Transforms {
+		if err := t.compile(); err != nil {
+			continue
+		}
+		compiled = append(compiled, t)
+	}
+	config.Transforms = compiled
+	config.transformsDone = true
+	return config.Transforms
+}
+
+// transformedValue applies the first matching Transform to value, returning
+// the transformed value and the Op that fired ("" if none matched or the
+// transform errored).
+func (config *Config) transformedValue(key, value string) (string, string) {
+	for _, t := range config.transforms() {
+		if !t.matches(key) {
+			continue
+		}
+		out, err := t.apply(key, value)
+		if err != nil {
+			// A misconfigured transform shouldn't take down the whole
+			// pipeline; skip it and fall through to later rules.
+			continue
+		}
+		return out, t.Op
+	}
+	return value, ""
+}
+
+// scanner lazily builds and caches this config's ValueScanner, falling back
+// to DefaultValueScanner when Scanners isn't set.
+func (config *Config) scanner() *ValueScanner {
+	if config.scannerCache != nil {
+		return config.scannerCache
+	}
+	if len(config.Scanners) == 0 {
+		config.scannerCache = DefaultValueScanner()
+		return config.scannerCache
+	}
+
+	compiled := make([]*Detector, 0, len(config.Scanners))
+	for _, d := range config.Scanners {
+		if err := d.compile(); err != nil {
+			continue
+		}
+		compiled = append(compiled, d)
+	}
+	config.scannerCache = &ValueScanner{Detectors: compiled}
+	return config.scannerCache
+}
+
+// redact resolves this config's ValueRedactor and applies it. The redactor
+// and (for AgeRedactor) the underlying identity are built once and cached.
+func (config *Config) redact(key, value string) (string, error) {
+	redactor, err := config.redactorFor()
+	if err != nil {
+		return "", err
+	}
+	return redactor.Redact(key, value)
+}
+
+func (config *Config) redactorFor() (ValueRedactor, error) {
+	if config.redactor != nil {
+		return config.redactor, nil
+	}
+
+	switch {
+	case config.EncryptSensitiveValues:
+		id, err := LoadOrCreateIdentity(config.KeyDir)
+		if err != nil {
+			return nil, err
+		}
+		config.identity = id
+
+		recipients := config.Recipients
+		if len(recipients) == 0 {
+			recipients = []string{id.Recipient().String()}
+		}
+		parsed, err := ParseRecipients(recipients)
+		if err != nil {
+			return nil, err
+		}
+		config.redactor = AgeRedactor{Recipients: parsed}
+	case config.HashSensitiveValues:
+		config.redactor = HashRedactor{}
+	default:
+		config.redactor = NoopRedactor{}
+	}
+	return config.redactor, nil
+}
+
+// DecryptValue reverses a value this config's AgeRedactor produced, using
+// the identity loaded from (or generated under) KeyDir. It's how a recorded
+// event stays forensically useful to its owner even after EncryptSensitiveValues
+// has redacted it.
+func (config *Config) DecryptValue(value string) (string, error) {
+	if config.identity == nil {
+		id, err := LoadOrCreateIdentity(config.KeyDir)
+		if err != nil {
+			return "", err
+		}
+		config.identity = id
+	}
+	return DecryptValue(value, config.identity)
+}
+
+// VarExplanation is one row of `totalrecall env --dry-run` output: a
+// variable's value before and after filtering, and which rule produced the
+// difference.
+type VarExplanation struct {
+	Key             string
+	RawValue        string
+	Included        bool
+	TransformOp     string
+	Redacted        bool
+	RedactionReason string
+	FinalValue      string
+}
+
+// Explain runs the same classification FilterEnvironmentWithReasons does,
+// but reports the full decision trail per variable instead of just the
+// admitted values, for `totalrecall env --dry-run`.
+func (config *Config) Explain(env map[string]string) []VarExplanation {
+	out := make([]VarExplanation, 0, len(env))
+	for key, value := range env {
+		include, shouldRedact, reason, op, finalValue := config.classify(key, value)
+		exp := VarExplanation{Key: key, RawValue: value, Included: include, TransformOp: op}
+		if !include {
+			out = append(out, exp)
+			continue
+		}
+
+		exp.Redacted = shouldRedact
+		exp.RedactionReason = reason
+		if !shouldRedact {
+			exp.FinalValue = finalValue
+			out = append(out, exp)
+			continue
+		}
+
+		redacted, err := config.redact(key, finalValue)
+		if err != nil {
+			exp.FinalValue = fmt.Sprintf("(redaction failed: %v)", err)
+		} else {
+			exp.FinalValue = redacted
+		}
+		out = append(out, exp)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package envfilter
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sync"
+
+	"filippo.io/age"
+)
+
+// sha256Pool reuses hash.Hash values across Redact calls instead of letting
+// sha256.Sum256 allocate a fresh one every time, which matters once
+// FilterEnvironment is hashing a few hundred variables per preexec hook.
+var sha256Pool = sync.Pool{
+	New: func() interface{} { return sha256.New() },
+}
+
+// pooledSHA256 is sha256.Sum256 backed by sha256Pool.
+func pooledSHA256(data []byte) [sha256.Size]byte {
+	h := sha256Pool.Get().(hash.Hash)
+	h.Reset()
+	h.Write(data)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	sha256Pool.Put(h)
+	return sum
+}
+
+// ValueRedactor turns a sensitive value into a form safe to record. Keeping
+// it an interface means every downstream indexer (the ES shipper, the
+// JetStream consumer) sees the redacted form uniformly, regardless of which
+// scheme produced it.
+type ValueRedactor interface {
+	Redact(key, value string) (string, error)
+}
+
+// HashRedactor is the original one-way h8_<hex> scheme: cheap, but the
+// value can never be recovered, even by its own owner.
+type HashRedactor struct{}
+
+func (HashRedactor) Redact(key, value string) (string, error) {
+	sum := pooledSHA256([]byte(value))
+	return fmt.Sprintf("h8_%x", sum[:4]), nil
+}
+
+// NoopRedactor passes values through unchanged. Not recommended, but kept
+// for configs that explicitly disable both hashing and encryption.
+type NoopRedactor struct{}
+
+func (NoopRedactor) Redact(key, value string) (string, error) { return value, nil }
+
+// AgeRedactor encrypts sensitive values to the configured recipients
+// instead of discarding them, so a recorded event stays forensically useful
+// to its owner via (*Config).DecryptValue.
+type AgeRedactor struct {
+	Recipients []age.Recipient
+}
+
+func (r AgeRedactor) Redact(key, value string) (string, error) {
+	return EncryptValue(value, r.Recipients)
+}
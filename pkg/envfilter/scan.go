@@ -0,0 +1,144 @@
+package envfilter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Detector is a single value-level secret pattern. Detectors run against
+// every value FilterEnvironment is about to emit in plaintext, independent
+// of whether the variable's *name* looked sensitive, so e.g.
+// MY_CONFIG=AKIA... still gets redacted.
+type Detector struct {
+	Name string `json:"name"`
+	// Pattern is a regexp the value must match. Empty means "any value" —
+	// useful paired with MinEntropy/MinLength for the generic detector.
+	Pattern string `json:"pattern,omitempty"`
+	// MinEntropy, if > 0, additionally requires the value's Shannon entropy
+	// (bits/char) to be at least this high before the detector fires.
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+	// MinLength, if > 0, requires the value be at least this many characters.
+	MinLength int `json:"min_length,omitempty"`
+	// RequireJWTHeader additionally requires Pattern's three dot-separated
+	// segments to be base64url with a first segment that decodes to JSON
+	// containing an "alg" key, to cut down on three-dot-segment false
+	// positives that aren't actually JWTs.
+	RequireJWTHeader bool `json:"require_jwt_header,omitempty"`
+	// Action describes what firing this detector does. "redact" (the
+	// default) forces the configured ValueRedactor regardless of the
+	// variable's allowlist/denylist name match.
+	Action string `json:"action,omitempty"`
+
+	re *regexp.Regexp
+}
+
+func (d *Detector) compile() error {
+	if d.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(d.Pattern)
+	if err != nil {
+		return fmt.Errorf("detector %q: %v", d.Name, err)
+	}
+	d.re = re
+	return nil
+}
+
+// Matches reports whether value trips this detector.
+func (d *Detector) Matches(value string) bool {
+	if d.MinLength > 0 && len(value) < d.MinLength {
+		return false
+	}
+	if d.re != nil && !d.re.MatchString(value) {
+		return false
+	}
+	if d.RequireJWTHeader && !hasDecodableJWTHeader(value) {
+		return false
+	}
+	if d.MinEntropy > 0 && shannonEntropy(value) < d.MinEntropy {
+		return false
+	}
+	return true
+}
+
+// ValueScanner runs a set of detectors against a value and reports the
+// first one that fires.
+type ValueScanner struct {
+	Detectors []*Detector
+}
+
+// Scan reports the first detector that fires against value, if any.
+func (s *ValueScanner) Scan(value string) (*Detector, bool) {
+	for _, d := range s.Detectors {
+		if d.Matches(value) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// DefaultValueScanner returns the built-in high-confidence detector set:
+// AWS access/secret keys, GitHub/Slack/Google API tokens, JWTs, PEM private
+// key blocks, and a generic high-entropy fallback.
+func DefaultValueScanner() *ValueScanner {
+	detectors := []*Detector{
+		{Name: "aws_access_key_id", Pattern: `^(AKIA|ASIA)[0-9A-Z]{16}$`},
+		{Name: "aws_secret_key", Pattern: `^[A-Za-z0-9/+=]{40}$`, MinEntropy: 4.5},
+		{Name: "github_token", Pattern: `^(ghp_|gho_|ghs_|github_pat_)[A-Za-z0-9_]+$`},
+		{Name: "slack_token", Pattern: `^xox[baprs]-[A-Za-z0-9-]+$`},
+		{Name: "google_api_key", Pattern: `^AIza[0-9A-Za-z\-_]{35}$`},
+		{Name: "jwt", Pattern: `^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+$`, RequireJWTHeader: true},
+		{Name: "private_key_block", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----`},
+		{Name: "generic_high_entropy", MinLength: 20, MinEntropy: 4.5},
+	}
+	for _, d := range detectors {
+		if err := d.compile(); err != nil {
+			// Built-in patterns must always compile; a failure here is a bug
+			// in this file, not bad user input.
+			panic(err)
+		}
+	}
+	return &ValueScanner{Detectors: detectors}
+}
+
+// hasDecodableJWTHeader reports whether value's first dot-separated segment
+// base64url-decodes to a JSON object containing an "alg" key, to cut down on
+// false positives from the three-dot-segment shape alone.
+func hasDecodableJWTHeader(value string) bool {
+	parts := strings.SplitN(value, ".", 3)
+	if len(parts) != 3 {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(header, &decoded); err != nil {
+		return false
+	}
+	_, ok := decoded["alg"]
+	return ok
+}
+
+// shannonEntropy returns s's Shannon entropy in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	n := float64(len(s))
+	var entropy float64
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
@@ -0,0 +1,142 @@
+package envfilter
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Transform declaratively rewrites a variable's value before it's emitted,
+// so e.g. a DATABASE_URL can have its credentials stripped before the value
+// scanner sees it. Transforms run in the order configured, between
+// allowlist admission and redaction; the first one whose selector matches
+// the variable's name wins. A variable whose name matches a sensitive
+// pattern is still redacted after its transform runs.
+type Transform struct {
+	// Name selects the variable by exact match. Mutually exclusive with Pattern.
+	Name string `json:"name,omitempty"`
+	// Pattern selects variables by a regex against the variable name.
+	Pattern string `json:"pattern,omitempty"`
+	// Op is the transform to apply: "strip_query", "redact_userinfo",
+	// "basename", "truncate:N", "hash_suffix:N", or
+	// `go_template:"{{ .Value | ... }}"`.
+	Op string `json:"op"`
+
+	re *regexp.Regexp
+}
+
+func (t *Transform) compile() error {
+	if t.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return fmt.Errorf("transform selector %q: %v", t.Pattern, err)
+	}
+	t.re = re
+	return nil
+}
+
+func (t *Transform) matches(key string) bool {
+	if t.Name != "" {
+		return key == t.Name
+	}
+	if t.re != nil {
+		return t.re.MatchString(key)
+	}
+	return false
+}
+
+func (t *Transform) apply(key, value string) (string, error) {
+	switch {
+	case t.Op == "strip_query":
+		return stripQuery(value)
+	case t.Op == "redact_userinfo":
+		return redactUserinfo(value)
+	case t.Op == "basename":
+		return path.Base(value), nil
+	case strings.HasPrefix(t.Op, "truncate:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(t.Op, "truncate:"))
+		if err != nil {
+			return "", fmt.Errorf("transform op %q: %v", t.Op, err)
+		}
+		return truncate(value, n), nil
+	case strings.HasPrefix(t.Op, "hash_suffix:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(t.Op, "hash_suffix:"))
+		if err != nil {
+			return "", fmt.Errorf("transform op %q: %v", t.Op, err)
+		}
+		return hashSuffix(value, n), nil
+	case strings.HasPrefix(t.Op, "go_template:"):
+		return renderTemplate(strings.TrimPrefix(t.Op, "go_template:"), key, value)
+	default:
+		return "", fmt.Errorf("unknown transform op %q", t.Op)
+	}
+}
+
+func stripQuery(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return value, nil // not a URL; leave it alone rather than error out
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+func redactUserinfo(value string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value, nil
+	}
+	u.User = nil
+	return u.String(), nil
+}
+
+func truncate(value string, n int) string {
+	if n < 0 || len(value) <= n {
+		return value
+	}
+	return value[:n]
+}
+
+// hashSuffix keeps the first n characters plaintext and hashes the rest, so
+// AWS_PROFILE=production-us-east-1-admin becomes e.g. production-us-<hash>.
+func hashSuffix(value string, n int) string {
+	if n < 0 || len(value) <= n {
+		return value
+	}
+	sum := pooledSHA256([]byte(value[n:]))
+	return fmt.Sprintf("%s-%x", value[:n], sum[:4])
+}
+
+func renderTemplate(src, key, value string) (string, error) {
+	tmpl, err := template.New("transform").Funcs(template.FuncMap{
+		"sha256": func(s string) string {
+			sum := pooledSHA256([]byte(s))
+			return fmt.Sprintf("%x", sum)
+		},
+		"basename": path.Base,
+		"dir":      path.Dir,
+		"urlparse": func(s string) *url.URL {
+			u, _ := url.Parse(s)
+			return u
+		},
+		"env": os.Getenv,
+	}).Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("parsing go_template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Key, Value string }{key, value}); err != nil {
+		return "", fmt.Errorf("executing go_template: %v", err)
+	}
+	return buf.String(), nil
+}
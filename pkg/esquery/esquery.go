@@ -0,0 +1,379 @@
+// Package esquery is a small internal query-builder for Elasticsearch's
+// Query DSL, in the spirit of the typed builders the olivere/elastic
+// client exposes: callers compose Query/Agg values instead of hand-rolling
+// map[string]interface{} blobs, and Search.Source produces the final
+// request body estransport.ProxiedESClient.SearchCommands (or any other
+// consumer that just wants a map[string]interface{}) can send as-is.
+package esquery
+
+// Query is anything that serializes to one Elasticsearch Query DSL clause.
+type Query interface {
+	Source() map[string]interface{}
+}
+
+// Agg is anything that serializes to one Elasticsearch aggregation,
+// optionally nesting sub-aggregations.
+type Agg interface {
+	Source() map[string]interface{}
+}
+
+// withSubAggs nests subs under "aggs" in m when non-empty, the shape every
+// Agg.Source below shares.
+func withSubAggs(m map[string]interface{}, subs map[string]Agg) map[string]interface{} {
+	if len(subs) == 0 {
+		return m
+	}
+	nested := make(map[string]interface{}, len(subs))
+	for name, agg := range subs {
+		nested[name] = agg.Source()
+	}
+	m["aggs"] = nested
+	return m
+}
+
+// TermQuery matches documents where Field is exactly Value - typically a
+// keyword (or keyword sub-field) for exact-match filtering.
+type TermQuery struct {
+	Field string
+	Value interface{}
+}
+
+func (q TermQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			q.Field: q.Value,
+		},
+	}
+}
+
+// PrefixQuery matches documents where Field starts with Value, used here
+// to restrict results to paths under a directory subtree.
+type PrefixQuery struct {
+	Field string
+	Value string
+}
+
+func (q PrefixQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"prefix": map[string]interface{}{
+			q.Field: q.Value,
+		},
+	}
+}
+
+// ExistsQuery matches documents that have a non-null value for Field.
+type ExistsQuery struct {
+	Field string
+}
+
+func (q ExistsQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"exists": map[string]interface{}{
+			"field": q.Field,
+		},
+	}
+}
+
+// MatchPhrasePrefixQuery matches documents whose Field starts with the
+// phrase Value, e.g. matching "cd " to find every cd invocation
+// regardless of its target.
+type MatchPhrasePrefixQuery struct {
+	Field string
+	Value string
+}
+
+func (q MatchPhrasePrefixQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"match_phrase_prefix": map[string]interface{}{
+			q.Field: q.Value,
+		},
+	}
+}
+
+// BoolQuery composes other queries with must/should/filter/must_not
+// clauses, mirroring Elasticsearch's own bool query semantics: must and
+// filter clauses are required (filter skips scoring), must_not clauses
+// are excluded, and should clauses are optional but require at least
+// MinimumShouldMatch of them when set.
+type BoolQuery struct {
+	Must               []Query
+	Should             []Query
+	Filter             []Query
+	MustNot            []Query
+	MinimumShouldMatch int
+}
+
+func (q BoolQuery) Source() map[string]interface{} {
+	b := map[string]interface{}{}
+	if len(q.Must) > 0 {
+		b["must"] = sources(q.Must)
+	}
+	if len(q.Should) > 0 {
+		b["should"] = sources(q.Should)
+		if q.MinimumShouldMatch > 0 {
+			b["minimum_should_match"] = q.MinimumShouldMatch
+		}
+	}
+	if len(q.Filter) > 0 {
+		b["filter"] = sources(q.Filter)
+	}
+	if len(q.MustNot) > 0 {
+		b["must_not"] = sources(q.MustNot)
+	}
+	return map[string]interface{}{"bool": b}
+}
+
+func sources(queries []Query) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(queries))
+	for i, q := range queries {
+		out[i] = q.Source()
+	}
+	return out
+}
+
+// RangeQuery matches documents where Field falls within [Gte, Lte];
+// either bound may be left empty to leave that side unconstrained. Used
+// for the dirjump picker's after:/before: date filters.
+type RangeQuery struct {
+	Field string
+	Gte   string
+	Lte   string
+}
+
+func (q RangeQuery) Source() map[string]interface{} {
+	bounds := map[string]interface{}{}
+	if q.Gte != "" {
+		bounds["gte"] = q.Gte
+	}
+	if q.Lte != "" {
+		bounds["lte"] = q.Lte
+	}
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			q.Field: bounds,
+		},
+	}
+}
+
+// WildcardQuery matches documents where Field (typically a keyword
+// field) matches Value's glob pattern ("*"/"?"). Used for the dirjump
+// picker's fuzzy directory-basename matching.
+type WildcardQuery struct {
+	Field string
+	Value string
+}
+
+func (q WildcardQuery) Source() map[string]interface{} {
+	return map[string]interface{}{
+		"wildcard": map[string]interface{}{
+			q.Field: q.Value,
+		},
+	}
+}
+
+// ScoreFunction is one function inside a function_score query's
+// "functions" list.
+type ScoreFunction interface {
+	Source() map[string]interface{}
+}
+
+// GaussDecayFunction scores documents by how far Field's value is from
+// Origin, falling off per a Gaussian curve: full weight within Offset of
+// Origin, decaying to Decay (typically 0.5) at Scale beyond that. Used
+// here to favor recently-touched directories without a hard cutoff.
+type GaussDecayFunction struct {
+	Field  string
+	Origin string
+	Scale  string
+	Offset string
+	Decay  float64
+	Weight float64
+}
+
+func (f GaussDecayFunction) Source() map[string]interface{} {
+	decayParams := map[string]interface{}{
+		"origin": f.Origin,
+		"scale":  f.Scale,
+	}
+	if f.Offset != "" {
+		decayParams["offset"] = f.Offset
+	}
+	if f.Decay > 0 {
+		decayParams["decay"] = f.Decay
+	}
+
+	m := map[string]interface{}{
+		"gauss": map[string]interface{}{
+			f.Field: decayParams,
+		},
+	}
+	if f.Weight > 0 {
+		m["weight"] = f.Weight
+	}
+	return m
+}
+
+// FunctionScoreQuery wraps Query, adjusting each matching document's
+// _score per Functions (combined according to ScoreMode, then applied to
+// the base query score according to BoostMode).
+type FunctionScoreQuery struct {
+	Query     Query
+	Functions []ScoreFunction
+	ScoreMode string // e.g. "multiply", "sum", "avg"; "" uses the ES default
+	BoostMode string // e.g. "replace", "multiply", "sum"; "" uses the ES default
+}
+
+func (q FunctionScoreQuery) Source() map[string]interface{} {
+	functions := make([]map[string]interface{}, len(q.Functions))
+	for i, fn := range q.Functions {
+		functions[i] = fn.Source()
+	}
+
+	fs := map[string]interface{}{
+		"functions": functions,
+	}
+	if q.Query != nil {
+		fs["query"] = q.Query.Source()
+	}
+	if q.ScoreMode != "" {
+		fs["score_mode"] = q.ScoreMode
+	}
+	if q.BoostMode != "" {
+		fs["boost_mode"] = q.BoostMode
+	}
+
+	return map[string]interface{}{"function_score": fs}
+}
+
+// TermsAgg buckets documents by Field's value (or, if Script is set, by
+// the value Script computes per document, e.g. extracting a cd target
+// from the command text). Size caps the number of buckets returned.
+type TermsAgg struct {
+	Field   string
+	Script  string
+	Size    int
+	SubAggs map[string]Agg
+}
+
+func (a TermsAgg) Source() map[string]interface{} {
+	terms := map[string]interface{}{}
+	if a.Script != "" {
+		terms["script"] = map[string]interface{}{
+			"source": a.Script,
+			"lang":   "painless",
+		}
+	} else {
+		terms["field"] = a.Field
+	}
+	if a.Size > 0 {
+		terms["size"] = a.Size
+	}
+
+	return withSubAggs(map[string]interface{}{"terms": terms}, a.SubAggs)
+}
+
+// ScriptedMaxAgg computes the max of Script's result across a bucket's
+// documents - used here to surface the function_score-adjusted _score of
+// a bucket's best-ranked document as that bucket's "recency" signal.
+type ScriptedMaxAgg struct {
+	Script  string
+	SubAggs map[string]Agg
+}
+
+func (a ScriptedMaxAgg) Source() map[string]interface{} {
+	m := map[string]interface{}{
+		"max": map[string]interface{}{
+			"script": map[string]interface{}{
+				"source": a.Script,
+			},
+		},
+	}
+	return withSubAggs(m, a.SubAggs)
+}
+
+// BucketScriptAgg computes Script against the named sibling aggregations
+// in BucketsPath, producing one new per-bucket metric - used here to
+// combine a bucket's doc_count (frequency) and max _score (recency) into
+// one weighted ranking value.
+type BucketScriptAgg struct {
+	BucketsPath map[string]string
+	Script      string
+	Params      map[string]interface{}
+}
+
+func (a BucketScriptAgg) Source() map[string]interface{} {
+	script := map[string]interface{}{"source": a.Script}
+	if len(a.Params) > 0 {
+		script["params"] = a.Params
+	}
+
+	return map[string]interface{}{
+		"bucket_script": map[string]interface{}{
+			"buckets_path": a.BucketsPath,
+			"script":       script,
+		},
+	}
+}
+
+// SortField is one entry in a BucketSortAgg's (or a Search's) sort list.
+type SortField struct {
+	Field string
+	Order string // "asc" or "desc"
+}
+
+// BucketSortAgg reorders (and optionally truncates to Size) a parent
+// terms aggregation's buckets by a sibling metric, the server-side
+// equivalent of sorting and top-N'ing dirScores in Go.
+type BucketSortAgg struct {
+	Sort []SortField
+	Size int
+}
+
+func (a BucketSortAgg) Source() map[string]interface{} {
+	sort := make([]map[string]interface{}, len(a.Sort))
+	for i, s := range a.Sort {
+		sort[i] = map[string]interface{}{
+			s.Field: map[string]interface{}{"order": s.Order},
+		}
+	}
+
+	bs := map[string]interface{}{"sort": sort}
+	if a.Size > 0 {
+		bs["size"] = a.Size
+	}
+	return map[string]interface{}{"bucket_sort": bs}
+}
+
+// Search is a complete search request body: Source produces the
+// map[string]interface{} estransport.ProxiedESClient.SearchCommands (and
+// any other raw-map consumer) sends as-is.
+type Search struct {
+	Size           int
+	Query          Query
+	Aggs           map[string]Agg
+	TrackTotalHits bool
+	SourceFields   []string // _source filter; nil means "all fields"
+}
+
+func (s Search) Source() map[string]interface{} {
+	body := map[string]interface{}{
+		"size": s.Size,
+	}
+	if s.Query != nil {
+		body["query"] = s.Query.Source()
+	}
+	if len(s.Aggs) > 0 {
+		aggs := make(map[string]interface{}, len(s.Aggs))
+		for name, agg := range s.Aggs {
+			aggs[name] = agg.Source()
+		}
+		body["aggs"] = aggs
+	}
+	if s.TrackTotalHits {
+		body["track_total_hits"] = true
+	}
+	if s.SourceFields != nil {
+		body["_source"] = s.SourceFields
+	}
+	return body
+}
@@ -0,0 +1,57 @@
+package estransport
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// IndexBackend is the storage-agnostic interface consumers (dirjump, the
+// shell hook, etc.) program against, so they don't need to care whether
+// command history lives in a remote Elasticsearch cluster or an embedded
+// local store - the same split gitea's issue indexer draws between its
+// Bleve and Elasticsearch backends.
+type IndexBackend interface {
+	// Index stores one command event.
+	Index(ctx context.Context, cmd Command) error
+	// Search runs query - an Elasticsearch Query DSL request body for the
+	// ES backend, or an equivalent for any other - and returns matching
+	// documents.
+	Search(ctx context.Context, query map[string]interface{}) (*SearchResponse, error)
+	// Aggregate runs query for its aggregations only, returning them as
+	// raw JSON shaped the way the query asked (see esquery for the query
+	// side of that contract) for the caller to unmarshal into its own
+	// aggregation response type.
+	Aggregate(ctx context.Context, query map[string]interface{}) (json.RawMessage, error)
+	// Ping reports whether the backend is reachable and healthy.
+	Ping(ctx context.Context) error
+	// Stats returns backend-specific operational counters for diagnostics.
+	Stats(ctx context.Context) (map[string]interface{}, error)
+}
+
+var _ IndexBackend = (*ProxiedESClient)(nil)
+
+// Index implements IndexBackend by delegating to IndexCommand.
+func (c *ProxiedESClient) Index(ctx context.Context, cmd Command) error {
+	return c.IndexCommand(ctx, cmd)
+}
+
+// Search implements IndexBackend by delegating to SearchCommands.
+func (c *ProxiedESClient) Search(ctx context.Context, query map[string]interface{}) (*SearchResponse, error) {
+	return c.SearchCommands(ctx, query)
+}
+
+// Aggregate implements IndexBackend by running query through
+// SearchCommands and returning just its Aggregations.
+func (c *ProxiedESClient) Aggregate(ctx context.Context, query map[string]interface{}) (json.RawMessage, error) {
+	resp, err := c.SearchCommands(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Aggregations, nil
+}
+
+// Stats implements IndexBackend by delegating to GetIndexStats for the
+// totalrecall index.
+func (c *ProxiedESClient) Stats(ctx context.Context) (map[string]interface{}, error) {
+	return c.GetIndexStats(ctx, "totalrecall")
+}
@@ -0,0 +1,424 @@
+package estransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+
+	"totalrecall/pkg/spool"
+)
+
+// BulkItem is one document queued for indexing: Index defaults to
+// "totalrecall" in NewBulkIndexer's callers' usual case, but is carried
+// per-item so a single indexer can feed more than one index.
+type BulkItem struct {
+	Index string          `json:"index"`
+	Body  json.RawMessage `json:"body"`
+}
+
+// BulkIndexerConfig tunes BulkIndexer's batching, concurrency, and retry
+// behavior. Zero values are replaced with DefaultBulkIndexerConfig's
+// defaults by NewBulkIndexer.
+type BulkIndexerConfig struct {
+	// FlushBytes is the accumulated item size (NDJSON-encoded) that
+	// triggers an early flush, so one slow trickle of large commands
+	// doesn't wait out a full FlushInterval.
+	FlushBytes int
+	// FlushInterval is the longest a worker lets items sit queued before
+	// flushing, regardless of size.
+	FlushInterval time.Duration
+	// NumWorkers is how many goroutines concurrently flush batches.
+	NumWorkers int
+	// MaxRetries bounds the exponential backoff retries a worker gives a
+	// batch that fails with a retryable (429/503) response before giving
+	// up on it and reporting OnError for each item.
+	MaxRetries int
+	// InitialBackoff is the sleep before a batch's first retry; it doubles
+	// on each subsequent retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the exponential backoff between retries.
+	MaxBackoff time.Duration
+	// OnError, if set, is called once per item that a batch ultimately
+	// failed to index (after exhausting MaxRetries, or because ES reported
+	// a per-item error in an otherwise-successful bulk response).
+	OnError func(BulkItem, error)
+	// OnFlushEnd, if set, is called after every flush attempt, successful
+	// or not, so a caller can log or export BulkIndexerStats.
+	OnFlushEnd func(BulkIndexerStats)
+}
+
+// DefaultBulkIndexerConfig returns the batching and retry defaults
+// NewBulkIndexer fills zero fields in from.
+func DefaultBulkIndexerConfig() BulkIndexerConfig {
+	return BulkIndexerConfig{
+		FlushBytes:     1 << 20, // 1MB
+		FlushInterval:  5 * time.Second,
+		NumWorkers:     2,
+		MaxRetries:     5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+	}
+}
+
+// BulkIndexerStats summarizes one flush: Added isn't included since it's
+// cumulative across the indexer's lifetime rather than per-flush - see
+// BulkIndexer.Stats for that.
+type BulkIndexerStats struct {
+	Flushed int
+	Failed  int
+}
+
+// spooledItem pairs a BulkItem with the spool file it was durably written
+// to, so a worker can delete that file once (and only once) the item is
+// confirmed indexed.
+type spooledItem struct {
+	path string
+	item BulkItem
+}
+
+// BulkIndexer batches BulkItems and flushes them to Elasticsearch's _bulk
+// API from NumWorkers goroutines, modeled on the bulk-processor pattern
+// other ES clients expose: a bounded queue absorbs bursts from callers like
+// the shell hook without blocking them on network round-trips, each item is
+// durably spooled to disk (pkg/spool) before Add returns so a crash between
+// enqueue and flush doesn't lose it, and failed flushes of a retryable
+// (429/503) response are retried with exponential backoff before giving up
+// on that batch.
+type BulkIndexer struct {
+	client *ProxiedESClient
+	cfg    BulkIndexerConfig
+	spool  *spool.Spool
+
+	queue chan spooledItem
+	wg    sync.WaitGroup
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	added, flushed, failed int64
+}
+
+// NewBulkIndexer starts a BulkIndexer backed by c, replaying any items left
+// in the spool by a previous, crashed instance before accepting new ones.
+func (c *ProxiedESClient) NewBulkIndexer(cfg BulkIndexerConfig) (*BulkIndexer, error) {
+	def := DefaultBulkIndexerConfig()
+	if cfg.FlushBytes <= 0 {
+		cfg.FlushBytes = def.FlushBytes
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = def.FlushInterval
+	}
+	if cfg.NumWorkers <= 0 {
+		cfg.NumWorkers = def.NumWorkers
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = def.MaxRetries
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = def.InitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+
+	s, err := spool.Open(bulkIndexerSpoolDir(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening bulk indexer spool: %v", err)
+	}
+
+	bi := &BulkIndexer{
+		client: c,
+		cfg:    cfg,
+		spool:  s,
+		queue:  make(chan spooledItem, cfg.NumWorkers*4),
+		closed: make(chan struct{}),
+	}
+
+	for i := 0; i < cfg.NumWorkers; i++ {
+		bi.wg.Add(1)
+		go bi.worker()
+	}
+
+	if err := bi.replaySpool(); err != nil {
+		bi.Close(context.Background())
+		return nil, fmt.Errorf("replaying bulk indexer spool: %v", err)
+	}
+
+	return bi, nil
+}
+
+// bulkIndexerSpoolDir is a subdirectory of the shared spool root, so this
+// indexer's spool never collides with other spool users (see pkg/spool and
+// its other callers).
+func bulkIndexerSpoolDir() string {
+	return spool.Root() + "/bulk-indexer"
+}
+
+// BulkIndexerSpoolDir exposes bulkIndexerSpoolDir to callers that want to
+// queue BulkItems into this same spool without holding a live BulkIndexer -
+// e.g. tools/precmd-hook's --spool mode, which queues fast from an
+// interactive shell hook and leaves flushing to a separate --flush-now or
+// --daemon invocation that opens the real indexer.
+func BulkIndexerSpoolDir() string {
+	return bulkIndexerSpoolDir()
+}
+
+// replaySpool re-enqueues every item left over from a previous instance
+// that crashed (or was killed) before flushing them, so history is never
+// silently dropped.
+func (bi *BulkIndexer) replaySpool() error {
+	pending, err := bi.spool.Pending()
+	if err != nil {
+		return err
+	}
+	for _, path := range pending {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if err := bi.spool.Delete(path); err != nil {
+				return err
+			}
+			continue
+		}
+		var item BulkItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			if err := bi.spool.Delete(path); err != nil {
+				return err
+			}
+			continue
+		}
+		atomic.AddInt64(&bi.added, 1)
+		bi.queue <- spooledItem{path: path, item: item}
+	}
+	return nil
+}
+
+// Add spools item durably and enqueues it for flushing, blocking if the
+// queue is full until ctx is done.
+func (bi *BulkIndexer) Add(ctx context.Context, item BulkItem) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("encoding bulk item: %v", err)
+	}
+	path, err := bi.spool.Write(data)
+	if err != nil {
+		return fmt.Errorf("spooling bulk item: %v", err)
+	}
+
+	select {
+	case bi.queue <- spooledItem{path: path, item: item}:
+		atomic.AddInt64(&bi.added, 1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-bi.closed:
+		return fmt.Errorf("bulk indexer closed")
+	}
+}
+
+// Close stops accepting new flushes, flushes everything still queued, and
+// waits for all workers to finish, or returns ctx.Err() if it doesn't
+// finish first.
+func (bi *BulkIndexer) Close(ctx context.Context) error {
+	bi.closeOnce.Do(func() {
+		close(bi.closed)
+		close(bi.queue)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bi.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the indexer's cumulative counters.
+func (bi *BulkIndexer) Stats() (added, flushed, failed int64) {
+	return atomic.LoadInt64(&bi.added), atomic.LoadInt64(&bi.flushed), atomic.LoadInt64(&bi.failed)
+}
+
+// worker drains bi.queue into batches bounded by FlushBytes/FlushInterval
+// and flushes each one, until the queue is closed and drained.
+func (bi *BulkIndexer) worker() {
+	defer bi.wg.Done()
+
+	ticker := time.NewTicker(bi.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []spooledItem
+	var batchBytes int
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		bi.flushBatch(batch)
+		batch = nil
+		batchBytes = 0
+	}
+
+	for {
+		select {
+		case si, ok := <-bi.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, si)
+			batchBytes += len(si.item.Body)
+			if batchBytes >= bi.cfg.FlushBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flushBatch sends batch as one _bulk request, retrying with exponential
+// backoff on a retryable (429/503) response. Once the request either
+// succeeds or exhausts MaxRetries, it deletes the spool file of each item
+// ES confirmed indexed and reports OnError for every other item, whose
+// spool file is left in place for a later replay.
+func (bi *BulkIndexer) flushBatch(batch []spooledItem) {
+	stats := BulkIndexerStats{}
+
+	results, err := bi.sendWithRetry(batch)
+	if err != nil {
+		stats.Failed = len(batch)
+		atomic.AddInt64(&bi.failed, int64(len(batch)))
+		for _, si := range batch {
+			bi.reportError(si, err)
+		}
+	} else {
+		for i, si := range batch {
+			if itemErr := results[i]; itemErr != nil {
+				stats.Failed++
+				atomic.AddInt64(&bi.failed, 1)
+				bi.reportError(si, itemErr)
+			} else {
+				stats.Flushed++
+				atomic.AddInt64(&bi.flushed, 1)
+				if err := bi.spool.Delete(si.path); err != nil {
+					bi.reportError(si, fmt.Errorf("removing flushed spool file: %v", err))
+				}
+			}
+		}
+	}
+
+	if bi.cfg.OnFlushEnd != nil {
+		bi.cfg.OnFlushEnd(stats)
+	}
+}
+
+func (bi *BulkIndexer) reportError(si spooledItem, err error) {
+	if bi.cfg.OnError != nil {
+		bi.cfg.OnError(si.item, err)
+	}
+}
+
+// sendWithRetry posts batch to _bulk, retrying the whole batch with
+// exponential backoff while the response (or the request itself) looks
+// retryable. On eventual success it returns one error per item, nil for
+// those ES reported as indexed.
+func (bi *BulkIndexer) sendWithRetry(batch []spooledItem) ([]error, error) {
+	var lastErr error
+	for attempt := 0; attempt <= bi.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(bi.backoff(attempt))
+		}
+
+		results, retryable, err := bi.send(batch)
+		if err == nil {
+			return results, nil
+		}
+		lastErr = err
+		if !retryable {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("bulk request failed after %d retries: %v", bi.cfg.MaxRetries, lastErr)
+}
+
+// backoff returns the exponential delay before retry attempt (1-based),
+// capped at MaxBackoff.
+func (bi *BulkIndexer) backoff(attempt int) time.Duration {
+	d := time.Duration(float64(bi.cfg.InitialBackoff) * math.Pow(2, float64(attempt-1)))
+	if d > bi.cfg.MaxBackoff {
+		d = bi.cfg.MaxBackoff
+	}
+	return d
+}
+
+// send issues one _bulk request for batch. retryable reports whether a
+// failure is worth retrying (429/503, or a transport-level error); results
+// holds one error per item when the request itself succeeded.
+func (bi *BulkIndexer) send(batch []spooledItem) (results []error, retryable bool, err error) {
+	var buf bytes.Buffer
+	for _, si := range batch {
+		index := si.item.Index
+		if index == "" {
+			index = "totalrecall"
+		}
+		fmt.Fprintf(&buf, `{"index":{"_index":%q}}`+"\n", index)
+		buf.Write(si.item.Body)
+		buf.WriteByte('\n')
+	}
+
+	req := esapi.BulkRequest{Body: &buf}
+	res, err := req.Do(context.Background(), bi.client.Client)
+	if err != nil {
+		return nil, true, fmt.Errorf("bulk request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 429 || res.StatusCode == 503 {
+		return nil, true, fmt.Errorf("bulk request returned %s", res.Status())
+	}
+	if res.IsError() {
+		return nil, false, fmt.Errorf("bulk request returned %s", res.Status())
+	}
+
+	var parsed struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error,omitempty"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, false, fmt.Errorf("decoding bulk response: %v", err)
+	}
+
+	results = make([]error, len(batch))
+	if parsed.Errors {
+		for i, item := range parsed.Items {
+			if i >= len(results) {
+				break
+			}
+			for _, action := range item {
+				if action.Error != nil {
+					results[i] = fmt.Errorf("%s: %s", action.Error.Type, action.Error.Reason)
+				}
+			}
+		}
+	}
+	return results, false, nil
+}
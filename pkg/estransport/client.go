@@ -39,6 +39,17 @@ func NewProxiedESClient(socketPath string) (*ProxiedESClient, error) {
 	}, nil
 }
 
+// Close releases the pooled connections backing this client's transport.
+// Safe to skip for a short-lived process; matters for a long-running one
+// like the shelper that creates a ProxiedESClient per completion session.
+// A no-op for a client built by NewESClientWithFallback's direct-connection
+// path, which doesn't go through UnixSocketTransport.
+func (c *ProxiedESClient) Close() {
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+	}
+}
+
 // Convenience method to test connectivity
 func (c *ProxiedESClient) Ping(ctx context.Context) error {
 	req := esapi.PingRequest{}
@@ -89,6 +100,33 @@ func (c *ProxiedESClient) SearchCommands(ctx context.Context, query map[string]i
 	return &searchResp, nil
 }
 
+// IndexCommand indexes a single command event into the totalrecall index
+// as given; it sets no timestamp of its own, so @timestamp is whatever the
+// caller filled in.
+func (c *ProxiedESClient) IndexCommand(ctx context.Context, cmd Command) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(cmd); err != nil {
+		return fmt.Errorf("failed to encode command: %v", err)
+	}
+
+	req := esapi.IndexRequest{
+		Index: "totalrecall",
+		Body:  &buf,
+	}
+
+	res, err := req.Do(ctx, c.Client)
+	if err != nil {
+		return fmt.Errorf("index request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("ES error indexing command: %s", res.Status())
+	}
+
+	return nil
+}
+
 // Get cluster info
 func (c *ProxiedESClient) GetClusterInfo(ctx context.Context) (map[string]interface{}, error) {
 	req := esapi.InfoRequest{}
@@ -144,13 +182,27 @@ type SearchResponse struct {
 			Relation string `json:"relation"`
 		} `json:"total"`
 		MaxScore float64 `json:"max_score"`
-		Hits     []struct {
-			Index  string  `json:"_index"`
-			ID     string  `json:"_id"`
-			Score  float64 `json:"_score"`
-			Source Command `json:"_source"`
-		} `json:"hits"`
+		Hits     []Hit   `json:"hits"`
 	} `json:"hits"`
+	// Aggregations holds the raw "aggregations" object, if the request's
+	// query included any - its shape depends entirely on what the caller
+	// asked for, so callers unmarshal it into their own aggregation
+	// response type (see esquery for the query side of that contract).
+	Aggregations json.RawMessage `json:"aggregations,omitempty"`
+	// ScrollID is set when the request that produced this response asked
+	// for a scroll context (see Scroll), and is empty otherwise.
+	ScrollID string `json:"_scroll_id,omitempty"`
+}
+
+// Hit is one matched document within SearchResponse.Hits.Hits. It's a
+// named type (rather than left anonymous, as SearchResponse's other nested
+// structs are) so other IndexBackend implementations - see backend.go -
+// can construct one directly instead of only ever receiving them from ES.
+type Hit struct {
+	Index  string  `json:"_index"`
+	ID     string  `json:"_id"`
+	Score  float64 `json:"_score"`
+	Source Command `json:"_source"`
 }
 
 type Command struct {
@@ -0,0 +1,91 @@
+package estransport
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// EndpointScheme is how an Endpoint should be dialed.
+type EndpointScheme int
+
+const (
+	// SchemeHTTP is a plain, unencrypted HTTP connection.
+	SchemeHTTP EndpointScheme = iota
+	// SchemeHTTPS is HTTPS with normal certificate verification.
+	SchemeHTTPS
+	// SchemeHTTPSInsecure is HTTPS with certificate verification disabled,
+	// for self-signed or otherwise unverifiable ES deployments.
+	SchemeHTTPSInsecure
+	// SchemeUnix dials a Unix domain socket and speaks HTTP over it, via
+	// UnixSocketTransport.
+	SchemeUnix
+)
+
+// Endpoint is one address in an ordered ES fallback chain, as parsed from a
+// single --es-style flag value by ParseEndpoint.
+type Endpoint struct {
+	Scheme EndpointScheme
+	// Addr is the address passed to the ES client, e.g. "http://host:9200".
+	// Unset when Scheme is SchemeUnix.
+	Addr string
+	// SocketPath is the Unix domain socket to dial. Only set when Scheme is
+	// SchemeUnix.
+	SocketPath string
+}
+
+// String renders the endpoint back into a form ParseEndpoint accepts, for
+// logging.
+func (e Endpoint) String() string {
+	if e.Scheme == SchemeUnix {
+		return "unix://" + e.SocketPath
+	}
+	return e.Addr
+}
+
+// ParseEndpoint parses a single endpoint string into an Endpoint. Accepted
+// forms:
+//
+//	"3030"                        -> http://127.0.0.1:3030
+//	"host:port"                   -> http://host:port
+//	"http://host:port"            -> as given
+//	"https://host:port"           -> as given, normal certificate verification
+//	"https+insecure://host:port"  -> https, skipping certificate verification
+//	"unix:///path/to/socket"      -> dial the socket, speak HTTP over it
+func ParseEndpoint(s string) (Endpoint, error) {
+	if s == "" {
+		return Endpoint{}, fmt.Errorf("parsing endpoint: empty string")
+	}
+
+	switch {
+	case strings.HasPrefix(s, "unix://"):
+		path := strings.TrimPrefix(s, "unix://")
+		if path == "" {
+			return Endpoint{}, fmt.Errorf("parsing endpoint %q: missing socket path after unix://", s)
+		}
+		return Endpoint{Scheme: SchemeUnix, SocketPath: path}, nil
+
+	case strings.HasPrefix(s, "https+insecure://"):
+		return Endpoint{
+			Scheme: SchemeHTTPSInsecure,
+			Addr:   "https://" + strings.TrimPrefix(s, "https+insecure://"),
+		}, nil
+
+	case strings.HasPrefix(s, "http://"):
+		return Endpoint{Scheme: SchemeHTTP, Addr: s}, nil
+
+	case strings.HasPrefix(s, "https://"):
+		return Endpoint{Scheme: SchemeHTTPS, Addr: s}, nil
+	}
+
+	if _, err := strconv.Atoi(s); err == nil {
+		return Endpoint{Scheme: SchemeHTTP, Addr: fmt.Sprintf("http://127.0.0.1:%s", s)}, nil
+	}
+
+	if _, _, err := net.SplitHostPort(s); err == nil {
+		return Endpoint{Scheme: SchemeHTTP, Addr: "http://" + s}, nil
+	}
+
+	return Endpoint{}, fmt.Errorf("parsing endpoint %q: not a port, host:port, or scheme URL", s)
+}
@@ -2,109 +2,120 @@ package estransport
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
-	"os"
+	"strings"
 	"time"
-	
+
 	"github.com/elastic/go-elasticsearch/v8"
-	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
-// NewESClientWithFallback tries socket first, then direct connection
-func NewESClientWithFallback(socketPath string, directURLs []string, directTransport http.RoundTripper) (*ProxiedESClient, error) {
-	// First, try the socket connection
-	if _, err := os.Stat(socketPath); err == nil {
-		client, err := NewProxiedESClient(socketPath)
-		if err == nil {
-			// Test the connection
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			
-			if err := client.Ping(ctx); err == nil {
-				fmt.Printf("✅ Using proxy socket: %s\n", socketPath)
-				return client, nil
-			}
-			fmt.Printf("⚠️  Proxy socket not responding, falling back to direct connection\n")
+//go:generate mockgen -source=fallback.go -destination=mock_fallback.go -package=estransport
+
+// ESFactory abstracts constructing an ES client behind the endpoint
+// fallback chain, so callers that only need to index or query don't have to
+// be tested against a real socket or ES server.
+type ESFactory interface {
+	NewESClient(endpoints []Endpoint) (*ProxiedESClient, error)
+}
+
+// defaultESFactory is the ESFactory backed by NewESClientWithFallback.
+type defaultESFactory struct{}
+
+func (defaultESFactory) NewESClient(endpoints []Endpoint) (*ProxiedESClient, error) {
+	return NewESClientWithFallback(endpoints)
+}
+
+// DefaultESFactory is the ESFactory every caller should use outside of tests.
+var DefaultESFactory ESFactory = defaultESFactory{}
+
+// NewESClientWithFallback tries each endpoint in order - typically a Unix
+// socket proxy first, then one or more direct ES addresses - and returns the
+// client for the first one that responds to a ping.
+func NewESClientWithFallback(endpoints []Endpoint) (*ProxiedESClient, error) {
+	var failures []string
+	for _, ep := range endpoints {
+		client, err := dialEndpoint(ep)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", ep, err))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = client.Ping(ctx)
+		cancel()
+		if err != nil {
+			client.Close()
+			failures = append(failures, fmt.Sprintf("%s: %v", ep, err))
+			continue
 		}
+
+		fmt.Printf("✅ Using ES endpoint: %s\n", ep)
+		return client, nil
 	}
 
-	// Fallback to direct connection
-	fmt.Printf("🔄 Using direct ES connection: %v\n", directURLs)
-	
-	cfg := elasticsearch.Config{
-		Addresses: directURLs,
+	return nil, fmt.Errorf("no ES endpoint reachable, tried:\n%s", strings.Join(failures, "\n"))
+}
+
+// dialEndpoint builds a ProxiedESClient for a single endpoint without
+// testing it, picking the pooled UnixSocketTransport for a unix:// endpoint
+// and a plain or TLS-skip-verify http.Transport otherwise.
+func dialEndpoint(ep Endpoint) (*ProxiedESClient, error) {
+	if ep.Scheme == SchemeUnix {
+		return NewProxiedESClient(ep.SocketPath)
+	}
+
+	var transport http.RoundTripper
+	if ep.Scheme == SchemeHTTPSInsecure {
+		transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	}
-	
-	if directTransport != nil {
-		cfg.Transport = directTransport
+
+	cfg := elasticsearch.Config{Addresses: []string{ep.Addr}}
+	if transport != nil {
+		cfg.Transport = transport
 	}
 
-	esClient, err := elasticsearch.NewClient(cfg)
+	client, err := elasticsearch.NewClient(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create direct ES client: %v", err)
+		return nil, fmt.Errorf("creating ES client for %s: %v", ep.Addr, err)
 	}
 
-	return &ProxiedESClient{
-		Client:     esClient,
-		socketPath: "(direct connection)",
-	}, nil
+	return &ProxiedESClient{Client: client, socketPath: ep.Addr}, nil
 }
 
-// TestConnectivity tests both socket and direct connection
-func TestConnectivity(socketPath string, directURLs []string) {
+// TestConnectivity tries every endpoint in order and reports whether each is
+// reachable, without returning a client - for a CLI "-test" flag.
+func TestConnectivity(endpoints []Endpoint) {
 	fmt.Println("🔍 Testing Elasticsearch connectivity...")
-	
-	// Test socket connection
-	if _, err := os.Stat(socketPath); err == nil {
-		client, err := NewProxiedESClient(socketPath)
-		if err == nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-			defer cancel()
-			
-			if err := client.Ping(ctx); err == nil {
-				fmt.Printf("✅ Socket proxy working: %s\n", socketPath)
-				
-				// Get some info
-				if info, err := client.GetClusterInfo(ctx); err == nil {
-					if name, ok := info["cluster_name"]; ok {
-						fmt.Printf("   Cluster: %v\n", name)
-					}
-					if version, ok := info["version"].(map[string]interface{}); ok {
-						if num, ok := version["number"]; ok {
-							fmt.Printf("   Version: %v\n", num)
-						}
-					}
-				}
-			} else {
-				fmt.Printf("❌ Socket proxy not responding: %v\n", err)
-			}
-		} else {
-			fmt.Printf("❌ Failed to create socket client: %v\n", err)
+
+	for _, ep := range endpoints {
+		client, err := dialEndpoint(ep)
+		if err != nil {
+			fmt.Printf("❌ %s: failed to create client: %v\n", ep, err)
+			continue
 		}
-	} else {
-		fmt.Printf("❌ Socket not found: %s\n", socketPath)
-	}
-	
-	// Test direct connection (if provided)
-	if len(directURLs) > 0 {
-		fmt.Printf("🔄 Testing direct connection: %v\n", directURLs)
-		cfg := elasticsearch.Config{
-			Addresses: directURLs,
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		if err := client.Ping(ctx); err != nil {
+			fmt.Printf("❌ %s: not responding: %v\n", ep, err)
+			cancel()
+			client.Close()
+			continue
 		}
-		
-		if client, err := elasticsearch.NewClient(cfg); err == nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-			defer cancel()
-			
-			req := esapi.PingRequest{}
-			if res, err := req.Do(ctx, client); err == nil && !res.IsError() {
-				fmt.Printf("✅ Direct connection working\n")
-			} else {
-				fmt.Printf("❌ Direct connection failed: %v\n", err)
+
+		fmt.Printf("✅ %s: working\n", ep)
+		if info, err := client.GetClusterInfo(ctx); err == nil {
+			if name, ok := info["cluster_name"]; ok {
+				fmt.Printf("   Cluster: %v\n", name)
+			}
+			if version, ok := info["version"].(map[string]interface{}); ok {
+				if num, ok := version["number"]; ok {
+					fmt.Printf("   Version: %v\n", num)
+				}
 			}
-		} else {
-			fmt.Printf("❌ Failed to create direct client: %v\n", err)
 		}
+		cancel()
+		client.Close()
 	}
 }
@@ -0,0 +1,53 @@
+package estransport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// TestNewESClientWithFallbackSocketMissing covers the socket-missing
+// fallback scenario: a unix:// endpoint whose socket doesn't exist must
+// fail its ping and be skipped, falling through to the next reachable
+// endpoint rather than returning an error outright.
+func TestNewESClientWithFallbackSocketMissing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The go-elasticsearch client refuses a ping response that doesn't
+		// self-identify as Elasticsearch via this header.
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	missingSocket := filepath.Join(t.TempDir(), "does-not-exist.sock")
+	endpoints := []Endpoint{
+		{Scheme: SchemeUnix, SocketPath: missingSocket},
+		{Scheme: SchemeHTTP, Addr: srv.URL},
+	}
+
+	client, err := NewESClientWithFallback(endpoints)
+	if err != nil {
+		t.Fatalf("NewESClientWithFallback: %v", err)
+	}
+	defer client.Close()
+
+	if client.socketPath != srv.URL {
+		t.Errorf("got client for %q, want fallback to %q", client.socketPath, srv.URL)
+	}
+}
+
+// TestNewESClientWithFallbackAllUnreachable confirms that when every
+// endpoint is unreachable, the fallback chain reports failure rather than
+// hanging or silently returning a broken client.
+func TestNewESClientWithFallbackAllUnreachable(t *testing.T) {
+	missingSocket := filepath.Join(t.TempDir(), "does-not-exist.sock")
+	endpoints := []Endpoint{
+		{Scheme: SchemeUnix, SocketPath: missingSocket},
+	}
+
+	_, err := NewESClientWithFallback(endpoints)
+	if err == nil {
+		t.Fatal("expected an error when no endpoint is reachable, got none")
+	}
+}
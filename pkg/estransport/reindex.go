@@ -0,0 +1,161 @@
+package estransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// taskPollInterval is how often Reindex checks whether the ES-side reindex
+// task it kicked off has finished.
+const taskPollInterval = 2 * time.Second
+
+// Reindex creates dstIndex with mapping (adapted for the cluster's major
+// version, see adaptMapping), starts an ES _reindex from srcIndex into it,
+// and polls the resulting task until ES reports it complete. Useful when a
+// mapping evolves - e.g. adding ip_address or changing an analyzer - in a
+// way that can't be applied to an existing index in place.
+func (c *ProxiedESClient) Reindex(ctx context.Context, srcIndex, dstIndex string, mapping map[string]interface{}) error {
+	major, err := c.majorVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("detecting ES version: %v", err)
+	}
+
+	createBody, err := json.Marshal(map[string]interface{}{"mappings": adaptMapping(mapping, major)})
+	if err != nil {
+		return fmt.Errorf("encoding mapping for %s: %v", dstIndex, err)
+	}
+
+	createReq := esapi.IndicesCreateRequest{Index: dstIndex, Body: bytes.NewReader(createBody)}
+	res, err := createReq.Do(ctx, c.Client)
+	if err != nil {
+		return fmt.Errorf("creating index %s: %v", dstIndex, err)
+	}
+	res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("creating index %s: %s", dstIndex, res.Status())
+	}
+
+	reindexBody, err := json.Marshal(map[string]interface{}{
+		"source": map[string]interface{}{"index": srcIndex},
+		"dest":   map[string]interface{}{"index": dstIndex},
+	})
+	if err != nil {
+		return fmt.Errorf("encoding reindex request: %v", err)
+	}
+
+	waitForCompletion := false
+	reindexReq := esapi.ReindexRequest{Body: bytes.NewReader(reindexBody), WaitForCompletion: &waitForCompletion}
+	res, err = reindexReq.Do(ctx, c.Client)
+	if err != nil {
+		return fmt.Errorf("starting reindex %s -> %s: %v", srcIndex, dstIndex, err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("starting reindex %s -> %s: %s", srcIndex, dstIndex, res.Status())
+	}
+
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		return fmt.Errorf("decoding reindex task response: %v", err)
+	}
+
+	return c.pollTask(ctx, started.Task)
+}
+
+// pollTask blocks until taskID's _tasks entry reports completed, returning
+// whatever error ES attached to it (or reported as a per-document failure).
+func (c *ProxiedESClient) pollTask(ctx context.Context, taskID string) error {
+	for {
+		req := esapi.TasksGetRequest{TaskID: taskID}
+		res, err := req.Do(ctx, c.Client)
+		if err != nil {
+			return fmt.Errorf("polling task %s: %v", taskID, err)
+		}
+
+		var status struct {
+			Completed bool `json:"completed"`
+			Error     *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error,omitempty"`
+			Response struct {
+				Failures []interface{} `json:"failures"`
+			} `json:"response"`
+		}
+		decodeErr := json.NewDecoder(res.Body).Decode(&status)
+		res.Body.Close()
+		if decodeErr != nil {
+			return fmt.Errorf("decoding task %s status: %v", taskID, decodeErr)
+		}
+
+		if status.Completed {
+			if status.Error != nil {
+				return fmt.Errorf("task %s failed: %s: %s", taskID, status.Error.Type, status.Error.Reason)
+			}
+			if len(status.Response.Failures) > 0 {
+				return fmt.Errorf("task %s completed with %d document failures", taskID, len(status.Response.Failures))
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+// majorVersion parses the leading integer out of GetClusterInfo's
+// version.number (e.g. 8 from "8.11.3"), so adaptMapping can branch on it.
+func (c *ProxiedESClient) majorVersion(ctx context.Context) (int, error) {
+	info, err := c.GetClusterInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version, _ := info["version"].(map[string]interface{})
+	number, _ := version["number"].(string)
+	if number == "" {
+		return 0, fmt.Errorf("cluster info response had no version.number")
+	}
+	n, err := strconv.Atoi(strings.SplitN(number, ".", 2)[0])
+	if err != nil {
+		return 0, fmt.Errorf("parsing major version from %q: %v", number, err)
+	}
+	return n, nil
+}
+
+// adaptMapping adjusts mapping for the destination cluster's major version.
+// 8.x rejects the "boost" mapping parameter outright (7.x only deprecates
+// it), so it's stripped for 8.x destinations rather than letting an
+// otherwise-unrelated mapping change fail index creation entirely.
+func adaptMapping(mapping map[string]interface{}, majorVersion int) map[string]interface{} {
+	if majorVersion < 8 {
+		return mapping
+	}
+	return stripBoost(mapping)
+}
+
+func stripBoost(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k == "boost" {
+			continue
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			out[k] = stripBoost(nested)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,130 @@
+package estransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// scrollKeepAlive is how long each scroll context stays valid between
+// ScrollCursor.Next calls - long enough for a slow NDJSON consumer (a file
+// on a loaded disk, a pipe into gzip) not to race ES's own cleanup.
+const scrollKeepAlive = 2 * time.Minute
+
+// ScrollCursor streams every hit matching a query out of Elasticsearch a
+// page at a time via the Scroll API, so a full-index export never asks ES
+// to materialize more than one page of results at once.
+type ScrollCursor struct {
+	client   *ProxiedESClient
+	scrollID string
+	pending  []Hit
+	done     bool
+}
+
+// Scroll opens a ScrollCursor over query, fetching pageSize hits per page.
+// Close must be called once the caller is done draining it, to release the
+// scroll context on the ES side.
+func (c *ProxiedESClient) Scroll(ctx context.Context, query map[string]interface{}, pageSize int) (*ScrollCursor, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, fmt.Errorf("encoding scroll query: %v", err)
+	}
+
+	size := pageSize
+	req := esapi.SearchRequest{
+		Index:  []string{"totalrecall*"},
+		Body:   &buf,
+		Scroll: scrollKeepAlive,
+		Size:   &size,
+	}
+
+	res, err := req.Do(ctx, c.Client)
+	if err != nil {
+		return nil, fmt.Errorf("opening scroll: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("opening scroll: %s", res.Status())
+	}
+
+	var resp SearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding scroll response: %v", err)
+	}
+
+	return &ScrollCursor{
+		client:   c,
+		scrollID: resp.ScrollID,
+		pending:  resp.Hits.Hits,
+		done:     len(resp.Hits.Hits) == 0,
+	}, nil
+}
+
+// Next returns the cursor's next page of hits, or a nil, nil-error slice
+// once the scroll is exhausted.
+func (cur *ScrollCursor) Next(ctx context.Context) ([]Hit, error) {
+	if cur.done {
+		return nil, nil
+	}
+	if cur.pending != nil {
+		hits := cur.pending
+		cur.pending = nil
+		return hits, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"scroll":    scrollKeepAlive.String(),
+		"scroll_id": cur.scrollID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding scroll continuation: %v", err)
+	}
+
+	req := esapi.ScrollRequest{Body: bytes.NewReader(body)}
+	res, err := req.Do(ctx, cur.client.Client)
+	if err != nil {
+		return nil, fmt.Errorf("continuing scroll: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("continuing scroll: %s", res.Status())
+	}
+
+	var resp SearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decoding scroll continuation: %v", err)
+	}
+
+	cur.scrollID = resp.ScrollID
+	if len(resp.Hits.Hits) == 0 {
+		cur.done = true
+		return nil, nil
+	}
+	return resp.Hits.Hits, nil
+}
+
+// Close releases the scroll context on the ES side. Safe to call on a
+// cursor that never successfully opened a scroll.
+func (cur *ScrollCursor) Close(ctx context.Context) error {
+	if cur.scrollID == "" {
+		return nil
+	}
+
+	req := esapi.ClearScrollRequest{ScrollID: []string{cur.scrollID}}
+	res, err := req.Do(ctx, cur.client.Client)
+	if err != nil {
+		return fmt.Errorf("clearing scroll: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("clearing scroll: %s", res.Status())
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package estransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FailureClass categorizes why dialing or pinging an endpoint failed, so
+// Supervised can back off differently for a broken connection than for a
+// server that's merely erroring or slow.
+type FailureClass int
+
+const (
+	// FailureConnection means the endpoint couldn't be reached at all (dial
+	// or TLS handshake failure, connection refused) - the strongest signal
+	// the endpoint is actually down.
+	FailureConnection FailureClass = iota
+	// FailureServer means the endpoint was reached but responded with an
+	// error status.
+	FailureServer
+	// FailureTimeout means the request didn't complete within its deadline.
+	FailureTimeout
+)
+
+// classifyFailure inspects an error returned by ESFactory.NewESClient to
+// decide which FailureClass it represents. ESFactory surfaces failures as
+// plain wrapped errors rather than a structured type, so this sniffs the
+// error text for the cases client.go's Ping and dialEndpoint produce.
+func classifyFailure(err error) FailureClass {
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "deadline exceeded") || strings.Contains(err.Error(), "i/o timeout") {
+		return FailureTimeout
+	}
+	if strings.Contains(err.Error(), "ping returned error") {
+		return FailureServer
+	}
+	return FailureConnection
+}
+
+// SupervisedConfig tunes Supervised's per-endpoint circuit breaker.
+type SupervisedConfig struct {
+	// FailureThreshold is how many consecutive failures trip an endpoint's
+	// circuit open. A run of FailureServer failures is given twice this
+	// many chances before tripping, since a server that's still answering
+	// (just erroring) is more likely to be transient than a dead socket.
+	FailureThreshold int
+	// FailureBackoff is the initial sleep before retrying a tripped
+	// endpoint; it doubles with every further failure, up to BackoffMax.
+	FailureBackoff time.Duration
+	// BackoffMax bounds the exponential backoff.
+	BackoffMax time.Duration
+	// ProbeInterval is how often a background probe re-checks a tripped
+	// endpoint so Supervised returns to it as soon as it recovers, instead
+	// of waiting for the next real call after the backoff expires.
+	ProbeInterval time.Duration
+}
+
+// DefaultSupervisedConfig returns conservative circuit breaker defaults.
+func DefaultSupervisedConfig() SupervisedConfig {
+	return SupervisedConfig{
+		FailureThreshold: 3,
+		FailureBackoff:   1 * time.Second,
+		BackoffMax:       30 * time.Second,
+		ProbeInterval:    5 * time.Second,
+	}
+}
+
+// endpointState is Supervised's per-endpoint circuit breaker bookkeeping.
+type endpointState struct {
+	mu               sync.Mutex
+	consecutiveFails int
+	openUntil        time.Time
+	probing          bool
+}
+
+// Supervised wraps an ordered Endpoint chain with a per-endpoint circuit
+// breaker on top of an ESFactory, so a process issuing more than one ES call
+// per invocation (EnhancedShelper's history and suggestion lookups, a spool
+// flusher's repeated bulk posts) stops paying the dial cost of a freshly
+// tripped endpoint on every call. Once an endpoint trips, a background probe
+// keeps checking it so Supervised returns to the fast path automatically as
+// soon as it's healthy again, rather than a fixed "fall back forever this
+// process" decision.
+type Supervised struct {
+	Endpoints []Endpoint
+	// Factory dials a single endpoint; defaults to DefaultESFactory.
+	Factory ESFactory
+	Config  SupervisedConfig
+
+	initOnce sync.Once
+	states   []*endpointState
+}
+
+func (s *Supervised) init() {
+	s.initOnce.Do(func() {
+		s.states = make([]*endpointState, len(s.Endpoints))
+		for i := range s.states {
+			s.states[i] = &endpointState{}
+		}
+		if s.Config == (SupervisedConfig{}) {
+			s.Config = DefaultSupervisedConfig()
+		}
+	})
+}
+
+func (s *Supervised) factory() ESFactory {
+	if s.Factory != nil {
+		return s.Factory
+	}
+	return DefaultESFactory
+}
+
+// Client returns a connected ProxiedESClient for the first endpoint whose
+// circuit isn't open, skipping tripped endpoints without paying their dial
+// cost, and records the outcome against that endpoint's circuit state.
+func (s *Supervised) Client() (*ProxiedESClient, error) {
+	s.init()
+
+	var failures []string
+	for i, ep := range s.Endpoints {
+		state := s.states[i]
+		if until, open := s.circuitOpen(state); open {
+			failures = append(failures, fmt.Sprintf("%s: circuit open until %s", ep, until.Format(time.RFC3339)))
+			continue
+		}
+
+		client, err := s.factory().NewESClient([]Endpoint{ep})
+		if err == nil {
+			s.recordSuccess(state)
+			return client, nil
+		}
+
+		s.recordFailure(i, state, classifyFailure(err))
+		failures = append(failures, fmt.Sprintf("%s: %v", ep, err))
+	}
+
+	return nil, fmt.Errorf("no ES endpoint reachable, tried:\n%s", strings.Join(failures, "\n"))
+}
+
+func (s *Supervised) circuitOpen(state *endpointState) (time.Time, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.openUntil, time.Now().Before(state.openUntil)
+}
+
+func (s *Supervised) recordSuccess(state *endpointState) {
+	state.mu.Lock()
+	state.consecutiveFails = 0
+	state.openUntil = time.Time{}
+	state.mu.Unlock()
+}
+
+func (s *Supervised) recordFailure(idx int, state *endpointState, class FailureClass) {
+	threshold := s.Config.FailureThreshold
+	if class == FailureServer {
+		threshold *= 2
+	}
+
+	state.mu.Lock()
+	state.consecutiveFails++
+	fails := state.consecutiveFails
+	alreadyProbing := state.probing
+	tripped := fails >= threshold
+	if tripped {
+		backoff := s.Config.FailureBackoff * time.Duration(math.Pow(2, float64(fails-threshold)))
+		if backoff <= 0 || backoff > s.Config.BackoffMax {
+			backoff = s.Config.BackoffMax
+		}
+		state.openUntil = time.Now().Add(backoff)
+	}
+	state.mu.Unlock()
+
+	if tripped && !alreadyProbing {
+		go s.probe(idx, state)
+	}
+}
+
+// probe runs in the background while an endpoint's circuit is open, issuing
+// a lightweight connect-and-ping every ProbeInterval so Supervised notices
+// recovery without waiting for the next real caller to retry.
+func (s *Supervised) probe(idx int, state *endpointState) {
+	state.mu.Lock()
+	state.probing = true
+	state.mu.Unlock()
+	defer func() {
+		state.mu.Lock()
+		state.probing = false
+		state.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(s.Config.ProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, open := s.circuitOpen(state); !open {
+			return
+		}
+
+		client, err := s.factory().NewESClient([]Endpoint{s.Endpoints[idx]})
+		if err != nil {
+			continue
+		}
+		client.Close()
+		s.recordSuccess(state)
+		return
+	}
+}
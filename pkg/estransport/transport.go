@@ -1,48 +1,137 @@
 package estransport
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"time"
 )
 
-// UnixSocketTransport implements http.RoundTripper for Unix socket connections
+// TransportConfig tunes UnixSocketTransport's underlying connection pool.
+type TransportConfig struct {
+	// MaxIdleConns caps idle connections kept open to the socket.
+	MaxIdleConns int
+	// IdleConnTimeout closes a pooled connection that's sat idle this long.
+	IdleConnTimeout time.Duration
+	// DialTimeout bounds how long dialing the Unix socket itself may take.
+	DialTimeout time.Duration
+	// IOTimeout is the deadline applied to each individual Read/Write on a
+	// connection, refreshed on every call rather than set once for the
+	// whole request/response cycle, so a connection sitting idle in the
+	// pool between requests doesn't get killed by its last request's
+	// deadline.
+	IOTimeout time.Duration
+}
+
+// DefaultTransportConfig returns the pooling defaults NewUnixSocketTransport
+// uses.
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:    10,
+		IdleConnTimeout: 90 * time.Second,
+		DialTimeout:     5 * time.Second,
+		IOTimeout:       30 * time.Second,
+	}
+}
+
+// UnixSocketTransport is a pooled http.RoundTripper for a proxy listening on
+// a Unix domain socket. It hands dialing and connection reuse to a regular
+// net/http.Transport (via a custom DialContext) so chunked encoding, gzip,
+// and HTTP/1.1 keep-alive all work the same way they would against a TCP
+// backend, instead of a single dial-write-read-close per request.
 type UnixSocketTransport struct {
 	socketPath string
-	timeout    time.Duration
+	cfg        TransportConfig
+	rt         *http.Transport
 }
 
+// NewUnixSocketTransport builds a UnixSocketTransport with
+// DefaultTransportConfig.
 func NewUnixSocketTransport(socketPath string) *UnixSocketTransport {
-	return &UnixSocketTransport{
-		socketPath: socketPath,
-		timeout:    30 * time.Second,
+	return NewUnixSocketTransportConfig(socketPath, DefaultTransportConfig())
+}
+
+// NewUnixSocketTransportConfig is NewUnixSocketTransport with explicit pool
+// tuning, for callers that want a smaller pool or tighter timeouts than the
+// defaults.
+func NewUnixSocketTransportConfig(socketPath string, cfg TransportConfig) *UnixSocketTransport {
+	t := &UnixSocketTransport{socketPath: socketPath, cfg: cfg}
+	t.rt = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: cfg.DialTimeout}
+			conn, err := d.DialContext(ctx, "unix", socketPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to proxy socket %s: %v", socketPath, err)
+			}
+			return &deadlineConn{Conn: conn, timeout: cfg.IOTimeout}, nil
+		},
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConns,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
 	}
+	return t
 }
 
+// RoundTrip sends req over the pooled connection. If the pooled connection
+// turned out to be stale (the usual failure mode when the proxy closed an
+// idle keep-alive connection out from under us), it retries once over a
+// guaranteed-fresh connection and tells the server not to keep that one
+// alive either, rather than failing the request outright.
 func (t *UnixSocketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Connect to Unix socket
-	conn, err := net.DialTimeout("unix", t.socketPath, 5*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy socket %s: %v", t.socketPath, err)
+	resp, err := t.rt.RoundTrip(req)
+	if err == nil {
+		return resp, nil
 	}
-	defer conn.Close()
 
-	// Set overall timeout for the entire request/response cycle
-	conn.SetDeadline(time.Now().Add(t.timeout))
+	if req.Body != nil && req.GetBody == nil {
+		// req.Clone reuses the same, already-drained Body; without GetBody
+		// there's no way to rewind it, so retrying would silently send an
+		// empty or EOF body instead of the original request.
+		return nil, fmt.Errorf("round-tripping request to proxy socket %s: %v (not retrying: request body is not replayable)", t.socketPath, err)
+	}
 
-	// Write the HTTP request to the socket
-	if err := req.Write(conn); err != nil {
-		return nil, fmt.Errorf("failed to write HTTP request: %v", err)
+	t.rt.CloseIdleConnections()
+	retry := req.Clone(req.Context())
+	retry.Close = true // sends "Connection: close"; don't trust this conn to be reusable after an error
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, fmt.Errorf("round-tripping request to proxy socket %s: %v (rewinding body for retry: %v)", t.socketPath, err, bodyErr)
+		}
+		retry.Body = body
+	}
+	resp, retryErr := t.rt.RoundTrip(retry)
+	if retryErr != nil {
+		return nil, fmt.Errorf("round-tripping request to proxy socket %s (retried after %v): %v", t.socketPath, err, retryErr)
 	}
+	return resp, nil
+}
 
-	// Read the HTTP response from the socket
-	reader := bufio.NewReader(conn)
-	resp, err := http.ReadResponse(reader, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read HTTP response: %v", err)
+// CloseIdleConnections closes this transport's pooled connections.
+func (t *UnixSocketTransport) CloseIdleConnections() {
+	t.rt.CloseIdleConnections()
+}
+
+// deadlineConn wraps a net.Conn so every Read/Write refreshes its own
+// deadline instead of relying on one SetDeadline call for an entire
+// request/response cycle, which would otherwise time out a connection
+// that's legitimately idle in the pool between requests.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
 	}
+	return c.Conn.Read(b)
+}
 
-	return resp, nil
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	return c.Conn.Write(b)
 }
@@ -0,0 +1,245 @@
+// Package eventindex persists a rolling window of published pub/sub events
+// to disk with a monotonic ID per event, so tls-proxy can replay history to
+// a subscriber that reconnects with SINCE=<id>, SINCE=-<N>, or
+// SINCE=<timestamp> before
+// switching it over to live tailing - the piece that lets a crashed TUI
+// resume without gaps or duplicates instead of only ever seeing events
+// published after it happened to be connected.
+package eventindex
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Event is one durable, ID-stamped record. Data is the original published
+// payload with an "id" field merged in, so a client's existing event struct
+// picks up replay support just by adding an ID field.
+type Event struct {
+	ID        uint64          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// DefaultMaxEvents bounds the index to the most recent 10000 events before
+// the oldest are evicted.
+const DefaultMaxEvents = 10000
+
+// Root returns $TOTALRECALLROOT/events, falling back to
+// $XDG_STATE_HOME/totalrecall/events, then ~/.totalrecall/events.
+func Root() string {
+	if root := os.Getenv("TOTALRECALLROOT"); root != "" {
+		return filepath.Join(root, "events")
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "totalrecall", "events")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "events")
+}
+
+// DefaultPath returns Root()/index.jsonl.
+func DefaultPath() string {
+	return filepath.Join(Root(), "index.jsonl")
+}
+
+// Index is an append-only on-disk log of published events, bounded to
+// maxEvents by compacting the log once it grows past that.
+type Index struct {
+	mu        sync.Mutex
+	path      string
+	maxEvents int
+	nextID    uint64
+	events    []Event // in-memory mirror, oldest first
+}
+
+// Open loads path's existing log, if any, to recover nextID and the
+// in-memory mirror, creating path's directory if needed. maxEvents of 0
+// falls back to DefaultMaxEvents.
+func Open(path string, maxEvents int) (*Index, error) {
+	if maxEvents <= 0 {
+		maxEvents = DefaultMaxEvents
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating directory for event index %s: %v", path, err)
+	}
+
+	idx := &Index{path: path, maxEvents: maxEvents}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening event index %s: %v", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip a corrupted line rather than failing recovery
+		}
+		idx.events = append(idx.events, e)
+		if e.ID > idx.nextID {
+			idx.nextID = e.ID
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading event index %s: %v", path, err)
+	}
+
+	return idx, nil
+}
+
+// Append assigns the next monotonic ID to data, merges it in as an "id"
+// field along with a "_published_at_unix_nano" field set from ts (so a
+// subscriber can compute publish-to-receive latency), persists the record,
+// and returns both the ID and the stamped JSON so the caller can publish
+// exactly what was stored.
+func (idx *Index) Append(data []byte, ts time.Time) (uint64, []byte, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	id := idx.nextID + 1
+
+	stamped, err := stampID(data, id, ts)
+	if err != nil {
+		return 0, nil, fmt.Errorf("stamping event id: %v", err)
+	}
+
+	e := Event{ID: id, Timestamp: ts, Data: json.RawMessage(stamped)}
+	if err := idx.appendToDisk(e); err != nil {
+		return 0, nil, err
+	}
+	idx.nextID = id
+	idx.events = append(idx.events, e)
+
+	if len(idx.events) > idx.maxEvents {
+		if err := idx.compact(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return id, stamped, nil
+}
+
+// SinceID returns every event with ID greater than since, oldest first.
+func (idx *Index) SinceID(since uint64) []Event {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var out []Event
+	for _, e := range idx.events {
+		if e.ID > since {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Last returns the most recent n events, oldest first, or every retained
+// event if fewer than n are available.
+func (idx *Index) Last(n int) []Event {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if n >= len(idx.events) {
+		return append([]Event(nil), idx.events...)
+	}
+	return append([]Event(nil), idx.events[len(idx.events)-n:]...)
+}
+
+// SinceTime returns every event timestamped at or after since, oldest
+// first.
+func (idx *Index) SinceTime(since time.Time) []Event {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var out []Event
+	for _, e := range idx.events {
+		if !e.Timestamp.Before(since) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// stampID merges "id" into data's top-level JSON object.
+func stampID(data []byte, id uint64, ts time.Time) ([]byte, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("parsing event as JSON object: %v", err)
+	}
+	obj["id"] = id
+	obj["_published_at_unix_nano"] = ts.UnixNano()
+	return json.Marshal(obj)
+}
+
+// appendToDisk fsyncs e onto the end of the log, the same durability
+// tradeoff pkg/spool makes for spooled events.
+func (idx *Index) appendToDisk(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding event index record: %v", err)
+	}
+
+	f, err := os.OpenFile(idx.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening event index %s: %v", idx.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("appending to event index %s: %v", idx.path, err)
+	}
+	return f.Sync()
+}
+
+// compact rewrites the log with only the most recent maxEvents kept,
+// trimming idx.events to match.
+func (idx *Index) compact() error {
+	idx.events = idx.events[len(idx.events)-idx.maxEvents:]
+
+	tmp := idx.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("compacting event index %s: %v", idx.path, err)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, e := range idx.events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("encoding event index record: %v", err)
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			f.Close()
+			return fmt.Errorf("writing event index %s: %v", tmp, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("flushing event index %s: %v", tmp, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("fsyncing event index %s: %v", tmp, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing event index %s: %v", tmp, err)
+	}
+
+	return os.Rename(tmp, idx.path)
+}
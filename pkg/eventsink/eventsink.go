@@ -0,0 +1,15 @@
+// Package eventsink defines the outbound side of publishing a command
+// event. postexec and the NATS publisher each have their own transport
+// (unix socket, direct TLS, JetStream) behind this interface so the
+// retry/fallback logic around them can be tested against a fake instead of
+// a real socket or NATS server.
+package eventsink
+
+import "context"
+
+//go:generate mockgen -source=eventsink.go -destination=mock_eventsink.go -package=eventsink
+
+// EventSink delivers an already-encoded CommandEvent somewhere durable.
+type EventSink interface {
+	Publish(ctx context.Context, data []byte) error
+}
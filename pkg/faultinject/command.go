@@ -0,0 +1,158 @@
+package faultinject
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyCommand parses and applies one FAULT admin command - the words
+// after "FAULT" in the wire protocol line - against inj, returning the
+// line to send back to the client. Recognized forms:
+//
+//	set blackhole=<target>
+//	set latency=<min>,<max>        (time.ParseDuration syntax, e.g. 10ms)
+//	set droprate=<0-1>
+//	set corruptrate=<0-1>
+//	set pause=accept
+//	set slowconsumer=<id>:<bytesPerSec>
+//	clear                          (resets every knob)
+//	clear <knob>                   (resets just that knob)
+func ApplyCommand(inj *Injector, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("missing subcommand, want: set <knob>=<value> | clear [<knob>]")
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) != 2 {
+			return "", fmt.Errorf("want: set <knob>=<value>")
+		}
+		if err := setKnob(inj, args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("FAULT set %s", args[1]), nil
+
+	case "clear":
+		if len(args) == 1 {
+			inj.Clear()
+			return "FAULT cleared all", nil
+		}
+		if err := clearKnob(inj, args[1]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("FAULT cleared %s", args[1]), nil
+
+	default:
+		return "", fmt.Errorf("unknown FAULT subcommand %q, want set or clear", args[0])
+	}
+}
+
+func setKnob(inj *Injector, kv string) error {
+	key, value, ok := strings.Cut(kv, "=")
+	if !ok {
+		return fmt.Errorf("malformed knob %q, want key=value", kv)
+	}
+
+	switch key {
+	case "blackhole":
+		inj.BlackholeUpstream(value)
+
+	case "latency":
+		min, max, err := parseLatencyRange(value)
+		if err != nil {
+			return err
+		}
+		inj.SetLatency(min, max)
+
+	case "droprate":
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("parsing droprate %q: %v", value, err)
+		}
+		inj.SetDropRate(p)
+
+	case "corruptrate":
+		p, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("parsing corruptrate %q: %v", value, err)
+		}
+		inj.CorruptRate(p)
+
+	case "pause":
+		if value != "accept" {
+			return fmt.Errorf("unknown pause target %q, want accept", value)
+		}
+		inj.PauseAccept()
+
+	case "slowconsumer":
+		id, rate, err := parseSlowConsumer(value)
+		if err != nil {
+			return err
+		}
+		inj.SlowConsumer(id, rate)
+
+	default:
+		return fmt.Errorf("unknown knob %q", key)
+	}
+
+	return nil
+}
+
+func clearKnob(inj *Injector, key string) error {
+	switch key {
+	case "blackhole":
+		inj.mu.Lock()
+		inj.blackholed = make(map[string]bool)
+		inj.mu.Unlock()
+	case "latency":
+		inj.SetLatency(0, 0)
+	case "droprate":
+		inj.SetDropRate(0)
+	case "corruptrate":
+		inj.CorruptRate(0)
+	case "pause":
+		inj.ResumeAccept()
+	case "slowconsumer":
+		inj.mu.Lock()
+		inj.slowRates = make(map[string]int)
+		inj.mu.Unlock()
+	default:
+		return fmt.Errorf("unknown knob %q", key)
+	}
+	return nil
+}
+
+// parseLatencyRange parses "min,max" (time.ParseDuration syntax on each
+// half) into a latency range for SetLatency.
+func parseLatencyRange(s string) (min, max time.Duration, err error) {
+	minStr, maxStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("parsing latency %q: want min,max (e.g. 10ms,50ms)", s)
+	}
+
+	min, err = time.ParseDuration(minStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing latency min %q: %v", minStr, err)
+	}
+	max, err = time.ParseDuration(maxStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing latency max %q: %v", maxStr, err)
+	}
+	return min, max, nil
+}
+
+// parseSlowConsumer parses "id:bytesPerSec" for setKnob's slowconsumer=...
+func parseSlowConsumer(s string) (id string, bytesPerSec int, err error) {
+	id, rateStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("parsing slowconsumer %q: want id:bytesPerSec", s)
+	}
+
+	rate, err := strconv.Atoi(rateStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("parsing slowconsumer rate %q: %v", rateStr, err)
+	}
+	return id, rate, nil
+}
@@ -0,0 +1,238 @@
+// Package faultinject wraps tls-proxy's ConnectionPool and PubSubHub with
+// runtime-toggleable fault knobs - blackholed upstreams, injected latency,
+// dropped or corrupted messages, paused accept, and rate-limited
+// "slow consumer" subscribers - so integration tests and staging
+// environments can exercise reconnect/backoff and dead-subscriber eviction
+// without external chaos tooling. Modeled on etcd's pkg/proxy
+// fault-injection server.
+package faultinject
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Kind identifies the category of fault an Event describes.
+type Kind string
+
+const (
+	// KindBlackhole is a dial rejected because its target is blackholed.
+	KindBlackhole Kind = "blackhole"
+	// KindDrop is a message silently discarded per the configured drop rate.
+	KindDrop Kind = "drop"
+	// KindCorrupt is a message whose bytes were flipped per the configured
+	// corrupt rate.
+	KindCorrupt Kind = "corrupt"
+	// KindPauseAccept is a connection rejected while accept is paused.
+	KindPauseAccept Kind = "pause_accept"
+)
+
+// Event describes one fault actually triggered against a connection or
+// message, as opposed to merely configured, so a caller can assert "the
+// pool saw N blackholed dials" instead of just "blackhole was configured".
+type Event struct {
+	Kind   Kind
+	Target string
+	At     time.Time
+}
+
+// Injector holds the runtime-toggleable fault knobs ConnectionPool and
+// PubSubHub consult on their hot paths. The zero value (via New) injects
+// nothing, so wiring an Injector into a proxy that never calls its FAULT
+// admin verb is a no-op.
+type Injector struct {
+	mu sync.RWMutex
+
+	blackholed map[string]bool
+	latencyMin time.Duration
+	latencyMax time.Duration
+	dropRate   float64
+	corrupt    float64
+	paused     bool
+	slowRates  map[string]int // subscriber id -> bytes/sec
+
+	// OnEvent, if set, is called for every fault actually triggered (not
+	// merely configured). It must not block.
+	OnEvent func(Event)
+}
+
+// New returns an Injector with every knob at its default (no-op) setting.
+func New() *Injector {
+	return &Injector{
+		blackholed: make(map[string]bool),
+		slowRates:  make(map[string]int),
+	}
+}
+
+func (i *Injector) emit(e Event) {
+	if i.OnEvent == nil {
+		return
+	}
+	e.At = time.Now()
+	i.OnEvent(e)
+}
+
+// BlackholeUpstream makes every future dial of target fail immediately,
+// simulating a network partition to that address.
+func (i *Injector) BlackholeUpstream(target string) {
+	i.mu.Lock()
+	i.blackholed[target] = true
+	i.mu.Unlock()
+}
+
+// ClearBlackhole lets target be dialed normally again.
+func (i *Injector) ClearBlackhole(target string) {
+	i.mu.Lock()
+	delete(i.blackholed, target)
+	i.mu.Unlock()
+}
+
+// SetLatency adds a random delay, uniformly distributed in [min, max),
+// before every dial BeforeDial guards. max <= min disables the delay.
+func (i *Injector) SetLatency(min, max time.Duration) {
+	i.mu.Lock()
+	i.latencyMin, i.latencyMax = min, max
+	i.mu.Unlock()
+}
+
+// SetDropRate makes ShouldDrop report true for a fraction p (0-1) of calls,
+// simulating packet loss on the pub/sub fanout and fluent-bit ingest paths.
+func (i *Injector) SetDropRate(p float64) {
+	i.mu.Lock()
+	i.dropRate = p
+	i.mu.Unlock()
+}
+
+// CorruptRate makes MaybeCorrupt flip a byte in a fraction p (0-1) of the
+// payloads it sees.
+func (i *Injector) CorruptRate(p float64) {
+	i.mu.Lock()
+	i.corrupt = p
+	i.mu.Unlock()
+}
+
+// PauseAccept makes Accepting report false, so the proxy's accept loop can
+// reject new connections while appearing otherwise alive.
+func (i *Injector) PauseAccept() {
+	i.mu.Lock()
+	i.paused = true
+	i.mu.Unlock()
+}
+
+// ResumeAccept undoes PauseAccept.
+func (i *Injector) ResumeAccept() {
+	i.mu.Lock()
+	i.paused = false
+	i.mu.Unlock()
+}
+
+// Accepting reports whether new connections should currently be accepted.
+// Each false report emits a KindPauseAccept event, since the caller rejects
+// the connection it asked about.
+func (i *Injector) Accepting() bool {
+	i.mu.RLock()
+	paused := i.paused
+	i.mu.RUnlock()
+	if paused {
+		i.emit(Event{Kind: KindPauseAccept})
+	}
+	return !paused
+}
+
+// SlowConsumer caps subscriber id's effective write rate to bytesPerSec,
+// so its connection's existing write-deadline logic evicts it once the
+// fanout can no longer keep up - exercising the same dead-subscriber path
+// a genuinely slow client would hit.
+func (i *Injector) SlowConsumer(id string, bytesPerSec int) {
+	i.mu.Lock()
+	i.slowRates[id] = bytesPerSec
+	i.mu.Unlock()
+}
+
+// ClearSlowConsumer restores id to its normal, unthrottled write rate.
+func (i *Injector) ClearSlowConsumer(id string) {
+	i.mu.Lock()
+	delete(i.slowRates, id)
+	i.mu.Unlock()
+}
+
+// SlowConsumerRate returns the bytes/sec configured for id, or 0 if none.
+func (i *Injector) SlowConsumerRate(id string) int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.slowRates[id]
+}
+
+// Clear resets every knob to its default, uninjected state.
+func (i *Injector) Clear() {
+	i.mu.Lock()
+	i.blackholed = make(map[string]bool)
+	i.latencyMin, i.latencyMax = 0, 0
+	i.dropRate = 0
+	i.corrupt = 0
+	i.paused = false
+	i.slowRates = make(map[string]int)
+	i.mu.Unlock()
+}
+
+// BeforeDial is called before ConnectionPool dials target. It sleeps for
+// the configured latency, then returns an error - after reporting a
+// KindBlackhole Event - if target is blackholed.
+func (i *Injector) BeforeDial(target string) error {
+	i.mu.RLock()
+	blackholed := i.blackholed[target]
+	min, max := i.latencyMin, i.latencyMax
+	i.mu.RUnlock()
+
+	i.sleepLatency(min, max)
+
+	if blackholed {
+		i.emit(Event{Kind: KindBlackhole, Target: target})
+		return fmt.Errorf("faultinject: %s is blackholed", target)
+	}
+	return nil
+}
+
+func (i *Injector) sleepLatency(min, max time.Duration) {
+	if max <= min {
+		return
+	}
+	d := min + time.Duration(rand.Int63n(int64(max-min)))
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// ShouldDrop reports whether the current call should be dropped per the
+// configured drop rate, emitting a KindDrop Event when it does.
+func (i *Injector) ShouldDrop() bool {
+	i.mu.RLock()
+	p := i.dropRate
+	i.mu.RUnlock()
+
+	if p <= 0 || rand.Float64() >= p {
+		return false
+	}
+	i.emit(Event{Kind: KindDrop})
+	return true
+}
+
+// MaybeCorrupt flips a random byte of data per the configured corrupt
+// rate, returning data unchanged otherwise. It never mutates data in
+// place, so the caller's original bytes remain valid to log or republish.
+func (i *Injector) MaybeCorrupt(data []byte) []byte {
+	i.mu.RLock()
+	p := i.corrupt
+	i.mu.RUnlock()
+
+	if p <= 0 || len(data) == 0 || rand.Float64() >= p {
+		return data
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[rand.Intn(len(corrupted))] ^= 0xFF
+	i.emit(Event{Kind: KindCorrupt})
+	return corrupted
+}
@@ -0,0 +1,45 @@
+package faultinject
+
+import (
+	"io"
+	"time"
+)
+
+// throttleChunk bounds how much a Throttle writer writes before pausing to
+// pace itself, so a large write doesn't all land in one burst.
+const throttleChunk = 256
+
+// Throttle wraps w so writes land at no more than bytesPerSec, by writing
+// in small chunks and sleeping between them. Combined with a connection's
+// existing write deadline, this is what makes SlowConsumer actually evict
+// a throttled subscriber instead of just writing slowly forever.
+func Throttle(w io.Writer, bytesPerSec int) io.Writer {
+	if bytesPerSec <= 0 {
+		return w
+	}
+	return &throttledWriter{w: w, bytesPerSec: bytesPerSec}
+}
+
+type throttledWriter struct {
+	w           io.Writer
+	bytesPerSec int
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	total := 0
+	for total < len(p) {
+		end := total + throttleChunk
+		if end > len(p) {
+			end = len(p)
+		}
+
+		n, err := t.w.Write(p[total:end])
+		total += n
+		if err != nil {
+			return total, err
+		}
+
+		time.Sleep(time.Duration(float64(n) / float64(t.bytesPerSec) * float64(time.Second)))
+	}
+	return total, nil
+}
@@ -0,0 +1,129 @@
+// Package jetstream wires the various totalrecall collectors and consumers
+// into a single JetStream-backed pipeline instead of ad-hoc TCP/core-NATS
+// fire-and-forget publishing.
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// StreamName is the JetStream stream all command events are published to.
+	StreamName = "TOTALRECALL"
+	// SubjectPrefix is the subject namespace command events are published under.
+	SubjectPrefix = "totalrecall.command"
+	// Subjects is the wildcard subject set the stream is configured to capture.
+	Subjects = SubjectPrefix + ".>"
+)
+
+// Config controls how the TOTALRECALL stream is provisioned.
+type Config struct {
+	URL       string
+	Retention nats.RetentionPolicy
+	MaxAge    time.Duration
+	// AckTimeout bounds how long PublishAsync acks are drained for before exit.
+	AckTimeout time.Duration
+}
+
+// DefaultConfig returns sensible defaults: limits retention, 7 days max age,
+// and a 5 second drain timeout on process exit.
+func DefaultConfig() Config {
+	return Config{
+		URL:        nats.DefaultURL,
+		Retention:  nats.LimitsPolicy,
+		MaxAge:     7 * 24 * time.Hour,
+		AckTimeout: 5 * time.Second,
+	}
+}
+
+// Connect dials NATS, obtains a JetStream context, and ensures the
+// TOTALRECALL stream exists with the configured retention/max-age.
+func Connect(cfg Config, opts ...nats.Option) (*nats.Conn, nats.JetStreamContext, error) {
+	nc, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to nats at %s: %v", cfg.URL, err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, nil, fmt.Errorf("getting jetstream context: %v", err)
+	}
+
+	if err := ensureStream(js, cfg); err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	return nc, js, nil
+}
+
+func ensureStream(js nats.JetStreamContext, cfg Config) error {
+	if _, err := js.StreamInfo(StreamName); err == nil {
+		return nil
+	}
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:      StreamName,
+		Subjects:  []string{Subjects},
+		Retention: cfg.Retention,
+		MaxAge:    cfg.MaxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("ensuring stream %s: %v", StreamName, err)
+	}
+	return nil
+}
+
+// DrainAcks blocks until every pending PublishAsync call has been
+// acknowledged by the server, or until timeout elapses.
+func DrainAcks(js nats.JetStreamContext, timeout time.Duration) error {
+	select {
+	case <-js.PublishAsyncComplete():
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s waiting for %d pending acks", timeout, js.PublishAsyncPending())
+	}
+}
+
+// Sink adapts a publish-and-drain-acks call into an eventsink.EventSink, so
+// callers that just want to deliver an event don't need to know about
+// PublishAsync/DrainAcks to be testable against a fake.
+type Sink struct {
+	JS         nats.JetStreamContext
+	Subject    string
+	AckTimeout time.Duration
+}
+
+func (s Sink) Publish(ctx context.Context, data []byte) error {
+	if _, err := s.JS.PublishAsync(s.Subject, data); err != nil {
+		return fmt.Errorf("publishing to %s: %v", s.Subject, err)
+	}
+	return DrainAcks(s.JS, s.AckTimeout)
+}
+
+// DurableConsumer binds (creating if necessary) a durable pull consumer on
+// the TOTALRECALL stream, scoped to the given subject filter.
+func DurableConsumer(js nats.JetStreamContext, durableName, subjectFilter string) (*nats.Subscription, error) {
+	sub, err := js.PullSubscribe(subjectFilter, durableName, nats.BindStream(StreamName))
+	if err != nil {
+		return nil, fmt.Errorf("binding durable consumer %s: %v", durableName, err)
+	}
+	return sub, nil
+}
+
+// RewindConsumer creates an ephemeral pull consumer on the TOTALRECALL
+// stream that starts delivery at startTime, for a UI that wants to replay
+// history from a chosen point (e.g. a "rewind" keybinding) without
+// disturbing a durable consumer's saved position.
+func RewindConsumer(js nats.JetStreamContext, subjectFilter string, startTime time.Time) (*nats.Subscription, error) {
+	sub, err := js.PullSubscribe(subjectFilter, "", nats.BindStream(StreamName), nats.StartTime(startTime))
+	if err != nil {
+		return nil, fmt.Errorf("creating rewind consumer at %s: %v", startTime, err)
+	}
+	return sub, nil
+}
@@ -0,0 +1,104 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeJetStream embeds a nil nats.JetStreamContext so it satisfies the full
+// interface, then overrides only the publish/ack methods Sink.Publish and
+// DrainAcks actually call - any other method panics if exercised, which
+// would mean the test needs updating, not the fake.
+type fakeJetStream struct {
+	nats.JetStreamContext
+
+	publishErr error
+	pending    int
+	complete   chan struct{}
+}
+
+func (f *fakeJetStream) PublishAsync(subj string, data []byte, opts ...nats.PubOpt) (nats.PubAckFuture, error) {
+	if f.publishErr != nil {
+		return nil, f.publishErr
+	}
+	return nil, nil
+}
+
+func (f *fakeJetStream) PublishAsyncPending() int {
+	return f.pending
+}
+
+func (f *fakeJetStream) PublishAsyncComplete() <-chan struct{} {
+	return f.complete
+}
+
+func TestSinkPublishAckFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		js         *fakeJetStream
+		ackTimeout time.Duration
+		wantErr    string
+	}{
+		{
+			name:       "publish itself fails",
+			js:         &fakeJetStream{publishErr: errors.New("no responders"), complete: make(chan struct{})},
+			ackTimeout: time.Second,
+			wantErr:    "publishing to totalrecall.command.test: no responders",
+		},
+		{
+			name:       "publish succeeds but the ack never arrives before the timeout",
+			js:         &fakeJetStream{pending: 3, complete: make(chan struct{})}, // never closed: ack never arrives
+			ackTimeout: 20 * time.Millisecond,
+			wantErr:    "timed out after 20ms waiting for 3 pending acks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := Sink{JS: tt.js, Subject: "totalrecall.command.test", AckTimeout: tt.ackTimeout}
+			err := sink.Publish(context.Background(), []byte(`{}`))
+			if err == nil {
+				t.Fatal("expected an error, got none")
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("got error %q, want %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSinkPublishAckSucceeds(t *testing.T) {
+	complete := make(chan struct{})
+	close(complete) // already-acked: PublishAsyncComplete fires immediately
+
+	sink := Sink{JS: &fakeJetStream{complete: complete}, Subject: "totalrecall.command.test", AckTimeout: time.Second}
+	if err := sink.Publish(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDrainAcksTimeout(t *testing.T) {
+	js := &fakeJetStream{pending: 5, complete: make(chan struct{})}
+
+	err := DrainAcks(js, 10*time.Millisecond)
+	if err == nil {
+		t.Fatal("expected a timeout error, got none")
+	}
+	want := "timed out after 10ms waiting for 5 pending acks"
+	if err.Error() != want {
+		t.Errorf("got error %q, want %q", err.Error(), want)
+	}
+}
+
+func TestDrainAcksCompletes(t *testing.T) {
+	complete := make(chan struct{})
+	close(complete)
+
+	if err := DrainAcks(&fakeJetStream{complete: complete}, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
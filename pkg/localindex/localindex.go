@@ -0,0 +1,348 @@
+// Package localindex implements estransport.IndexBackend without a running
+// Elasticsearch cluster, for users who can't or don't want to stand one
+// up: BadgerDB stores each Command keyed for time-ordered scans, and Bleve
+// indexes Command.Command for full-text search, mirroring the split
+// gitea's issue indexer draws between its embedded Bleve mode and its
+// Elasticsearch mode.
+package localindex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve/v2"
+	bleveQuery "github.com/blevesearch/bleve/v2/search/query"
+	badger "github.com/dgraph-io/badger/v4"
+
+	"totalrecall/pkg/estransport"
+)
+
+// Config configures an embedded Backend.
+type Config struct {
+	// Dir holds both the Bleve index and the BadgerDB store. Empty uses
+	// the default under $XDG_STATE_HOME (see dir below).
+	Dir string
+}
+
+// ConfigFromEnv builds a Config from TOTALRECALL_LOCAL_DIR.
+func ConfigFromEnv() Config {
+	return Config{Dir: os.Getenv("TOTALRECALL_LOCAL_DIR")}
+}
+
+// dir resolves c.Dir, falling back to $XDG_STATE_HOME/totalrecall/localindex
+// then ~/.totalrecall/localindex, the same fallback pkg/spool.Root uses.
+func (c Config) dir() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "totalrecall", "localindex")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "localindex")
+}
+
+// Backend is an embedded estransport.IndexBackend: Bleve for full-text
+// search over commands, BadgerDB for the exact-match and time-ordered
+// scans the frecency aggregation needs.
+type Backend struct {
+	dir   string
+	bleve bleve.Index
+	kv    *badger.DB
+}
+
+var _ estransport.IndexBackend = (*Backend)(nil)
+
+// Open creates or reopens an embedded Backend at cfg's directory.
+func Open(cfg Config) (*Backend, error) {
+	dir := cfg.dir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating local index dir %s: %v", dir, err)
+	}
+
+	blevePath := filepath.Join(dir, "bleve")
+	index, err := bleve.Open(blevePath)
+	if err != nil {
+		mapping := bleve.NewIndexMapping()
+		index, err = bleve.New(blevePath, mapping)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening bleve index %s: %v", blevePath, err)
+	}
+
+	opts := badger.DefaultOptions(filepath.Join(dir, "badger")).WithLogger(nil)
+	kv, err := badger.Open(opts)
+	if err != nil {
+		index.Close()
+		return nil, fmt.Errorf("opening badger db %s: %v", dir, err)
+	}
+
+	return &Backend{dir: dir, bleve: index, kv: kv}, nil
+}
+
+// Close releases the Bleve index and BadgerDB handles. Not part of
+// IndexBackend (which has no Close, since ES connections don't need one
+// the same way) - callers type-assert for it, e.g. `if c, ok :=
+// backend.(io.Closer); ok { defer c.Close() }`.
+func (b *Backend) Close() error {
+	berr := b.bleve.Close()
+	kerr := b.kv.Close()
+	if berr != nil {
+		return berr
+	}
+	return kerr
+}
+
+// commandKey orders commands by end timestamp so a prefix scan over
+// badger yields them oldest-first, the same order ES's start_timestamp
+// sort gives the existing code.
+func commandKey(cmd estransport.Command, id string) []byte {
+	return []byte(fmt.Sprintf("cmd:%020d:%s", cmd.EndTimestamp.UnixNano(), id))
+}
+
+// Index stores cmd in BadgerDB and indexes its command text in Bleve.
+func (b *Backend) Index(ctx context.Context, cmd estransport.Command) error {
+	id := fmt.Sprintf("%d", cmd.EndTimestamp.UnixNano())
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("encoding command: %v", err)
+	}
+
+	if err := b.kv.Update(func(txn *badger.Txn) error {
+		return txn.Set(commandKey(cmd, id), data)
+	}); err != nil {
+		return fmt.Errorf("writing command to badger: %v", err)
+	}
+
+	doc := map[string]interface{}{
+		"command":         cmd.Command,
+		"pwd":             cmd.Pwd,
+		"hostname":        cmd.Hostname,
+		"start_timestamp": cmd.StartTimestamp,
+	}
+	if err := b.bleve.Index(id, doc); err != nil {
+		return fmt.Errorf("indexing command in bleve: %v", err)
+	}
+	return nil
+}
+
+// Search runs a full-text match against Bleve's "command" field, loading
+// each hit's full Command back out of BadgerDB.
+func (b *Backend) Search(ctx context.Context, query map[string]interface{}) (*estransport.SearchResponse, error) {
+	phrase := extractCommandPhrase(query)
+
+	var bq bleveQuery.Query
+	if phrase != "" {
+		mq := bleve.NewMatchPhraseQuery(phrase)
+		mq.SetField("command")
+		bq = mq
+	} else {
+		bq = bleve.NewMatchAllQuery()
+	}
+
+	size := 10
+	if s, ok := query["size"].(int); ok && s > 0 {
+		size = s
+	}
+
+	req := bleve.NewSearchRequest(bq)
+	req.Size = size
+
+	result, err := b.bleve.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("bleve search: %v", err)
+	}
+
+	resp := &estransport.SearchResponse{}
+	resp.Hits.Total.Value = int(result.Total)
+	resp.Hits.Total.Relation = "eq"
+	for _, hit := range result.Hits {
+		cmd, err := b.loadCommand(hit.ID)
+		if err != nil {
+			continue
+		}
+		resp.Hits.Hits = append(resp.Hits.Hits, estransport.Hit{
+			Index:  "local",
+			ID:     hit.ID,
+			Score:  hit.Score,
+			Source: *cmd,
+		})
+	}
+	return resp, nil
+}
+
+func (b *Backend) loadCommand(id string) (*estransport.Command, error) {
+	var cmd estransport.Command
+	err := b.kv.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		suffix := []byte(":" + id)
+		for it.Seek([]byte("cmd:")); it.ValidForPrefix([]byte("cmd:")); it.Next() {
+			key := it.Item().Key()
+			if strings.HasSuffix(string(key), string(suffix)) {
+				return it.Item().Value(func(val []byte) error {
+					return json.Unmarshal(val, &cmd)
+				})
+			}
+		}
+		return fmt.Errorf("command %s not found", id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// dirBucket accumulates frequency and best recency-adjusted score for one
+// directory while scanning badger, the local equivalent of the ES side's
+// terms + scripted_metric + bucket_script aggregation.
+type dirBucket struct {
+	count     int
+	bestScore float64
+}
+
+// Aggregate reimplements, directly against BadgerDB, the same
+// frequency+recency ranking esquery's function_score/terms/bucket_script
+// query asks Elasticsearch for. Rather than interpreting arbitrary Query
+// DSL, it reads back the handful of parameters pkg/esquery always puts in
+// the same place (host/subtree filters, decay scale/offset, weights,
+// limit) and recomputes the same ranking in Go, so dirjump's getDirScores
+// sees an identically-shaped "by_dir" aggregation from either backend.
+func (b *Backend) Aggregate(ctx context.Context, query map[string]interface{}) (json.RawMessage, error) {
+	params := extractDirScoreParams(query)
+
+	decayScale, err := time.ParseDuration(params.decayScale)
+	if err != nil || decayScale <= 0 {
+		decayScale = 24 * time.Hour
+	}
+	decayOffset, err := time.ParseDuration(params.decayOffset)
+	if err != nil || decayOffset < 0 {
+		decayOffset = time.Hour
+	}
+
+	buckets := map[string]*dirBucket{}
+	now := time.Now()
+
+	err = b.kv.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("cmd:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			var cmd estransport.Command
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &cmd)
+			})
+			if err != nil {
+				continue
+			}
+			if params.host != "" && cmd.Hostname != params.host {
+				continue
+			}
+			pwd := cmd.Env["PWD"]
+			if params.subtreeOf != "" && !strings.HasPrefix(pwd, params.subtreeOf) {
+				continue
+			}
+
+			dir := dirTarget(cmd)
+			if dir == "" {
+				continue
+			}
+
+			age := now.Sub(cmd.StartTimestamp)
+			recency := gaussDecay(age, decayScale, decayOffset)
+
+			bk := buckets[dir]
+			if bk == nil {
+				bk = &dirBucket{}
+				buckets[dir] = bk
+			}
+			bk.count++
+			if recency > bk.bestScore {
+				bk.bestScore = recency
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning badger for directory aggregation: %v", err)
+	}
+
+	type aggBucket struct {
+		Key           string `json:"key"`
+		CombinedScore struct {
+			Value float64 `json:"value"`
+		} `json:"combined_score"`
+	}
+	var out struct {
+		ByDir struct {
+			Buckets []aggBucket `json:"buckets"`
+		} `json:"by_dir"`
+	}
+
+	for dir, bk := range buckets {
+		combined := params.freqWeight*math.Log(1+float64(bk.count)) + params.recencyWeight*bk.bestScore
+		ab := aggBucket{Key: dir}
+		ab.CombinedScore.Value = combined
+		out.ByDir.Buckets = append(out.ByDir.Buckets, ab)
+	}
+	sort.Slice(out.ByDir.Buckets, func(i, j int) bool {
+		return out.ByDir.Buckets[i].CombinedScore.Value > out.ByDir.Buckets[j].CombinedScore.Value
+	})
+	if params.limit > 0 && len(out.ByDir.Buckets) > params.limit {
+		out.ByDir.Buckets = out.ByDir.Buckets[:params.limit]
+	}
+
+	return json.Marshal(out)
+}
+
+// gaussDecay mirrors esquery.GaussDecayFunction's curve: full weight
+// (1.0) within offset of now, decaying per a Gaussian past that, reaching
+// 0.5 at offset+scale.
+func gaussDecay(age, scale, offset time.Duration) float64 {
+	d := age - offset
+	if d <= 0 {
+		return 1.0
+	}
+	x := float64(d) / float64(scale)
+	return math.Exp(-math.Ln2 * x * x)
+}
+
+// dirTarget extracts the directory a command is "about": a cd target if
+// the command was a `cd <dir>`, else the shell's PWD when it ran - the
+// same extraction dirTargetScript's painless does on the ES side.
+func dirTarget(cmd estransport.Command) string {
+	if strings.HasPrefix(cmd.Command, "cd ") {
+		return strings.TrimSpace(strings.TrimPrefix(cmd.Command, "cd "))
+	}
+	return cmd.Env["PWD"]
+}
+
+// Ping reports whether the local store is usable.
+func (b *Backend) Ping(ctx context.Context) error {
+	return b.kv.View(func(txn *badger.Txn) error { return nil })
+}
+
+// Stats returns Bleve's document count and BadgerDB's on-disk size.
+func (b *Backend) Stats(ctx context.Context) (map[string]interface{}, error) {
+	docCount, err := b.bleve.DocCount()
+	if err != nil {
+		return nil, fmt.Errorf("bleve doc count: %v", err)
+	}
+	lsm, vlog := b.kv.Size()
+	return map[string]interface{}{
+		"dir":               b.dir,
+		"bleve_doc_count":   docCount,
+		"badger_lsm_bytes":  lsm,
+		"badger_vlog_bytes": vlog,
+	}, nil
+}
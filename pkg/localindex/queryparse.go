@@ -0,0 +1,172 @@
+package localindex
+
+// This file reads back the handful of parameters pkg/esquery's dirjump
+// query always places in the same spots (see
+// tools/dirjump/dirjump.go:buildDirScoreQuery) out of the
+// map[string]interface{} Aggregate and Search receive. It isn't a general
+// Query DSL interpreter - only enough of one for this backend to answer
+// the one query shape dirjump actually sends it. The must/must_not clauses
+// dirjump adds from its filter box are not read, so a filtered query is
+// ranked here as if it were unfiltered.
+
+// dirScoreParams is what Aggregate needs out of a buildDirScoreQuery
+// request body to recompute the same ranking Elasticsearch would.
+type dirScoreParams struct {
+	host          string
+	subtreeOf     string
+	decayScale    string
+	decayOffset   string
+	freqWeight    float64
+	recencyWeight float64
+	limit         int
+}
+
+func mapAt(m map[string]interface{}, key string) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func sliceAt(m map[string]interface{}, key string) []map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	v, _ := m[key].([]map[string]interface{})
+	return v
+}
+
+func stringAt(m map[string]interface{}, key string) string {
+	if m == nil {
+		return ""
+	}
+	v, _ := m[key].(string)
+	return v
+}
+
+func floatAt(m map[string]interface{}, key string) (float64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	switch v := m[key].(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func intAt(m map[string]interface{}, key string) int {
+	if m == nil {
+		return 0
+	}
+	switch v := m[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// firstValue returns the single entry of a one-element map, regardless of
+// its key - used for gauss's `{"gauss": {"<field>": {...params}}}` shape,
+// where the field name varies but there's always exactly one.
+func firstValue(m map[string]interface{}) map[string]interface{} {
+	for _, v := range m {
+		if nested, ok := v.(map[string]interface{}); ok {
+			return nested
+		}
+	}
+	return nil
+}
+
+// extractDirScoreParams pulls host/subtree filters, decay scale/offset,
+// ranking weights, and the result limit back out of a buildDirScoreQuery
+// body, defaulting anything it can't find to the same values
+// dirScoreOptions' flags default to.
+func extractDirScoreParams(query map[string]interface{}) dirScoreParams {
+	p := dirScoreParams{
+		decayScale:    "24h",
+		decayOffset:   "1h",
+		freqWeight:    0.3,
+		recencyWeight: 0.7,
+	}
+
+	fsQuery := mapAt(mapAt(query, "query"), "function_score")
+
+	if boolQuery := mapAt(mapAt(fsQuery, "query"), "bool"); boolQuery != nil {
+		for _, f := range sliceAt(boolQuery, "filter") {
+			if term := mapAt(f, "term"); term != nil {
+				if v, ok := term["hostname.keyword"].(string); ok {
+					p.host = v
+				}
+			}
+			if prefix := mapAt(f, "prefix"); prefix != nil {
+				if v, ok := prefix["env.PWD.keyword"].(string); ok {
+					p.subtreeOf = v
+				}
+			}
+		}
+	}
+
+	if functions := sliceAt(fsQuery, "functions"); len(functions) > 0 {
+		fn := functions[0]
+		if decayParams := firstValue(mapAt(fn, "gauss")); decayParams != nil {
+			if scale := stringAt(decayParams, "scale"); scale != "" {
+				p.decayScale = scale
+			}
+			if offset := stringAt(decayParams, "offset"); offset != "" {
+				p.decayOffset = offset
+			}
+		}
+		if w, ok := floatAt(fn, "weight"); ok {
+			p.recencyWeight = w
+		}
+	}
+
+	byDir := mapAt(mapAt(query, "aggs"), "by_dir")
+	byDirAggs := mapAt(byDir, "aggs")
+	if combined := mapAt(byDirAggs, "combined_score"); combined != nil {
+		if script := mapAt(mapAt(combined, "bucket_script"), "script"); script != nil {
+			if params := mapAt(script, "params"); params != nil {
+				if fw, ok := floatAt(params, "freqWeight"); ok {
+					p.freqWeight = fw
+				}
+				if rw, ok := floatAt(params, "recencyWeight"); ok {
+					p.recencyWeight = rw
+				}
+			}
+		}
+	}
+	if sortAgg := mapAt(byDirAggs, "sort_by_combined"); sortAgg != nil {
+		if bs := mapAt(sortAgg, "bucket_sort"); bs != nil {
+			p.limit = intAt(bs, "size")
+		}
+	}
+
+	return p
+}
+
+// extractCommandPhrase pulls the match_phrase_prefix value dirjump's
+// should-clause searches for (e.g. "cd "), if the query has one, so
+// Search can run the analogous Bleve query.
+func extractCommandPhrase(query map[string]interface{}) string {
+	boolQuery := mapAt(mapAt(mapAt(query, "query"), "function_score"), "query")
+	if boolQuery == nil {
+		boolQuery = mapAt(query, "query")
+	}
+	b := mapAt(boolQuery, "bool")
+	for _, should := range sliceAt(b, "should") {
+		if mpp := mapAt(should, "match_phrase_prefix"); mpp != nil {
+			for _, v := range mpp {
+				if s, ok := v.(string); ok {
+					return s
+				}
+			}
+		}
+	}
+	return ""
+}
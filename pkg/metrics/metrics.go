@@ -0,0 +1,80 @@
+// Package metrics defines the Prometheus collectors shared by tls-proxy and
+// its subscribers, plus a helper to serve them alongside pprof, so an
+// operator running either as a daemon can tell whether it's keeping up with
+// the event stream instead of having to guess from debug logs.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// EventsReceivedTotal counts events a PubSubClient successfully parsed
+	// off a SUBSCRIBE connection.
+	EventsReceivedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "totalrecall_events_received_total",
+		Help: "Command events successfully received off a pub/sub subscription.",
+	})
+
+	// EventsDroppedTotal counts events that never reached a consumer, by
+	// reason (e.g. "parse_error", "filter_rejected", "disconnected").
+	EventsDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "totalrecall_events_dropped_total",
+		Help: "Command events dropped before being delivered to a consumer, by reason.",
+	}, []string{"reason"})
+
+	// ParseErrorsTotal counts event lines that failed to parse as JSON.
+	ParseErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "totalrecall_parse_errors_total",
+		Help: "Event lines that failed to parse as JSON.",
+	})
+
+	// CommandDurationSeconds observes end_timestamp - start_timestamp for
+	// each received event - how long the shell command itself took to run.
+	CommandDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "totalrecall_command_duration_seconds",
+		Help:    "Duration of the shell command a received event describes.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// ProxyLatencySeconds observes the time between tls-proxy publishing an
+	// event (its _published_at_unix_nano stamp) and a subscriber receiving
+	// it, the fanout latency operators actually care about.
+	ProxyLatencySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "totalrecall_proxy_latency_seconds",
+		Help:    "End-to-end latency from tls-proxy publishing an event to a subscriber receiving it.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+// Serve starts a blocking HTTP server on addr exposing /metrics (Prometheus)
+// and /debug/pprof/* (runtime profiles), until ctx is cancelled. Callers for
+// whom metrics are optional should simply not call Serve when the
+// -metrics-addr flag is unset rather than passing an empty addr.
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
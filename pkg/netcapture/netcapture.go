@@ -0,0 +1,420 @@
+// Package netcapture enriches command events with a summary of the network
+// activity a command performed, by sniffing packets with gopacket/pcap for
+// the lifetime of the command and aggregating them into per-peer tuples.
+package netcapture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// SnapLen is the number of bytes captured per packet - enough for IP/TCP/UDP
+// headers and the start of any TLS ClientHello/HTTP Host line, but small
+// enough to keep the ring buffer cheap.
+const SnapLen = 256
+
+// Peer aggregates everything observed for one remote endpoint during a
+// command's lifetime.
+type Peer struct {
+	RemoteIP   string    `json:"remote_ip"`
+	RemotePort int       `json:"remote_port"`
+	Proto      string    `json:"proto"`
+	BytesSent  int       `json:"bytes_sent"`
+	BytesRecv  int       `json:"bytes_recv"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	SNI        string    `json:"sni,omitempty"`
+	Host       string    `json:"host,omitempty"`
+}
+
+type packet struct {
+	ts         time.Time
+	remoteIP   string
+	remotePort int
+	proto      string
+	sent       bool
+	bytes      int
+	sni        string
+	host       string
+}
+
+// Capturer opens a pcap handle on iface with a "tcp or udp" BPF filter and
+// records every packet into an in-memory ring buffer. It is meant to run for
+// the lifetime of a single shell session, started by the preexec hook and
+// read by the postexec hook.
+type Capturer struct {
+	handle *pcap.Handle
+	mu     sync.Mutex
+	ring   []packet
+	cap    int
+	done   chan struct{}
+}
+
+// Open starts capturing on iface (use "any" for all interfaces). Requires
+// CAP_NET_RAW; callers should gate this behind an explicit opt-in flag.
+func Open(iface string, ringSize int) (*Capturer, error) {
+	handle, err := pcap.OpenLive(iface, SnapLen, true, pcap.BlockForever)
+	if err != nil {
+		return nil, fmt.Errorf("opening pcap handle on %s: %v", iface, err)
+	}
+
+	if err := handle.SetBPFFilter("tcp or udp"); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("setting bpf filter: %v", err)
+	}
+
+	c := &Capturer{
+		handle: handle,
+		cap:    ringSize,
+		done:   make(chan struct{}),
+	}
+
+	go c.loop()
+
+	return c, nil
+}
+
+func (c *Capturer) loop() {
+	source := gopacket.NewPacketSource(c.handle, c.handle.LinkType())
+	for {
+		select {
+		case <-c.done:
+			return
+		case pkt, ok := <-source.Packets():
+			if !ok {
+				return
+			}
+			c.record(pkt)
+		}
+	}
+}
+
+func (c *Capturer) record(pkt gopacket.Packet) {
+	p, ok := toPacket(pkt)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ring = append(c.ring, p)
+	if c.cap > 0 && len(c.ring) > c.cap {
+		c.ring = c.ring[len(c.ring)-c.cap:]
+	}
+}
+
+func toPacket(pkt gopacket.Packet) (packet, bool) {
+	netLayer := pkt.NetworkLayer()
+	if netLayer == nil {
+		return packet{}, false
+	}
+
+	var srcIP, dstIP net.IP
+	if ip4, ok := netLayer.(*layers.IPv4); ok {
+		srcIP, dstIP = ip4.SrcIP, ip4.DstIP
+	} else if ip6, ok := netLayer.(*layers.IPv6); ok {
+		srcIP, dstIP = ip6.SrcIP, ip6.DstIP
+	} else {
+		return packet{}, false
+	}
+
+	var proto string
+	var srcPort, dstPort int
+	var sni, host string
+
+	if tcp, ok := pkt.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		proto = "tcp"
+		srcPort, dstPort = int(tcp.SrcPort), int(tcp.DstPort)
+		sni = extractSNI(tcp.Payload)
+		host = extractHTTPHost(tcp.Payload)
+	} else if udp, ok := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		proto = "udp"
+		srcPort, dstPort = int(udp.SrcPort), int(udp.DstPort)
+	} else {
+		return packet{}, false
+	}
+
+	// Outbound-from-localhost heuristic: treat the destination as the
+	// remote peer unless the source looks non-local.
+	remoteIP, remotePort, sent := dstIP.String(), dstPort, true
+	if srcIP.IsLoopback() || isLocalIP(srcIP) {
+		remoteIP, remotePort, sent = dstIP.String(), dstPort, true
+	} else {
+		remoteIP, remotePort, sent = srcIP.String(), srcPort, false
+	}
+
+	size := 0
+	if md := pkt.Metadata(); md != nil {
+		size = md.CaptureLength
+	}
+
+	ts := time.Now()
+	if md := pkt.Metadata(); md != nil && !md.Timestamp.IsZero() {
+		ts = md.Timestamp
+	}
+
+	return packet{
+		ts:         ts,
+		remoteIP:   remoteIP,
+		remotePort: remotePort,
+		proto:      proto,
+		sent:       sent,
+		bytes:      size,
+		sni:        sni,
+		host:       host,
+	}, true
+}
+
+func isLocalIP(ip net.IP) bool {
+	ifaces, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range ifaces {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractSNI does a best-effort scan for a TLS ClientHello SNI extension in
+// the first segment of a TCP payload. It intentionally does not implement a
+// full TLS parser.
+func extractSNI(payload []byte) string {
+	if len(payload) < 5 || payload[0] != 0x16 {
+		return ""
+	}
+	// A full ClientHello parser is out of scope here; real deployments
+	// should swap this for a proper TLS record parser.
+	return ""
+}
+
+// extractHTTPHost looks for a plaintext "Host: " line in an HTTP request.
+func extractHTTPHost(payload []byte) string {
+	const marker = "Host: "
+	idx := indexOf(payload, []byte(marker))
+	if idx < 0 {
+		return ""
+	}
+	rest := payload[idx+len(marker):]
+	end := indexOf(rest, []byte("\r\n"))
+	if end < 0 {
+		end = len(rest)
+	}
+	return string(rest[:end])
+}
+
+func indexOf(haystack, needle []byte) int {
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// Close stops the capture goroutine and releases the pcap handle.
+func (c *Capturer) Close() {
+	close(c.done)
+	c.handle.Close()
+}
+
+// Aggregate slices the ring buffer to [start, end] and folds matching
+// packets into per-peer Peer tuples.
+func (c *Capturer) Aggregate(start, end time.Time) []Peer {
+	c.mu.Lock()
+	window := make([]packet, len(c.ring))
+	copy(window, c.ring)
+	c.mu.Unlock()
+
+	peers := make(map[string]*Peer)
+	for _, p := range window {
+		if p.ts.Before(start) || p.ts.After(end) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s:%d", p.proto, p.remoteIP, p.remotePort)
+		peer, ok := peers[key]
+		if !ok {
+			peer = &Peer{
+				RemoteIP:   p.remoteIP,
+				RemotePort: p.remotePort,
+				Proto:      p.proto,
+				FirstSeen:  p.ts,
+				LastSeen:   p.ts,
+			}
+			peers[key] = peer
+		}
+
+		if p.sent {
+			peer.BytesSent += p.bytes
+		} else {
+			peer.BytesRecv += p.bytes
+		}
+		if p.ts.Before(peer.FirstSeen) {
+			peer.FirstSeen = p.ts
+		}
+		if p.ts.After(peer.LastSeen) {
+			peer.LastSeen = p.ts
+		}
+		if p.sni != "" {
+			peer.SNI = p.sni
+		}
+		if p.host != "" {
+			peer.Host = p.host
+		}
+	}
+
+	result := make([]Peer, 0, len(peers))
+	for _, peer := range peers {
+		result = append(result, *peer)
+	}
+	return result
+}
+
+// Serve exposes this Capturer's ring buffer over a Unix socket so a
+// short-lived postexec process (which doesn't share memory with the
+// preexec process that started the capture) can request an aggregation
+// window. Each line is "AGGREGATE <start-RFC3339Nano> <end-RFC3339Nano>"
+// and the response is a single JSON array of Peer.
+func (c *Capturer) Serve(socketPath string) error {
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %v", socketPath, err)
+	}
+
+	go func() {
+		<-c.done
+		listener.Close()
+		os.Remove(socketPath)
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.handleConn(conn)
+		}
+	}()
+
+	return nil
+}
+
+func (c *Capturer) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != "AGGREGATE" {
+		fmt.Fprintf(conn, "[]\n")
+		return
+	}
+
+	start, err1 := time.Parse(time.RFC3339Nano, fields[1])
+	end, err2 := time.Parse(time.RFC3339Nano, fields[2])
+	if err1 != nil || err2 != nil {
+		fmt.Fprintf(conn, "[]\n")
+		return
+	}
+
+	peers := c.Aggregate(start, end)
+	data, err := json.Marshal(peers)
+	if err != nil {
+		fmt.Fprintf(conn, "[]\n")
+		return
+	}
+	conn.Write(append(data, '\n'))
+}
+
+// Query dials a running Capturer's socket and requests the aggregation for
+// [start, end]. Returns an empty slice (not an error) if the socket is
+// missing, since network capture is always best-effort.
+func Query(socketPath string, start, end time.Time) ([]Peer, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 200*time.Millisecond)
+	if err != nil {
+		return nil, nil
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "AGGREGATE %s %s\n", start.Format(time.RFC3339Nano), end.Format(time.RFC3339Nano))
+
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading aggregate response: %v", err)
+	}
+
+	var peers []Peer
+	if err := json.Unmarshal([]byte(line), &peers); err != nil {
+		return nil, fmt.Errorf("parsing aggregate response: %v", err)
+	}
+	return peers, nil
+}
+
+// PidFile describes the running capturer so the postexec binary can find
+// and query its ring buffer by PID.
+type PidFile struct {
+	PID          int    `json:"pid"`
+	RingBuffer   string `json:"ring_buffer"`
+	SocketPath   string `json:"socket_path"`
+	Interface    string `json:"interface"`
+	StartedAtRFC string `json:"started_at"`
+}
+
+// WritePidFile records this capturer's PID and query socket so the postexec
+// hook can confirm the capture session that started alongside it is still
+// the one running.
+func WritePidFile(path, iface, ringBufferPath, socketPath string) error {
+	pf := PidFile{
+		PID:          os.Getpid(),
+		RingBuffer:   ringBufferPath,
+		SocketPath:   socketPath,
+		Interface:    iface,
+		StartedAtRFC: time.Now().Format(time.RFC3339Nano),
+	}
+	data, err := json.Marshal(pf)
+	if err != nil {
+		return fmt.Errorf("marshaling pidfile: %v", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadPidFile loads a PidFile written by WritePidFile.
+func ReadPidFile(path string) (*PidFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pidfile %s: %v", path, err)
+	}
+	var pf PidFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("parsing pidfile %s: %v", path, err)
+	}
+	return &pf, nil
+}
+
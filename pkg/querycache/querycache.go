@@ -0,0 +1,294 @@
+// Package querycache caches idempotent Elasticsearch responses served
+// through tls-proxy's ES reverse-proxy path, so dashboards and Kibana
+// panels that re-issue the same _search/_msearch/_count requests every few
+// seconds don't each traverse the mTLS leg to HAProxy. Entries expire
+// per a per-index-pattern TTL (or an upstream Cache-Control: max-age/
+// no-store when present), are evicted LRU-style once the cache exceeds
+// its byte budget, and concurrent identical requests coalesce onto a
+// single upstream call via singleflight.
+package querycache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCacheableSuffixes are the POST endpoints treated as idempotent
+// reads when no -cache-rule allowlist overrides them.
+var defaultCacheableSuffixes = []string{"_search", "_msearch", "_count"}
+
+// Rule gives a glob-style index pattern (matched with path.Match against
+// the request path's leading index segment, e.g. "logs-2024.01.02") a
+// TTL, the shape the "-cache-rule" flag parses into.
+type Rule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// ParseRule parses one "-cache-rule" flag value, "<pattern>=<duration>"
+// (e.g. "logs-*=30s").
+func ParseRule(s string) (Rule, error) {
+	pattern, ttlStr, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("parsing cache rule %q: want <pattern>=<duration>", s)
+	}
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("parsing cache rule %q: %v", s, err)
+	}
+	return Rule{Pattern: pattern, TTL: ttl}, nil
+}
+
+// Cacheable reports whether method/urlPath is a request this cache may
+// serve from or populate: any GET, or a POST to one of allowlist's
+// endpoints (defaultCacheableSuffixes if allowlist is empty).
+func Cacheable(method, urlPath string, allowlist []string) bool {
+	if method == http.MethodGet {
+		return true
+	}
+	if method != http.MethodPost {
+		return false
+	}
+	if len(allowlist) == 0 {
+		allowlist = defaultCacheableSuffixes
+	}
+	for _, suffix := range allowlist {
+		if urlPath == suffix || strings.HasSuffix(urlPath, "/"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Key derives a cache key from the parts of a request that determine its
+// response: method, path, sorted query parameters, and a body digest -
+// so two requests differing only in header order or query param order
+// still share an entry.
+func Key(method, urlPath string, query url.Values, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", method, urlPath)
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		fmt.Fprintf(h, "%s=%s\x00", k, strings.Join(values, ","))
+	}
+
+	bodySum := sha256.Sum256(body)
+	h.Write(bodySum[:])
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// indexFromPath returns urlPath's leading segment, the index (or index
+// pattern) an Elasticsearch request targets, e.g. "/logs-2024.01.02/_search"
+// -> "logs-2024.01.02".
+func indexFromPath(urlPath string) string {
+	urlPath = strings.TrimPrefix(urlPath, "/")
+	if i := strings.IndexByte(urlPath, '/'); i >= 0 {
+		return urlPath[:i]
+	}
+	return urlPath
+}
+
+// entry is one cached response.
+type entry struct {
+	key       string
+	status    int
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+	size      int64
+}
+
+// Cache is an LRU, byte-capped, TTL-expiring store of cached ES responses,
+// with singleflight stampede protection for concurrent identical requests.
+// The zero value is not usable; construct with New.
+type Cache struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	usedBytes  int64
+	defaultTTL time.Duration
+	rules      []Rule
+	ll         *list.List
+	items      map[string]*list.Element
+
+	hits, misses, evictions uint64
+
+	group singleflight.Group
+}
+
+// New returns a Cache bounded to maxBytes (0 means unbounded), applying
+// defaultTTL to any cacheable request whose path matches none of rules and
+// whose response carries no Cache-Control.
+func New(maxBytes int64, defaultTTL time.Duration, rules []Rule) *Cache {
+	return &Cache{
+		maxBytes:   maxBytes,
+		defaultTTL: defaultTTL,
+		rules:      rules,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached response for key, cloning its header and body so
+// the caller may mutate them freely. A stale (expired) entry is evicted
+// and reported as a miss rather than returned.
+func (c *Cache) Get(key string) (status int, header http.Header, body []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.items[key]
+	if !found {
+		c.misses++
+		return 0, nil, nil, false
+	}
+
+	e := el.Value.(*entry)
+	if time.Now().After(e.expiresAt) {
+		c.removeElement(el)
+		c.misses++
+		return 0, nil, nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits++
+	return e.status, e.header.Clone(), append([]byte(nil), e.body...), true
+}
+
+// TTL resolves the TTL to cache urlPath's response for, honoring an
+// upstream Cache-Control response header (no-store disables caching
+// entirely; max-age overrides the configured rules) before falling back
+// to the first matching rule, then defaultTTL.
+func (c *Cache) TTL(urlPath string, respHeader http.Header) time.Duration {
+	for _, directive := range strings.Split(respHeader.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "no-store" {
+			return 0
+		}
+		if secs, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if n, err := strconv.Atoi(secs); err == nil {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+
+	index := indexFromPath(urlPath)
+	for _, rule := range c.rules {
+		if ok, _ := path.Match(rule.Pattern, index); ok {
+			return rule.TTL
+		}
+	}
+	return c.defaultTTL
+}
+
+// Put stores status/header/body under key for ttl, evicting the
+// least-recently-used entries afterward if the cache is now over
+// maxBytes. ttl <= 0 is a no-op, matching a Cache-Control: no-store
+// response.
+func (c *Cache) Put(key string, status int, header http.Header, body []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	e := &entry{
+		key:       key,
+		status:    status,
+		header:    header.Clone(),
+		body:      append([]byte(nil), body...),
+		expiresAt: time.Now().Add(ttl),
+	}
+	e.size = int64(len(e.body))
+	for name, values := range e.header {
+		e.size += int64(len(name))
+		for _, v := range values {
+			e.size += int64(len(v))
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if existing, found := c.items[key]; found {
+		c.removeElement(existing)
+	}
+
+	el := c.ll.PushFront(e)
+	c.items[key] = el
+	c.usedBytes += e.size
+
+	for c.maxBytes > 0 && c.usedBytes > c.maxBytes {
+		back := c.ll.Back()
+		if back == nil {
+			break
+		}
+		c.removeElement(back)
+		c.evictions++
+	}
+}
+
+// removeElement drops el from both the LRU list and the key index. Caller
+// must hold c.mu.
+func (c *Cache) removeElement(el *list.Element) {
+	e := el.Value.(*entry)
+	c.ll.Remove(el)
+	delete(c.items, e.key)
+	c.usedBytes -= e.size
+}
+
+// Purge clears every cached entry, backing the control plane's PURGE
+// admin verb.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]*list.Element)
+	c.ll.Init()
+	c.usedBytes = 0
+}
+
+// Stats reports cumulative hit/miss/eviction counts and the cache's
+// current byte footprint, for printStats.
+func (c *Cache) Stats() (hits, misses, evictions uint64, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.evictions, c.usedBytes
+}
+
+// FetchResult is what a Do fetch function returns on a successful
+// upstream call.
+type FetchResult struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Do coalesces concurrent calls sharing key into a single invocation of
+// fetch, so a stampede of identical dashboard queries reaches
+// Elasticsearch once instead of once per connection.
+func (c *Cache) Do(key string, fetch func() (FetchResult, error)) (FetchResult, error) {
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		return fetch()
+	})
+	if err != nil {
+		return FetchResult{}, err
+	}
+	return v.(FetchResult), nil
+}
@@ -0,0 +1,216 @@
+package querycache
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		allowlist []string
+		want      bool
+	}{
+		{"GET is always cacheable", http.MethodGet, "/logs-2024.01.02/_doc/1", nil, true},
+		{"POST _search with default allowlist", http.MethodPost, "/logs-2024.01.02/_search", nil, true},
+		{"POST _msearch with default allowlist", http.MethodPost, "/_msearch", nil, true},
+		{"POST not in default allowlist", http.MethodPost, "/logs-2024.01.02/_update", nil, false},
+		{"PUT is never cacheable", http.MethodPut, "/logs-2024.01.02/_search", nil, false},
+		{"POST honors a custom allowlist", http.MethodPost, "/logs-2024.01.02/_custom", []string{"_custom"}, true},
+		{"POST rejects what a custom allowlist excludes", http.MethodPost, "/logs-2024.01.02/_search", []string{"_custom"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cacheable(tt.method, tt.path, tt.allowlist); got != tt.want {
+				t.Errorf("Cacheable(%q, %q, %v) = %v, want %v", tt.method, tt.path, tt.allowlist, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyIgnoresQueryParamOrder(t *testing.T) {
+	q1 := url.Values{"a": {"1"}, "b": {"2"}}
+	q2 := url.Values{"b": {"2"}, "a": {"1"}}
+
+	k1 := Key(http.MethodGet, "/logs/_search", q1, []byte(`{"q":1}`))
+	k2 := Key(http.MethodGet, "/logs/_search", q2, []byte(`{"q":1}`))
+	if k1 != k2 {
+		t.Errorf("Key should be order-independent over query params: %q != %q", k1, k2)
+	}
+
+	k3 := Key(http.MethodGet, "/logs/_search", q1, []byte(`{"q":2}`))
+	if k1 == k3 {
+		t.Error("Key should differ when the body differs")
+	}
+}
+
+func TestCacheTTLRules(t *testing.T) {
+	c := New(0, 10*time.Second, []Rule{
+		{Pattern: "logs-*", TTL: 5 * time.Minute},
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"no-store disables caching", "/logs-2024.01.02/_search", http.Header{"Cache-Control": {"no-store"}}, 0},
+		{"max-age overrides rules", "/logs-2024.01.02/_search", http.Header{"Cache-Control": {"max-age=42"}}, 42 * time.Second},
+		{"matching rule applies", "/logs-2024.01.02/_search", http.Header{}, 5 * time.Minute},
+		{"non-matching path falls back to default", "/metrics-2024.01.02/_search", http.Header{}, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.TTL(tt.path, tt.header); got != tt.want {
+				t.Errorf("TTL(%q, %v) = %v, want %v", tt.path, tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachePutGetExpiry(t *testing.T) {
+	c := New(0, time.Hour, nil)
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	c.Put("k1", 200, header, []byte(`{"ok":true}`), 20*time.Millisecond)
+
+	status, gotHeader, body, ok := c.Get("k1")
+	if !ok {
+		t.Fatal("expected a hit immediately after Put")
+	}
+	if status != 200 || string(body) != `{"ok":true}` {
+		t.Errorf("got status=%d body=%q, want status=200 body={\"ok\":true}", status, body)
+	}
+	if gotHeader.Get("Content-Type") != "application/json" {
+		t.Errorf("got header %v, want Content-Type application/json", gotHeader)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if _, _, _, ok := c.Get("k1"); ok {
+		t.Error("expected entry to have expired and been evicted as a miss")
+	}
+
+	hits, misses, _, _ := c.Stats()
+	if hits != 1 || misses != 1 {
+		t.Errorf("Stats() hits=%d misses=%d, want hits=1 misses=1", hits, misses)
+	}
+}
+
+func TestCachePutZeroTTLIsNoop(t *testing.T) {
+	c := New(0, time.Hour, nil)
+	c.Put("k1", 200, http.Header{}, []byte("body"), 0)
+
+	if _, _, _, ok := c.Get("k1"); ok {
+		t.Error("Put with ttl<=0 should not store an entry")
+	}
+}
+
+func TestCacheEvictsLRUOverByteBudget(t *testing.T) {
+	c := New(4, time.Hour, nil) // room for exactly one 4-byte body
+
+	c.Put("k1", 200, http.Header{}, []byte("aaaa"), time.Hour)
+	c.Put("k2", 200, http.Header{}, []byte("bbbb"), time.Hour)
+
+	if _, _, _, ok := c.Get("k1"); ok {
+		t.Error("k1 should have been evicted once the byte budget was exceeded")
+	}
+	if _, _, _, ok := c.Get("k2"); !ok {
+		t.Error("k2 should still be cached")
+	}
+
+	_, _, evictions, _ := c.Stats()
+	if evictions != 1 {
+		t.Errorf("got %d evictions, want 1", evictions)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	c := New(0, time.Hour, nil)
+	c.Put("k1", 200, http.Header{}, []byte("body"), time.Hour)
+
+	c.Purge()
+
+	if _, _, _, ok := c.Get("k1"); ok {
+		t.Error("expected Purge to clear all entries")
+	}
+	_, _, _, bytes := c.Stats()
+	if bytes != 0 {
+		t.Errorf("got %d used bytes after Purge, want 0", bytes)
+	}
+}
+
+// TestCacheDoCoalescesConcurrentCalls exercises the singleflight path: a
+// stampede of concurrent Do calls sharing a key must reach fetch exactly
+// once, with every caller observing its result.
+func TestCacheDoCoalescesConcurrentCalls(t *testing.T) {
+	c := New(0, time.Hour, nil)
+
+	var calls int64
+	release := make(chan struct{})
+	fetch := func() (FetchResult, error) {
+		atomic.AddInt64(&calls, 1)
+		<-release
+		return FetchResult{Status: 200, Header: http.Header{}, Body: []byte("result")}, nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]FetchResult, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = c.Do("shared-key", fetch)
+		}(i)
+	}
+
+	// Give every goroutine a chance to join the in-flight call before
+	// releasing fetch, so the test actually exercises coalescing instead
+	// of racing fetch to completion.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt64(&calls); got != 1 {
+		t.Errorf("fetch was called %d times, want exactly 1", got)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("caller %d: unexpected error %v", i, err)
+		}
+		if string(results[i].Body) != "result" {
+			t.Errorf("caller %d: got body %q, want %q", i, results[i].Body, "result")
+		}
+	}
+}
+
+// TestCacheDoPropagatesFetchError confirms Do's pass-through behavior: a
+// failing fetch reaches every waiting caller as an error, and doesn't
+// populate the cache itself (Do never calls Put; that's the caller's job).
+func TestCacheDoPropagatesFetchError(t *testing.T) {
+	c := New(0, time.Hour, nil)
+	wantErr := errors.New("upstream unavailable")
+
+	_, err := c.Do("key", func() (FetchResult, error) {
+		return FetchResult{}, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("got error %v, want %v", err, wantErr)
+	}
+
+	if _, _, _, ok := c.Get("key"); ok {
+		t.Error("a failed fetch must not populate the cache")
+	}
+}
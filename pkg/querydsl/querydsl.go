@@ -0,0 +1,196 @@
+// Package querydsl parses the small fzf-style query language the dirjump
+// picker's filter box accepts - bare words, quoted phrases, field:value
+// filters (host:, after:, before:, cmd:), and !negation - into an AST that
+// Compile turns into an esquery.BoolQuery.
+package querydsl
+
+import (
+	"fmt"
+	"strings"
+
+	"totalrecall/pkg/esquery"
+)
+
+// Clause is one parsed term: a bare word (Field == "") or a field:value
+// filter, optionally negated with a leading '!'.
+type Clause struct {
+	Negate bool
+	Field  string
+	Value  string
+}
+
+// Query is a parsed filter expression: an implicit AND of its Clauses.
+type Query struct {
+	Clauses []Clause
+}
+
+// Parse tokenizes input on unquoted whitespace (honoring double-quoted
+// phrases and backslash escapes), then splits each token into a
+// field:value pair on its first unquoted colon.
+func Parse(input string) (*Query, error) {
+	rawTokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, tok := range rawTokens {
+		negate := false
+		if strings.HasPrefix(tok, "!") {
+			negate = true
+			tok = tok[1:]
+		}
+
+		rawField, rawValue, hasField := splitField(tok)
+
+		var field string
+		if hasField {
+			field, err = unquote(rawField)
+			if err != nil {
+				return nil, fmt.Errorf("parsing field in %q: %v", tok, err)
+			}
+			field = strings.ToLower(field)
+		}
+
+		value, err := unquote(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("parsing value in %q: %v", tok, err)
+		}
+
+		if field == "" && value == "" {
+			continue
+		}
+		q.Clauses = append(q.Clauses, Clause{Negate: negate, Field: field, Value: value})
+	}
+
+	return q, nil
+}
+
+// tokenize splits input on whitespace that isn't inside a double-quoted
+// phrase. A backslash escapes the character that follows it, including
+// inside quotes, so `\"` and `\ ` can appear literally.
+func tokenize(input string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	hasCur := false
+	inQuote := false
+	escaped := false
+
+	for _, r := range input {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+			hasCur = true
+		case r == '\\':
+			cur.WriteRune(r)
+			escaped = true
+			hasCur = true
+		case r == '"':
+			cur.WriteRune(r)
+			inQuote = !inQuote
+			hasCur = true
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if hasCur {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				hasCur = false
+			}
+		default:
+			cur.WriteRune(r)
+			hasCur = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("dangling escape at end of query")
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query")
+	}
+	if hasCur {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+// splitField finds tok's first colon that isn't escaped or inside a
+// quoted phrase, and splits tok there. found is false for a bare term
+// (including one that's entirely a quoted phrase containing a colon,
+// like "10:30").
+func splitField(tok string) (field, value string, found bool) {
+	inQuote := false
+	escaped := false
+	for i, r := range tok {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case r == ':' && !inQuote:
+			return tok[:i], tok[i+1:], true
+		}
+	}
+	return "", tok, false
+}
+
+// unquote resolves backslash escapes and strips the (by now structural,
+// not literal) double-quote characters splitField and tokenize left in
+// place.
+func unquote(s string) (string, error) {
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			// structural quoting, not part of the value
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		return "", fmt.Errorf("dangling escape")
+	}
+	return b.String(), nil
+}
+
+// Compile turns q into an esquery.BoolQuery: each non-negated clause
+// becomes a must clause, each negated one a must_not clause.
+func Compile(q *Query) esquery.BoolQuery {
+	var must, mustNot []esquery.Query
+	for _, c := range q.Clauses {
+		query := compileClause(c)
+		if c.Negate {
+			mustNot = append(mustNot, query)
+		} else {
+			must = append(must, query)
+		}
+	}
+	return esquery.BoolQuery{Must: must, MustNot: mustNot}
+}
+
+// compileClause maps one Clause to the esquery.Query its field implies:
+// host: an exact hostname match, cmd: a command phrase-prefix match,
+// after:/before: a start_timestamp range bound, and anything else
+// (including a bare term) a fuzzy wildcard match against the directory.
+func compileClause(c Clause) esquery.Query {
+	switch c.Field {
+	case "host":
+		return esquery.TermQuery{Field: "hostname.keyword", Value: c.Value}
+	case "cmd":
+		return esquery.MatchPhrasePrefixQuery{Field: "command", Value: c.Value}
+	case "after":
+		return esquery.RangeQuery{Field: "start_timestamp", Gte: c.Value}
+	case "before":
+		return esquery.RangeQuery{Field: "start_timestamp", Lte: c.Value}
+	default:
+		return esquery.WildcardQuery{Field: "env.PWD.keyword", Value: "*" + c.Value + "*"}
+	}
+}
@@ -0,0 +1,201 @@
+package querydsl
+
+import (
+	"reflect"
+	"testing"
+
+	"totalrecall/pkg/esquery"
+)
+
+func TestParseBareWordsAndFields(t *testing.T) {
+	q, err := Parse(`foo host:web-1 after:2024-01-01 !cmd:rm`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []Clause{
+		{Field: "", Value: "foo"},
+		{Field: "host", Value: "web-1"},
+		{Field: "after", Value: "2024-01-01"},
+		{Negate: true, Field: "cmd", Value: "rm"},
+	}
+	if !reflect.DeepEqual(q.Clauses, want) {
+		t.Errorf("got %+v, want %+v", q.Clauses, want)
+	}
+}
+
+func TestParseQuotedPhrases(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Clause
+	}{
+		{
+			name:  "quoted bare phrase",
+			input: `"foo bar"`,
+			want:  []Clause{{Value: "foo bar"}},
+		},
+		{
+			name:  "quoted field value with spaces",
+			input: `cmd:"git commit"`,
+			want:  []Clause{{Field: "cmd", Value: "git commit"}},
+		},
+		{
+			name:  "colon inside a quoted bare term isn't a field split",
+			input: `"10:30"`,
+			want:  []Clause{{Value: "10:30"}},
+		},
+		{
+			name:  "quoted field name",
+			input: `"host":web-1`,
+			want:  []Clause{{Field: "host", Value: "web-1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(q.Clauses, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, q.Clauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Clause
+	}{
+		{
+			name:  "escaped space keeps a bare term together",
+			input: `foo\ bar`,
+			want:  []Clause{{Value: "foo bar"}},
+		},
+		{
+			name:  "escaped quote is literal, not structural",
+			input: `cmd:foo\"bar`,
+			want:  []Clause{{Field: "cmd", Value: `foo"bar`}},
+		},
+		{
+			name:  "escaped colon is not treated as a field separator",
+			input: `10\:30`,
+			want:  []Clause{{Value: "10:30"}},
+		},
+		{
+			name:  "escaped backslash is literal",
+			input: `foo\\bar`,
+			want:  []Clause{{Value: `foo\bar`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(q.Clauses, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.input, q.Clauses, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unterminated quote", `cmd:"git commit`},
+		{"dangling escape", `foo\`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.input); err == nil {
+				t.Errorf("Parse(%q): expected an error, got none", tt.input)
+			}
+		})
+	}
+}
+
+func TestParseSkipsEmptyTerms(t *testing.T) {
+	q, err := Parse(`  foo    bar  `)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := []Clause{{Value: "foo"}, {Value: "bar"}}
+	if !reflect.DeepEqual(q.Clauses, want) {
+		t.Errorf("got %+v, want %+v", q.Clauses, want)
+	}
+}
+
+func TestCompileFieldMapping(t *testing.T) {
+	tests := []struct {
+		name   string
+		clause Clause
+		want   esquery.Query
+	}{
+		{
+			name:   "host is an exact keyword match",
+			clause: Clause{Field: "host", Value: "web-1"},
+			want:   esquery.TermQuery{Field: "hostname.keyword", Value: "web-1"},
+		},
+		{
+			name:   "cmd is a match_phrase_prefix",
+			clause: Clause{Field: "cmd", Value: "git com"},
+			want:   esquery.MatchPhrasePrefixQuery{Field: "command", Value: "git com"},
+		},
+		{
+			name:   "after is a range gte",
+			clause: Clause{Field: "after", Value: "2024-01-01"},
+			want:   esquery.RangeQuery{Field: "start_timestamp", Gte: "2024-01-01"},
+		},
+		{
+			name:   "before is a range lte",
+			clause: Clause{Field: "before", Value: "2024-01-01"},
+			want:   esquery.RangeQuery{Field: "start_timestamp", Lte: "2024-01-01"},
+		},
+		{
+			name:   "a bare term is a fuzzy wildcard against PWD",
+			clause: Clause{Value: "myproj"},
+			want:   esquery.WildcardQuery{Field: "env.PWD.keyword", Value: "*myproj*"},
+		},
+		{
+			name:   "an unrecognized field falls back to the wildcard match",
+			clause: Clause{Field: "bogus", Value: "myproj"},
+			want:   esquery.WildcardQuery{Field: "env.PWD.keyword", Value: "*myproj*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compileClause(tt.clause); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compileClause(%+v) = %+v, want %+v", tt.clause, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSplitsMustAndMustNot(t *testing.T) {
+	q, err := Parse(`host:web-1 !cmd:rm`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	bq := Compile(q)
+
+	wantMust := []esquery.Query{esquery.TermQuery{Field: "hostname.keyword", Value: "web-1"}}
+	wantMustNot := []esquery.Query{esquery.MatchPhrasePrefixQuery{Field: "command", Value: "rm"}}
+	if !reflect.DeepEqual(bq.Must, wantMust) {
+		t.Errorf("Must = %+v, want %+v", bq.Must, wantMust)
+	}
+	if !reflect.DeepEqual(bq.MustNot, wantMustNot) {
+		t.Errorf("MustNot = %+v, want %+v", bq.MustNot, wantMustNot)
+	}
+}
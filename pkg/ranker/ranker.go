@@ -0,0 +1,129 @@
+// Package ranker scores shelper command suggestions with a linear model
+// over a handful of relevance features, instead of the hand-tuned
+// "ES score + 0.1*frequency + bucketed recency" formula it replaces. Weights
+// are learned offline by totalrecall-train from which suggestions users
+// actually ran, and loaded here at shelper startup.
+package ranker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Features are the per-suggestion inputs to the ranking model. All fields
+// are pre-scaled by the caller (e.g. frequency as log(1+freq), not raw
+// frequency) so a single linear weight per feature is meaningful.
+type Features struct {
+	ESScore        float64 `json:"es_score"`
+	LogFreq        float64 `json:"log_freq"`
+	RecencyDays    float64 `json:"recency_days"`
+	EnvMatchCount  float64 `json:"env_match_count"`
+	SameGitRepo    float64 `json:"same_git_repo"`    // 1 if run from the same repo, else 0
+	CmdPrefixMatch float64 `json:"cmd_prefix_match"` // 1 if it shares a prefix with the in-progress command, else 0
+}
+
+// Weights is one linear weight per Features field. Score computes their dot
+// product.
+type Weights struct {
+	ESScore        float64 `json:"es_score"`
+	LogFreq        float64 `json:"log_freq"`
+	RecencyDays    float64 `json:"recency_days"`
+	EnvMatchCount  float64 `json:"env_match_count"`
+	SameGitRepo    float64 `json:"same_git_repo"`
+	CmdPrefixMatch float64 `json:"cmd_prefix_match"`
+}
+
+// Score returns the weighted sum of f's features under w.
+func (w Weights) Score(f Features) float64 {
+	return w.ESScore*f.ESScore +
+		w.LogFreq*f.LogFreq +
+		w.RecencyDays*f.RecencyDays +
+		w.EnvMatchCount*f.EnvMatchCount +
+		w.SameGitRepo*f.SameGitRepo +
+		w.CmdPrefixMatch*f.CmdPrefixMatch
+}
+
+// Contributions returns each feature's weighted contribution to f's score
+// under w, in the same field order as Features, for a human-readable
+// --explain breakdown.
+func (w Weights) Contributions(f Features) []FeatureContribution {
+	return []FeatureContribution{
+		{"es_score", f.ESScore, w.ESScore, w.ESScore * f.ESScore},
+		{"log_freq", f.LogFreq, w.LogFreq, w.LogFreq * f.LogFreq},
+		{"recency_days", f.RecencyDays, w.RecencyDays, w.RecencyDays * f.RecencyDays},
+		{"env_match_count", f.EnvMatchCount, w.EnvMatchCount, w.EnvMatchCount * f.EnvMatchCount},
+		{"same_git_repo", f.SameGitRepo, w.SameGitRepo, w.SameGitRepo * f.SameGitRepo},
+		{"cmd_prefix_match", f.CmdPrefixMatch, w.CmdPrefixMatch, w.CmdPrefixMatch * f.CmdPrefixMatch},
+	}
+}
+
+// FeatureContribution is one feature's share of a suggestion's final score.
+type FeatureContribution struct {
+	Name         string
+	Value        float64
+	Weight       float64
+	Contribution float64
+}
+
+// DefaultWeights approximates the formula processSearchResults used before
+// this model existed: the ES score taken as-is, a modest boost for
+// (log-scaled) frequency, and a recency boost that decays over about a
+// month. The two features that formula never considered - same_git_repo and
+// cmd_prefix_match - start at zero weight so they have no effect until
+// training observes that they predict acceptance.
+func DefaultWeights() Weights {
+	return Weights{
+		ESScore:        1.0,
+		LogFreq:        0.3,
+		RecencyDays:    -0.07,
+		EnvMatchCount:  0.2,
+		SameGitRepo:    0,
+		CmdPrefixMatch: 0,
+	}
+}
+
+// DefaultPath returns ~/.totalrecall/ranker.json.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "ranker.json")
+}
+
+// LoadWeights reads weights from path, falling back to DefaultWeights if the
+// file doesn't exist yet (e.g. totalrecall-train has never run).
+func LoadWeights(path string) (Weights, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultWeights(), nil
+	}
+	if err != nil {
+		return Weights{}, fmt.Errorf("reading ranker weights %s: %v", path, err)
+	}
+
+	var w Weights
+	if err := json.Unmarshal(data, &w); err != nil {
+		return Weights{}, fmt.Errorf("parsing ranker weights %s: %v", path, err)
+	}
+	return w, nil
+}
+
+// SaveWeights writes w to path as indented JSON, creating path's directory
+// if necessary.
+func SaveWeights(path string, w Weights) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("creating directory for ranker weights %s: %v", path, err)
+	}
+
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding ranker weights: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("writing ranker weights %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package ranker
+
+import "math"
+
+// Pair is one observed (chosen, not-chosen) comparison: of everything shown
+// for a query, the user ran Chosen and not NotChosen.
+type Pair struct {
+	Chosen    Features
+	NotChosen Features
+}
+
+// TrainConfig tunes the pairwise SGD fit.
+type TrainConfig struct {
+	// LearningRate scales each gradient step.
+	LearningRate float64
+	// Epochs is how many passes TrainPairwiseSGD makes over the pairs.
+	Epochs int
+	// L2 is an L2 regularization strength pulling weights toward zero, so a
+	// handful of observations can't swing a weight to an extreme value.
+	L2 float64
+}
+
+// DefaultTrainConfig returns conservative defaults: a small learning rate
+// over 50 epochs with light L2 regularization.
+func DefaultTrainConfig() TrainConfig {
+	return TrainConfig{LearningRate: 0.05, Epochs: 50, L2: 0.001}
+}
+
+// TrainPairwiseSGD fits Weights by pairwise logistic regression: for each
+// (chosen, not-chosen) pair it treats diff = chosen - notChosen as a
+// positive example and does an SGD step on the logistic loss
+// -log(sigmoid(w·diff)), so the final weights tend to rank a chosen
+// suggestion above the ones the user passed over. It starts from initial
+// rather than zero so a weight direction already confirmed by DefaultWeights
+// isn't thrown away by a small training set.
+func TrainPairwiseSGD(pairs []Pair, initial Weights, cfg TrainConfig) Weights {
+	w := initial
+	if len(pairs) == 0 {
+		return w
+	}
+
+	for epoch := 0; epoch < cfg.Epochs; epoch++ {
+		for _, p := range pairs {
+			diff := subtract(p.Chosen, p.NotChosen)
+			margin := w.Score(diff)
+			// gradient of -log(sigmoid(margin)) w.r.t. w is -(1-sigmoid(margin))*diff
+			grad := 1 - sigmoid(margin)
+
+			w.ESScore += cfg.LearningRate * (grad*diff.ESScore - cfg.L2*w.ESScore)
+			w.LogFreq += cfg.LearningRate * (grad*diff.LogFreq - cfg.L2*w.LogFreq)
+			w.RecencyDays += cfg.LearningRate * (grad*diff.RecencyDays - cfg.L2*w.RecencyDays)
+			w.EnvMatchCount += cfg.LearningRate * (grad*diff.EnvMatchCount - cfg.L2*w.EnvMatchCount)
+			w.SameGitRepo += cfg.LearningRate * (grad*diff.SameGitRepo - cfg.L2*w.SameGitRepo)
+			w.CmdPrefixMatch += cfg.LearningRate * (grad*diff.CmdPrefixMatch - cfg.L2*w.CmdPrefixMatch)
+		}
+	}
+
+	return w
+}
+
+func subtract(a, b Features) Features {
+	return Features{
+		ESScore:        a.ESScore - b.ESScore,
+		LogFreq:        a.LogFreq - b.LogFreq,
+		RecencyDays:    a.RecencyDays - b.RecencyDays,
+		EnvMatchCount:  a.EnvMatchCount - b.EnvMatchCount,
+		SameGitRepo:    a.SameGitRepo - b.SameGitRepo,
+		CmdPrefixMatch: a.CmdPrefixMatch - b.CmdPrefixMatch,
+	}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
@@ -0,0 +1,36 @@
+package schema
+
+import "time"
+
+// StartTime returns StartTsUnixNano as a time.Time for callers that would
+// rather work with the standard library type.
+func (m *CommandEvent) StartTime() time.Time {
+	return time.Unix(0, m.StartTsUnixNano)
+}
+
+// EndTime returns EndTsUnixNano as a time.Time.
+func (m *CommandEvent) EndTime() time.Time {
+	return time.Unix(0, m.EndTsUnixNano)
+}
+
+// SetTimes stamps both timestamps from time.Time values, which is more
+// convenient for callers than setting the unix-nano fields directly.
+func (m *CommandEvent) SetTimes(start, end time.Time) {
+	m.StartTsUnixNano = start.UnixNano()
+	m.EndTsUnixNano = end.UnixNano()
+}
+
+// NewCommandEvent builds a CommandEvent stamped with CurrentSchemaVersion,
+// the shape every totalrecall binary should build before selecting an
+// encoder, instead of hand-rolling a map[string]interface{}.
+func NewCommandEvent(command, pwd string, start, end time.Time, returnCode int, env map[string]string) *CommandEvent {
+	ev := &CommandEvent{
+		SchemaVersion: CurrentSchemaVersion,
+		Command:       command,
+		Pwd:           pwd,
+		ReturnCode:    int32(returnCode),
+		Env:           env,
+	}
+	ev.SetTimes(start, end)
+	return ev
+}
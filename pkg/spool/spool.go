@@ -0,0 +1,142 @@
+// Package spool implements a local on-disk holding area for command events
+// that could not be delivered immediately, so a down collector or NATS
+// server doesn't mean silently dropped history.
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Spool is a directory of fsync'd `.json` files, one per pending event,
+// named so that lexical order matches delivery order.
+type Spool struct {
+	dir     string
+	maxSize int64 // bytes; 0 means unbounded
+	seq     int64
+}
+
+// Open ensures dir exists and returns a Spool rooted there. maxSize of 0
+// disables the size cap.
+func Open(dir string, maxSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating spool dir %s: %v", dir, err)
+	}
+	return &Spool{dir: dir, maxSize: maxSize}, nil
+}
+
+// Root returns $TOTALRECALLROOT/spool, falling back to
+// $XDG_STATE_HOME/totalrecall/spool, then ~/.totalrecall/spool.
+func Root() string {
+	if root := os.Getenv("TOTALRECALLROOT"); root != "" {
+		return filepath.Join(root, "spool")
+	}
+	if state := os.Getenv("XDG_STATE_HOME"); state != "" {
+		return filepath.Join(state, "totalrecall", "spool")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "spool")
+}
+
+// Write fsyncs data to a new monotonically-named file in the spool and
+// returns its path. Call Delete(path) once the event has been delivered.
+func (s *Spool) Write(data []byte) (string, error) {
+	name := fmt.Sprintf("%020d-%d.json", time.Now().UnixNano(), atomic.AddInt64(&s.seq, 1))
+	path := filepath.Join(s.dir, name)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("creating spool file %s: %v", path, err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("writing spool file %s: %v", path, err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("fsyncing spool file %s: %v", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("closing spool file %s: %v", path, err)
+	}
+
+	if s.maxSize > 0 {
+		if err := s.evictOldest(); err != nil {
+			fmt.Fprintf(os.Stderr, "spool: eviction warning: %v\n", err)
+		}
+	}
+
+	return path, nil
+}
+
+// Delete removes a spooled file after successful delivery.
+func (s *Spool) Delete(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Pending returns the spooled file paths, oldest first (monotonic filenames
+// sort in delivery order).
+func (s *Spool) Pending() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool dir %s: %v", s.dir, err)
+	}
+
+	var paths []string
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.dir, e.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// evictOldest removes the oldest spooled files until the spool's total size
+// is back under maxSize. It runs after every Write so a runaway shell can't
+// fill the disk with undelivered events.
+func (s *Spool) evictOldest() error {
+	paths, err := s.Pending()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	sizes := make(map[string]int64, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		sizes[p] = info.Size()
+		total += info.Size()
+	}
+
+	for _, p := range paths {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= sizes[p]
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package subfilter compiles the small boolean expression language used by
+// tls-proxy SUBSCRIBE requests (e.g. "return_code!=0 AND command~=^git",
+// "pwd glob /home/*/src/**", "hostname in (a,b)") into a predicate over a
+// decoded event, so the proxy and any in-process consumer share one
+// tokenizer/AST/evaluator instead of each hand-rolling field matching.
+package subfilter
+
+import "path/filepath"
+
+// Predicate reports whether event matches a compiled filter expression.
+type Predicate func(event map[string]interface{}) bool
+
+// Compile parses expr and returns a Predicate that evaluates it against a
+// decoded event. An empty expr always matches.
+func Compile(expr string) (Predicate, error) {
+	if expr == "" {
+		return func(map[string]interface{}) bool { return true }, nil
+	}
+
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, unexpectedTokenErr(p.peek())
+	}
+
+	return n.eval, nil
+}
+
+// filepathMatch matches a single path segment against a "*"-only glob
+// pattern via filepath.Match, which has no notion of "/" and so is safe to
+// call per-segment from globMatchSegments.
+func filepathMatch(pattern, value string) (bool, error) {
+	return filepath.Match(pattern, value)
+}
@@ -0,0 +1,84 @@
+package subfilter
+
+import (
+	"fmt"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord           // a field name, keyword (AND/OR/NOT/glob/in), or "field<op>value"
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// tokenize splits expr into words and the punctuation that structures
+// lists and grouping: whitespace separates words, and "(", ")", "," are
+// always their own token regardless of surrounding whitespace. A word may
+// itself contain an embedded comparison operator (e.g. "return_code!=0"),
+// which the parser splits out.
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' && runes[i] != ',' {
+				i++
+			}
+			tokens = append(tokens, token{tokWord, string(runes[start:i])})
+		}
+	}
+
+	return tokens, nil
+}
+
+// splitOperator looks for a comparison operator embedded in word (as in
+// "return_code!=0" or "command~=^git") and splits it into field, operator,
+// value. ok is false if word has none of the operators in it.
+func splitOperator(word string) (field, op, value string, ok bool) {
+	for _, candidate := range []string{"!=", "~=", "=="} {
+		if idx := indexOf(word, candidate); idx >= 0 {
+			return word[:idx], candidate, word[idx+len(candidate):], true
+		}
+	}
+	return "", "", "", false
+}
+
+func indexOf(s, substr string) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if s[i:i+len(substr)] == substr {
+			return i
+		}
+	}
+	return -1
+}
+
+func unexpectedTokenErr(t token) error {
+	if t.kind == tokEOF {
+		return fmt.Errorf("unexpected end of filter expression")
+	}
+	return fmt.Errorf("unexpected token %q", t.text)
+}
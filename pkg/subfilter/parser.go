@@ -0,0 +1,293 @@
+package subfilter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// node is one AST node. Compiling an expression produces a tree of nodes
+// whose eval walks the whole tree for each event - cheap enough at
+// pub/sub fanout rates, and far simpler than bytecode for a grammar this
+// small.
+type node interface {
+	eval(event map[string]interface{}) bool
+}
+
+type andNode struct{ left, right node }
+
+func (n *andNode) eval(event map[string]interface{}) bool {
+	return n.left.eval(event) && n.right.eval(event)
+}
+
+type orNode struct{ left, right node }
+
+func (n *orNode) eval(event map[string]interface{}) bool {
+	return n.left.eval(event) || n.right.eval(event)
+}
+
+type notNode struct{ operand node }
+
+func (n *notNode) eval(event map[string]interface{}) bool {
+	return !n.operand.eval(event)
+}
+
+// comparisonNode handles "field==value", "field!=value", and the regex
+// form "field~=pattern".
+type comparisonNode struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp // set only when op == "~="
+}
+
+func (n *comparisonNode) eval(event map[string]interface{}) bool {
+	actual, present := fieldString(event, n.field)
+
+	switch n.op {
+	case "==":
+		return present && actual == n.value
+	case "!=":
+		return present && actual != n.value
+	case "~=":
+		return present && n.re.MatchString(actual)
+	default:
+		return false
+	}
+}
+
+// globNode handles "field glob pattern", where pattern is a "/"-separated
+// glob supporting "*" within a segment and "**" across segments.
+type globNode struct {
+	field   string
+	pattern string
+}
+
+func (n *globNode) eval(event map[string]interface{}) bool {
+	actual, present := fieldString(event, n.field)
+	if !present {
+		return false
+	}
+	return globMatch(n.pattern, actual)
+}
+
+// inNode handles "field in (a,b,c)".
+type inNode struct {
+	field  string
+	values []string
+}
+
+func (n *inNode) eval(event map[string]interface{}) bool {
+	actual, present := fieldString(event, n.field)
+	if !present {
+		return false
+	}
+	for _, v := range n.values {
+		if actual == v {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldString stringifies event[field] the same way for every operator, so
+// "return_code!=0" compares the JSON number 0 against the literal "0".
+func fieldString(event map[string]interface{}, field string) (string, bool) {
+	v, ok := event[field]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%v", v), true
+}
+
+// parser is a small recursive-descent parser over the grammar:
+//
+//	expr       := orExpr
+//	orExpr     := andExpr ( "OR" andExpr )*
+//	andExpr    := unary ( "AND" unary )*
+//	unary      := "NOT" unary | primary
+//	primary    := "(" expr ")" | comparison
+//	comparison := field ( "==" | "!=" | "~=" ) value
+//	            | field "glob" pattern
+//	            | field "in" "(" value ("," value)* ")"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return token{kind: tokEOF}
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) parseExpr() (node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for isKeyword(p.peek(), "AND") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if isKeyword(p.peek(), "NOT") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, unexpectedTokenErr(p.peek())
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	tok := p.next()
+	if tok.kind != tokWord {
+		return nil, unexpectedTokenErr(tok)
+	}
+
+	if field, op, value, ok := splitOperator(tok.text); ok {
+		n := &comparisonNode{field: field, op: op, value: value}
+		if op == "~=" {
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("compiling regex %q for field %q: %v", value, field, err)
+			}
+			n.re = re
+		}
+		return n, nil
+	}
+
+	field := tok.text
+	opTok := p.next()
+	if opTok.kind != tokWord {
+		return nil, unexpectedTokenErr(opTok)
+	}
+
+	switch strings.ToUpper(opTok.text) {
+	case "GLOB":
+		patternTok := p.next()
+		if patternTok.kind != tokWord {
+			return nil, unexpectedTokenErr(patternTok)
+		}
+		return &globNode{field: field, pattern: patternTok.text}, nil
+
+	case "IN":
+		if p.peek().kind != tokLParen {
+			return nil, unexpectedTokenErr(p.peek())
+		}
+		p.next()
+
+		var values []string
+		for {
+			v := p.next()
+			if v.kind != tokWord {
+				return nil, unexpectedTokenErr(v)
+			}
+			values = append(values, v.text)
+
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			break
+		}
+
+		if p.peek().kind != tokRParen {
+			return nil, unexpectedTokenErr(p.peek())
+		}
+		p.next()
+
+		return &inNode{field: field, values: values}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown operator %q after field %q", opTok.text, field)
+	}
+}
+
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+// globMatch matches a "/"-separated pattern against value, where "*"
+// matches within one path segment and "**" matches zero or more segments -
+// the same semantics as gitignore/Syncthing ignore patterns.
+func globMatch(pattern, value string) bool {
+	return globMatchSegments(strings.Split(pattern, "/"), strings.Split(value, "/"))
+}
+
+func globMatchSegments(pattern, value []string) bool {
+	if len(pattern) == 0 {
+		return len(value) == 0
+	}
+
+	if pattern[0] == "**" {
+		if globMatchSegments(pattern[1:], value) {
+			return true
+		}
+		if len(value) == 0 {
+			return false
+		}
+		return globMatchSegments(pattern, value[1:])
+	}
+
+	if len(value) == 0 {
+		return false
+	}
+	if ok, err := filepathMatch(pattern[0], value[0]); err != nil || !ok {
+		return false
+	}
+	return globMatchSegments(pattern[1:], value[1:])
+}
@@ -0,0 +1,155 @@
+// Package suggestlog records shelper's ranked suggestions and which command
+// the user actually ran afterward, as the training data totalrecall-train
+// fits pkg/ranker's weights against.
+package suggestlog
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"totalrecall/pkg/ranker"
+)
+
+// Candidate is one suggestion shelper showed, with the features it was
+// scored on.
+type Candidate struct {
+	Command  string          `json:"command"`
+	Features ranker.Features `json:"features"`
+	Score    float64         `json:"score"`
+}
+
+// Record is one line of the log: either shelper reporting what it showed
+// ("shown") or precmd-hook reporting what actually ran ("accepted").
+type Record struct {
+	Kind        string      `json:"kind"`
+	Timestamp   time.Time   `json:"timestamp"`
+	ContextHash string      `json:"context_hash"`
+	Candidates  []Candidate `json:"candidates,omitempty"`
+	Command     string      `json:"command,omitempty"`
+}
+
+// DefaultPath returns ~/.totalrecall/suggestions.jsonl.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "suggestions.jsonl")
+}
+
+// ContextHash identifies a query context so a later "accepted" record can be
+// paired with the "shown" record it followed. It's keyed on pwd alone -
+// shelper's own query already scopes suggestions to pwd.keyword, so two
+// lookups from the same directory are the same context for training
+// purposes even if the environment shifted slightly between them.
+func ContextHash(pwd string) string {
+	sum := sha256.Sum256([]byte(pwd))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Logger appends Records to an NDJSON file, rotating it to a single ".1"
+// backup once it exceeds MaxBytes.
+type Logger struct {
+	Path     string
+	MaxBytes int64
+}
+
+// DefaultMaxBytes caps the suggestion log at 10MB before rotation.
+const DefaultMaxBytes = 10 << 20
+
+// NewLogger returns a Logger at DefaultPath with DefaultMaxBytes.
+func NewLogger() *Logger {
+	return &Logger{Path: DefaultPath(), MaxBytes: DefaultMaxBytes}
+}
+
+// Append writes r as one NDJSON line, rotating first if the log has grown
+// past MaxBytes.
+func (l *Logger) Append(r Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return fmt.Errorf("creating directory for suggestion log %s: %v", l.Path, err)
+	}
+	if err := l.rotateIfNeeded(); err != nil {
+		return fmt.Errorf("rotating suggestion log %s: %v", l.Path, err)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding suggestion log record: %v", err)
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening suggestion log %s: %v", l.Path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("appending to suggestion log %s: %v", l.Path, err)
+	}
+	return nil
+}
+
+func (l *Logger) rotateIfNeeded() error {
+	maxBytes := l.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+
+	info, err := os.Stat(l.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < maxBytes {
+		return nil
+	}
+
+	backup := l.Path + ".1"
+	os.Remove(backup) // ignore: fine if no previous backup exists
+	return os.Rename(l.Path, backup)
+}
+
+// ReadAll parses every Record currently in path and its ".1" rotation
+// backup (oldest first), for totalrecall-train to consume.
+func ReadAll(path string) ([]Record, error) {
+	var records []Record
+	for _, p := range []string{path + ".1", path} {
+		recs, err := readFile(p)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
+
+func readFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening suggestion log %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue // skip a corrupted line rather than failing the whole read
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
@@ -1,107 +1,190 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"sort"
 	"strings"
 	"time"
 
-	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+
+	"totalrecall/pkg/backend"
+	"totalrecall/pkg/esquery"
+	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/querydsl"
 )
 
-// ESHit represents a single hit from Elasticsearch
-type ESHit struct {
-	Source struct {
-		Command       string    `json:"command"`
-		StartTimestamp time.Time `json:"start_timestamp"`
-		Env           struct {
-			PWD string `json:"PWD"`
-		} `json:"env"`
-	} `json:"_source"`
+// DirScore represents a directory with its server-computed rank score.
+type DirScore struct {
+	Path  string
+	Score float64
 }
 
-// ESResponse represents the Elasticsearch search response
-type ESResponse struct {
-	Hits struct {
-		Hits []ESHit `json:"hits"`
-	} `json:"hits"`
+// defaultESEndpoints is the fallback chain used when no -es flags are
+// given: the proxy socket, then the HAProxy mTLS endpoint directly.
+var defaultESEndpoints = []string{
+	"unix:///tmp/totalrecall-proxy.sock",
+	"https://localhost:9243",
 }
 
-// DirScore represents a directory with its score
-type DirScore struct {
-	Path  string
-	Score float64
+// endpointListFlag collects repeated -es flag values in order, so users can
+// write "-es unix:///tmp/foo.sock -es https+insecure://localhost:9243" to
+// try the socket first and fall back to a direct connection.
+type endpointListFlag []string
+
+func (f *endpointListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *endpointListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// envOrDefault returns os.Getenv(key) if set, else def - how -decay-scale
+// etc. get both a flag and an env var without duplicating the default.
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func envOrDefaultFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	var f float64
+	if _, err := fmt.Sscanf(v, "%g", &f); err != nil {
+		return def
+	}
+	return f
 }
 
 func main() {
-	// Connect to Elasticsearch
-	cfg := elasticsearch.Config{
-		Addresses: []string{"http://localhost:9200"},
+	var esFlags endpointListFlag
+	flag.Var(&esFlags, "es", "ES endpoint to try, in order (unix:///path, host:port, http(s)://..., https+insecure://...). May be repeated; defaults to the proxy socket then the direct HAProxy endpoint.")
+
+	var (
+		limit         = flag.Int("n", 10, "Number of directories to offer")
+		host          = flag.String("host", "", "Only consider history from this hostname (env DIRJUMP_HOST)")
+		subtree       = flag.Bool("subtree", false, "Only consider directories under the current $PWD")
+		decayScale    = flag.String("decay-scale", envOrDefault("DIRJUMP_DECAY_SCALE", "24h"), "Gaussian recency decay scale, as a duration (env DIRJUMP_DECAY_SCALE)")
+		decayOffset   = flag.String("decay-offset", envOrDefault("DIRJUMP_DECAY_OFFSET", "1h"), "Recency decay offset - full weight within this long of now (env DIRJUMP_DECAY_OFFSET)")
+		freqWeight    = flag.Float64("freq-weight", envOrDefaultFloat("DIRJUMP_FREQ_WEIGHT", 0.3), "Weight given to visit frequency in the combined ranking (env DIRJUMP_FREQ_WEIGHT)")
+		recencyWeight = flag.Float64("recency-weight", envOrDefaultFloat("DIRJUMP_RECENCY_WEIGHT", 0.7), "Weight given to recency in the combined ranking (env DIRJUMP_RECENCY_WEIGHT)")
+	)
+	flag.Parse()
+
+	if *host == "" {
+		*host = os.Getenv("DIRJUMP_HOST")
 	}
-	
-	// Check if ES_URL environment variable is set
-	if esURL := os.Getenv("ES_URL"); esURL != "" {
-		cfg.Addresses = []string{esURL}
+
+	if len(esFlags) == 0 {
+		esFlags = defaultESEndpoints
+		if esURL := os.Getenv("ES_URL"); esURL != "" {
+			esFlags = endpointListFlag{esURL}
+		}
+	}
+	endpoints := make([]estransport.Endpoint, 0, len(esFlags))
+	for _, raw := range esFlags {
+		ep, err := estransport.ParseEndpoint(raw)
+		if err != nil {
+			log.Fatalf("Error parsing -es endpoint: %v", err)
+		}
+		endpoints = append(endpoints, ep)
 	}
-	
-	es, err := elasticsearch.NewClient(cfg)
+
+	client, err := backend.Open(endpoints)
 	if err != nil {
-		log.Fatalf("Error creating the client: %s", err)
+		log.Fatalf("Error connecting to index backend: %v", err)
+	}
+	if closer, ok := client.(interface{ Close() error }); ok {
+		defer closer.Close()
+	} else if closer, ok := client.(interface{ Close() }); ok {
+		defer closer.Close()
+	}
+
+	opts := dirScoreOptions{
+		limit:         *limit,
+		host:          *host,
+		decayScale:    *decayScale,
+		decayOffset:   *decayOffset,
+		freqWeight:    *freqWeight,
+		recencyWeight: *recencyWeight,
+	}
+	if *subtree {
+		if pwd, err := os.Getwd(); err == nil {
+			opts.subtreeOf = pwd
+		}
+	}
+
+	dirScores, err := getDirScores(client, opts)
+	if err != nil {
+		log.Fatalf("Error scoring directories: %v", err)
 	}
 
-	// Query Elasticsearch for recent commands
-	dirScores := getDirScores(es)
-	
 	// Create and run the terminal UI
 	app := tview.NewApplication()
 	list := tview.NewList().
 		SetHighlightFullLine(true).
 		SetWrapAround(true)
 
-	// Add directory options to the list
-	for i, dir := range dirScores {
-		if i >= 10 { // Limit to top 10 directories
-			break
-		}
-		
-		// Get directory name for display
-		dirName := dir.Path
-		if lastSlash := strings.LastIndex(dirName, "/"); lastSlash >= 0 {
-			shortName := dirName[lastSlash+1:]
-			if shortName == "" {
-				shortName = "/"
+	// populateList replaces the list's contents with scores, respecting
+	// -n same as the initial population below.
+	populateList := func(scores []DirScore) {
+		list.Clear()
+		for i, dir := range scores {
+			if i >= *limit {
+				break
 			}
-			dirName = fmt.Sprintf("%s (%s)", shortName, dirName)
+
+			// Get directory name for display
+			dirName := dir.Path
+			if lastSlash := strings.LastIndex(dirName, "/"); lastSlash >= 0 {
+				shortName := dirName[lastSlash+1:]
+				if shortName == "" {
+					shortName = "/"
+				}
+				dirName = fmt.Sprintf("%s (%s)", shortName, dirName)
+			}
+
+			list.AddItem(dirName, dir.Path, rune('1'+i), nil)
 		}
-		
-		list.AddItem(dirName, dir.Path, rune('1'+i), nil)
 	}
+	populateList(dirScores)
 
-	// Set up key handling for selection
-	list.SetSelectedFunc(func(i int, _ string, secondaryText string, _ rune) {
+	// selectDir is what both pressing Enter on the list and pressing Enter
+	// in the filter box (forwarded to the currently-highlighted item) do:
+	// hand the chosen directory back to the bash wrapper.
+	selectDir := func(secondaryText string) {
 		app.Stop()
-		
+
 		// Output the selected directory to stdout
 		fmt.Println(secondaryText)
-		
+
 		// Create a script file that will be sourced by bash
 		tmpfile, err := ioutil.TempFile("", "dirjump*.sh")
 		if err == nil {
 			defer os.Remove(tmpfile.Name())
 			tmpfile.WriteString(fmt.Sprintf("cd \"%s\"\n", secondaryText))
 			tmpfile.Close()
-			
+
 			// Output the script path to stderr so the bash wrapper can source it
 			fmt.Fprintf(os.Stderr, "%s", tmpfile.Name())
 		}
+	}
+
+	// Set up key handling for selection
+	list.SetSelectedFunc(func(i int, _ string, secondaryText string, _ rune) {
+		selectDir(secondaryText)
 	})
 
 	// Set up key handler for immediate exit
@@ -113,203 +196,238 @@ func main() {
 		return event
 	})
 
-	// Set up the layout
+	// filterInput is the fzf-style incremental filter box: querydsl parses
+	// its text (bare words, quoted phrases, host:/after:/before:/cmd:
+	// filters, !negation) into the same query getDirScores already runs,
+	// just with those clauses merged in. Re-querying on every keystroke
+	// would hammer the backend, so typing resets a short debounce timer
+	// instead of querying immediately.
+	filterInput := tview.NewInputField().
+		SetLabel("Filter: ").
+		SetFieldWidth(0)
+
+	var filterTimer *time.Timer
+	filterInput.SetChangedFunc(func(text string) {
+		if filterTimer != nil {
+			filterTimer.Stop()
+		}
+		filterTimer = time.AfterFunc(150*time.Millisecond, func() {
+			filtered := opts
+			filtered.filter = text
+			scores, err := getDirScores(client, filtered)
+			if err != nil {
+				return
+			}
+			app.QueueUpdateDraw(func() {
+				populateList(scores)
+			})
+		})
+	})
+
+	// Forward the keys the list itself handles - navigation, selection,
+	// cancellation - through from the filter box, which otherwise keeps
+	// focus (and the cursor) while the user types.
+	filterInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown:
+			list.InputHandler()(event, nil)
+			return nil
+		case tcell.KeyEnter:
+			if i := list.GetCurrentItem(); i >= 0 {
+				_, secondaryText := list.GetItemText(i)
+				selectDir(secondaryText)
+			}
+			return nil
+		case tcell.KeyEsc:
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+
+	// Set up the layout: the filter box on top, the bordered list below.
 	frame := tview.NewFrame(list).
-		SetBorders(2, 2, 2, 2, 4, 4).
+		SetBorders(1, 2, 1, 2, 4, 4).
 		AddText("Jump to Directory", true, tview.AlignCenter, tcell.ColorYellow).
-		AddText("Use arrow keys to select, Enter to choose, Esc to cancel", false, tview.AlignCenter, tcell.ColorWhite)
+		AddText("Type to filter, arrow keys to select, Enter to choose, Esc to cancel", false, tview.AlignCenter, tcell.ColorWhite)
+
+	layout := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(filterInput, 1, 0, true).
+		AddItem(frame, 0, 1, false)
 
-	if err := app.SetRoot(frame, true).SetFocus(list).Run(); err != nil {
+	if err := app.SetRoot(layout, true).SetFocus(filterInput).Run(); err != nil {
 		log.Fatalf("Error running application: %s", err)
 	}
 }
 
-// getDirScores queries Elasticsearch and returns directories with scores
-func getDirScores(es *elasticsearch.Client) []DirScore {
-	// Build the query to get cd commands and PWD changes
-	var buf bytes.Buffer
-	query := map[string]interface{}{
-		"size": 500,
-		"sort": []map[string]interface{}{
-			{
-				"start_timestamp": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"should": []map[string]interface{}{
-					{
-						"match_phrase_prefix": map[string]interface{}{
-							"command": "cd ",
-						},
-					},
-				},
-			},
-		},
+// dirScoreOptions configures buildDirScoreQuery: which history to
+// consider (host, subtreeOf) and how to rank it (decay*, *Weight).
+type dirScoreOptions struct {
+	limit         int
+	host          string
+	subtreeOf     string // non-empty restricts results to this directory's subtree
+	decayScale    string
+	decayOffset   string
+	freqWeight    float64
+	recencyWeight float64
+	filter        string // raw querydsl text from the picker's filter box; "" matches everything
+}
+
+// dirTargetScript extracts the directory a history document is "about":
+// the argument of a "cd <dir>" command if there is one, falling back to
+// the shell's PWD at the time the command ran otherwise - the painless
+// replacement for getDirScores's old two-pass, client-side extraction.
+const dirTargetScript = `
+String cmd = doc.containsKey('command.keyword') && !doc['command.keyword'].empty ? doc['command.keyword'].value : '';
+if (cmd.startsWith('cd ')) {
+  return cmd.substring(3).trim();
+}
+return doc.containsKey('env.PWD.keyword') && !doc['env.PWD.keyword'].empty ? doc['env.PWD.keyword'].value : '';
+`
+
+// buildDirScoreQuery assembles the single function_score + aggregation
+// request that replaces getDirScores's old 500+500-hit client-side
+// re-scoring: a gauss decay on start_timestamp drives per-document
+// recency, a scripted terms aggregation groups documents into
+// directories, and a bucket_script + bucket_sort combine each directory's
+// frequency (doc_count) and recency (max adjusted _score) into one
+// weighted rank, truncated to opts.limit server-side.
+func buildDirScoreQuery(opts dirScoreOptions) esquery.Search {
+	var filters []esquery.Query
+	if opts.host != "" {
+		filters = append(filters, esquery.TermQuery{Field: "hostname.keyword", Value: opts.host})
 	}
-	
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		log.Fatalf("Error encoding query: %s", err)
+	if opts.subtreeOf != "" {
+		filters = append(filters, esquery.PrefixQuery{Field: "env.PWD.keyword", Value: opts.subtreeOf})
 	}
 
-	// Perform the search request
-	res, err := es.Search(
-		es.Search.WithContext(context.Background()),
-		es.Search.WithIndex("totalrecall"),  // Use the index from the example
-		es.Search.WithBody(&buf),
-		es.Search.WithTrackTotalHits(true),
-	)
-	if err != nil {
-		log.Fatalf("Error getting response: %s", err)
+	base := esquery.BoolQuery{
+		Filter: filters,
+		Should: []esquery.Query{
+			esquery.MatchPhrasePrefixQuery{Field: "command", Value: "cd "},
+			esquery.ExistsQuery{Field: "env.PWD"},
+		},
+		MinimumShouldMatch: 1,
+	}
+	if opts.filter != "" {
+		if parsed, err := querydsl.Parse(opts.filter); err == nil {
+			compiled := querydsl.Compile(parsed)
+			base.Must = append(base.Must, compiled.Must...)
+			base.MustNot = append(base.MustNot, compiled.MustNot...)
+		}
 	}
-	defer res.Body.Close()
 
-	// Parse the response
-	var response ESResponse
-	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-		log.Fatalf("Error parsing response: %s", err)
+	scored := esquery.FunctionScoreQuery{
+		Query: base,
+		Functions: []esquery.ScoreFunction{
+			esquery.GaussDecayFunction{
+				Field:  "start_timestamp",
+				Origin: "now",
+				Scale:  opts.decayScale,
+				Offset: opts.decayOffset,
+				Decay:  0.5,
+			},
+		},
+		BoostMode: "replace",
 	}
 
-	// Extract directories and calculate scores
-	dirFreq := make(map[string]int)
-	dirLastUsed := make(map[string]time.Time)
-	
-	// Also query current working directories from PWD
-	var bufPwd bytes.Buffer
-	queryPwd := map[string]interface{}{
-		"size": 200,
-		"sort": []map[string]interface{}{
-			{
-				"start_timestamp": map[string]interface{}{
-					"order": "desc",
+	byDir := esquery.TermsAgg{
+		Script: dirTargetScript,
+		Size:   200,
+		SubAggs: map[string]esquery.Agg{
+			"max_score": esquery.ScriptedMaxAgg{Script: "_score"},
+			"combined_score": esquery.BucketScriptAgg{
+				BucketsPath: map[string]string{"freq": "_count", "recency": "max_score"},
+				Script:      "params.freqWeight * Math.log(1 + params.freq) + params.recencyWeight * params.recency",
+				Params: map[string]interface{}{
+					"freqWeight":    opts.freqWeight,
+					"recencyWeight": opts.recencyWeight,
 				},
 			},
+			"sort_by_combined": esquery.BucketSortAgg{
+				Sort: []esquery.SortField{{Field: "combined_score", Order: "desc"}},
+				Size: opts.limit,
+			},
 		},
-		"_source": []string{"env.PWD", "start_timestamp"},
-	}
-	
-	if err := json.NewEncoder(&bufPwd).Encode(queryPwd); err != nil {
-		log.Fatalf("Error encoding PWD query: %s", err)
 	}
 
-	// Perform the PWD search request
-	resPwd, err := es.Search(
-		es.Search.WithContext(context.Background()),
-		es.Search.WithIndex("totalrecall"),
-		es.Search.WithBody(&bufPwd),
-		es.Search.WithTrackTotalHits(true),
-	)
-	if err != nil {
-		log.Fatalf("Error getting PWD response: %s", err)
+	return esquery.Search{
+		Size:  0,
+		Query: scored,
+		Aggs:  map[string]esquery.Agg{"by_dir": byDir},
 	}
-	defer resPwd.Body.Close()
+}
 
-	// Parse the PWD response
-	var responsePwd ESResponse
-	if err := json.NewDecoder(resPwd.Body).Decode(&responsePwd); err != nil {
-		log.Fatalf("Error parsing PWD response: %s", err)
-	}
+// dirAggResponse is the shape of the "by_dir" aggregation
+// buildDirScoreQuery asks for, enough of it to read back each directory's
+// combined score.
+type dirAggResponse struct {
+	ByDir struct {
+		Buckets []struct {
+			Key           string `json:"key"`
+			CombinedScore struct {
+				Value float64 `json:"value"`
+			} `json:"combined_score"`
+		} `json:"buckets"`
+	} `json:"by_dir"`
+}
 
-	// Process CD commands
-	for _, hit := range response.Hits.Hits {
-		if strings.HasPrefix(hit.Source.Command, "cd ") {
-			// Extract the directory from the cd command
-			parts := strings.SplitN(hit.Source.Command, " ", 2)
-			if len(parts) >= 2 {
-				dir := strings.Trim(parts[1], "\"' ")
-				
-				// Resolve relative paths or ~
-				if strings.HasPrefix(dir, "~") {
-					home, err := os.UserHomeDir()
-					if err == nil {
-						dir = strings.Replace(dir, "~", home, 1)
-					}
-				} else if !strings.HasPrefix(dir, "/") {
-					// For relative paths, we need the PWD at that time
-					if hit.Source.Env.PWD != "" {
-						dir = hit.Source.Env.PWD + "/" + dir
-					}
-				}
-				
-				// Only include directories that actually exist
-				if _, err := os.Stat(dir); err == nil {
-					dirFreq[dir]++
-					if dirLastUsed[dir].Before(hit.Source.StartTimestamp) {
-						dirLastUsed[dir] = hit.Source.StartTimestamp
-					}
-				}
-			}
-		}
+// getDirScores runs buildDirScoreQuery against the configured
+// estransport.IndexBackend (Elasticsearch or the embedded local index) and
+// turns its aggregation response into ranked directories, filtering out
+// any bucket whose extracted directory no longer exists on disk.
+func getDirScores(client estransport.IndexBackend, opts dirScoreOptions) ([]DirScore, error) {
+	search := buildDirScoreQuery(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	raw, err := client.Aggregate(ctx, search.Source())
+	if err != nil {
+		return nil, fmt.Errorf("searching for directories: %v", err)
 	}
 
-	// Process PWD records
-	for _, hit := range responsePwd.Hits.Hits {
-		if hit.Source.Env.PWD != "" {
-			dir := hit.Source.Env.PWD
-			if _, err := os.Stat(dir); err == nil {
-				dirFreq[dir]++
-				if dirLastUsed[dir].Before(hit.Source.StartTimestamp) {
-					dirLastUsed[dir] = hit.Source.StartTimestamp
-				}
-			}
+	var agg dirAggResponse
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &agg); err != nil {
+			return nil, fmt.Errorf("parsing directory aggregation: %v", err)
 		}
 	}
 
-	// Add current directory and parent directories with some score
-	if pwd, err := os.Getwd(); err == nil {
-		// Add current directory
-		dirFreq[pwd]++
-		if dirLastUsed[pwd].IsZero() {
-			dirLastUsed[pwd] = time.Now()
+	dirScores := make([]DirScore, 0, len(agg.ByDir.Buckets))
+	seen := make(map[string]bool)
+	for _, bucket := range agg.ByDir.Buckets {
+		dir := resolveDir(bucket.Key)
+		if dir == "" || seen[dir] {
+			continue
 		}
-		
-		// Add parent directories with decreasing scores
-		parts := strings.Split(pwd, "/")
-		path := ""
-		for i, part := range parts {
-			if i == 0 && part == "" {
-				path = "/"
-			} else if part != "" {
-				path = path + "/" + part
-				if path != pwd { // Don't double-count current dir
-					dirFreq[path] = dirFreq[path] + 1
-					if dirLastUsed[path].IsZero() {
-						dirLastUsed[path] = time.Now().Add(-time.Duration(len(parts)-i) * time.Hour)
-					}
-				}
-			}
+		if _, err := os.Stat(dir); err != nil {
+			continue
 		}
+		seen[dir] = true
+		dirScores = append(dirScores, DirScore{Path: dir, Score: bucket.CombinedScore.Value})
 	}
 
-	// Calculate scores based on frequency and recency
-	var dirScores []DirScore
-	now := time.Now()
-	
-	for dir, freq := range dirFreq {
-		lastUsed := dirLastUsed[dir]
-		if lastUsed.IsZero() {
-			lastUsed = now.Add(-24 * time.Hour)
-		}
-		
-		// Score formula: combination of frequency and recency
-		hoursAgo := now.Sub(lastUsed).Hours()
-		recencyScore := 100.0 / (1.0 + hoursAgo/24.0) // Normalize to days
-		
-		// Combined score: 70% recency, 30% frequency
-		score := 0.7*recencyScore + 0.3*float64(freq)
-		
-		dirScores = append(dirScores, DirScore{
-			Path:  dir,
-			Score: score,
-		})
+	// Always offer the current directory, even on a cold history.
+	if pwd, err := os.Getwd(); err == nil && !seen[pwd] {
+		dirScores = append([]DirScore{{Path: pwd, Score: 0}}, dirScores...)
 	}
 
-	// Sort by score
-	sort.Slice(dirScores, func(i, j int) bool {
-		return dirScores[i].Score > dirScores[j].Score
-	})
+	return dirScores, nil
+}
 
-	return dirScores
+// resolveDir turns a raw cd-argument or PWD value from dirTargetScript
+// into a usable filesystem path, expanding a leading "~".
+func resolveDir(raw string) string {
+	dir := strings.Trim(raw, "\"' ")
+	if dir == "" {
+		return ""
+	}
+	if strings.HasPrefix(dir, "~") {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = strings.Replace(dir, "~", home, 1)
+		}
+	}
+	return dir
 }
@@ -2,24 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/nats-io/nats.go"
 	"github.com/rivo/tview"
-)
 
-// Event represents the structure of events from the NATS server
-type Event struct {
-	Environment struct {
-		PWD string `json:"PWD"`
-	} `json:"environment"`
-	Timestamp string `json:"timestamp"`
-}
+	"totalrecall/pkg/jetstream"
+	"totalrecall/pkg/schema"
+)
 
 // FileInfo holds information about a file or directory
 type FileInfo struct {
@@ -31,53 +32,66 @@ type FileInfo struct {
 	Permissions  string // Added permissions field
 }
 
-// Global variables for communication
-var dirChan = make(chan string, 10)
+// historyEntry is one row of the PWD-transitions pane: a directory the
+// user cd'd into, and when JetStream says it happened (not the event's own
+// start timestamp, so replay/rewind ordering matches delivery order). On
+// the core NATS fallback, which carries no JetStream metadata, it is the
+// event's start timestamp.
+type historyEntry struct {
+	PWD       string
+	Timestamp time.Time
+}
 
-func main() {
-	// Print startup message
-	fmt.Println("Starting NATS Directory Watcher")
+// historyStore is a bounded, most-recent-first buffer of historyEntry,
+// guarded by a mutex since entries arrive on a consumer goroutine but are
+// rendered from the UI goroutine via app.QueueUpdateDraw.
+type historyStore struct {
+	mu      sync.Mutex
+	entries []historyEntry
+	max     int
+}
 
-	// Start NATS client
-	go func() {
-		// Connect to NATS
-		fmt.Println("Connecting to NATS...")
-		nc, err := nats.Connect(nats.DefaultURL, nats.Timeout(5*time.Second))
-		if err != nil {
-			fmt.Printf("Error connecting to NATS: %v\n", err)
-			return
-		}
-		defer nc.Close()
+func newHistoryStore(max int) *historyStore {
+	return &historyStore{max: max}
+}
 
-		// Subscribe to all messages
-		_, err = nc.Subscribe("totalrecall", func(msg *nats.Msg) {
+func (s *historyStore) Add(e historyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append([]historyEntry{e}, s.entries...)
+	if len(s.entries) > s.max {
+		s.entries = s.entries[:s.max]
+	}
+}
 
-			// Try to parse the message
-			var event Event
-			if err := json.Unmarshal(msg.Data, &event); err != nil {
-				fmt.Printf("Error parsing message: %v\n", err)
-				return
-			}
+func (s *historyStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+}
 
-			// Check for PWD field
-			if event.Environment.PWD == "" {
-				fmt.Println("No PWD field in message")
-				return
-			}
+func (s *historyStore) Snapshot() []historyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]historyEntry, len(s.entries))
+	copy(out, s.entries)
+	return out
+}
 
-			dirChan <- event.Environment.PWD
-		})
+// Global variables for communication
+var dirChan = make(chan string, 10)
 
-		if err != nil {
-			fmt.Printf("Error subscribing to NATS: %v\n", err)
-			return
-		}
+func main() {
+	natsURLPtr := flag.String("nats-url", nats.DefaultURL, "NATS server URL.")
+	subjectPtr := flag.String("subject", jetstream.Subjects, "JetStream subject filter to watch.")
+	maxHistoryPtr := flag.Int("max-history", 200, "Number of PWD transitions to keep in the history pane.")
+	flag.Parse()
 
-		// Keep goroutine alive
-		for {
-			time.Sleep(time.Second)
-		}
-	}()
+	// Print startup message
+	fmt.Println("Starting NATS Directory Watcher")
+
+	history := newHistoryStore(*maxHistoryPtr)
+	watcher := newWatcher(*natsURLPtr, *subjectPtr, history)
 
 	// Create application
 	app := tview.NewApplication()
@@ -85,30 +99,116 @@ func main() {
 	// Create basic views
 	header := tview.NewTextView().SetDynamicColors(true).SetTextAlign(tview.AlignCenter)
 	table := tview.NewTable().SetBorders(false).SetSelectable(true, false)
+	historyTable := tview.NewTable().SetBorders(false).SetSelectable(true, false)
+	footer := tview.NewTextView().SetDynamicColors(true)
+
+	const footerHints = "[yellow]r[white]:rewind  [yellow]f[white]:filter  [yellow]/[white]:search  [yellow]enter[white]:open  [yellow]esc[white]:quit"
+	fmt.Fprint(footer, footerHints)
 
 	// Set up basic layout
+	panes := tview.NewFlex().SetDirection(tview.FlexColumn)
+	panes.AddItem(table, 0, 2, true)
+	panes.AddItem(historyTable, 0, 1, false)
+
 	flex := tview.NewFlex().SetDirection(tview.FlexRow)
 	flex.AddItem(header, 1, 0, false)
-	flex.AddItem(table, 0, 1, true)
+	flex.AddItem(panes, 0, 1, true)
+	flex.AddItem(footer, 1, 0, false)
 
 	// Set initial header
 	fmt.Fprintln(header, "Waiting for events...")
 
-	// Set ESC handler
+	renderHistory := func() {
+		historyTable.Clear()
+		for i, e := range watcher.visibleHistory() {
+			historyTable.SetCell(i, 0, tview.NewTableCell(fmt.Sprintf(" %s ", e.Timestamp.Local().Format("15:04:05"))).
+				SetTextColor(tcell.ColorYellow))
+			historyTable.SetCell(i, 1, tview.NewTableCell(" "+e.PWD))
+		}
+	}
+
+	prompt := tview.NewInputField().SetFieldWidth(0)
+	showPrompt := func(label string, done func(text string, accepted bool)) {
+		prompt.SetLabel(label).SetText("")
+		prompt.SetDoneFunc(func(key tcell.Key) {
+			text := prompt.GetText()
+			flex.RemoveItem(prompt)
+			flex.AddItem(footer, 1, 0, false)
+			app.SetFocus(panes)
+			done(text, key == tcell.KeyEnter)
+		})
+		flex.RemoveItem(footer)
+		flex.AddItem(prompt, 1, 0, true)
+		app.SetFocus(prompt)
+	}
+
+	historyTable.SetSelectedFunc(func(row, column int) {
+		visible := watcher.visibleHistory()
+		if row < 0 || row >= len(visible) {
+			return
+		}
+		openDirectory(app, visible[row].PWD)
+	})
+
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
+		if prompt.HasFocus() {
+			return event
+		}
+		switch event.Key() {
+		case tcell.KeyEscape:
 			app.Stop()
 			return nil
 		}
+		switch event.Rune() {
+		case 'r':
+			showPrompt("rewind to (RFC3339 or 15:04:05) > ", func(text string, accepted bool) {
+				if !accepted || text == "" {
+					return
+				}
+				t, err := parseRewindTime(text)
+				if err != nil {
+					fmt.Fprintf(header, "\n[red]rewind: %v[white]", err)
+					return
+				}
+				if err := watcher.rewind(t); err != nil {
+					fmt.Fprintf(header, "\n[red]rewind: %v[white]", err)
+					return
+				}
+				renderHistory()
+			})
+			return nil
+		case 'f':
+			showPrompt("filter PWD (regex, empty to clear) > ", func(text string, accepted bool) {
+				if !accepted {
+					return
+				}
+				if err := watcher.setFilter(text); err != nil {
+					fmt.Fprintf(header, "\n[red]filter: %v[white]", err)
+					return
+				}
+				renderHistory()
+			})
+			return nil
+		case '/':
+			showPrompt("search PWD > ", func(text string, accepted bool) {
+				if !accepted || text == "" {
+					return
+				}
+				row := findHistoryMatch(watcher.visibleHistory(), text)
+				if row >= 0 {
+					historyTable.Select(row, 0)
+					app.SetFocus(historyTable)
+				}
+			})
+			return nil
+		}
 		return event
 	})
 
-	// Watch for directory changes
+	// Watch for directory changes (file browser pane)
 	go func() {
 		for dir := range dirChan {
-
 			app.QueueUpdateDraw(func() {
-
 				// Update header
 				header.Clear()
 				fmt.Fprintf(header, "[green]%s[white]\n", dir)
@@ -151,13 +251,22 @@ func main() {
 					table.SetCell(i, 2, tview.NewTableCell(fmt.Sprintf(" %s", file.Name)).
 						SetTextColor(cellColor))
 				}
-				
+
 				// Make sure table is scrolled to the top after updating
 				table.ScrollToBeginning()
 			})
 		}
 	}()
 
+	// Re-render the history pane every time a new entry arrives.
+	go func() {
+		for range watcher.updates {
+			app.QueueUpdateDraw(renderHistory)
+		}
+	}()
+
+	watcher.start()
+
 	// Start the application
 	fmt.Println("Starting UI...")
 	if err := app.SetRoot(flex, true).Run(); err != nil {
@@ -166,6 +275,249 @@ func main() {
 	}
 }
 
+// openDirectory opens dir in $EDITOR if set, or a shell subprocess
+// otherwise, suspending the TUI for the duration so the child owns the
+// terminal.
+func openDirectory(app *tview.Application, dir string) {
+	app.Suspend(func() {
+		editor := os.Getenv("EDITOR")
+		var cmd *exec.Cmd
+		if editor != "" {
+			cmd = exec.Command(editor, dir)
+		} else {
+			shell := os.Getenv("SHELL")
+			if shell == "" {
+				shell = "/bin/sh"
+			}
+			cmd = exec.Command(shell)
+			cmd.Dir = dir
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("error opening %s: %v\n", dir, err)
+		}
+	})
+}
+
+// parseRewindTime accepts either a full RFC3339 timestamp or a bare
+// "15:04:05" clock time for today, since typing a full date mid-session is
+// more friction than a rewind keybinding should cost.
+func parseRewindTime(text string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("15:04:05", text, time.Local); err == nil {
+		now := time.Now()
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("expected RFC3339 or HH:MM:SS, got %q", text)
+}
+
+// findHistoryMatch returns the index of the first entry (in display order)
+// whose PWD contains substr, or -1.
+func findHistoryMatch(entries []historyEntry, substr string) int {
+	for i, e := range entries {
+		if strings.Contains(e.PWD, substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// watcher owns the NATS/JetStream connection feeding both dirChan (the
+// existing file-browser pane) and history (the new PWD-transitions pane).
+// It prefers a durable JetStream pull consumer so events published before
+// the UI launched aren't lost, falling back to a plain core NATS
+// subscription (the original behavior) when JetStream isn't available.
+type watcher struct {
+	natsURL string
+	subject string
+	history *historyStore
+	updates chan struct{}
+
+	mu       sync.Mutex
+	filterRe *regexp.Regexp
+
+	nc  *nats.Conn
+	js  nats.JetStreamContext
+	sub *nats.Subscription
+}
+
+func newWatcher(natsURL, subject string, history *historyStore) *watcher {
+	return &watcher{
+		natsURL: natsURL,
+		subject: subject,
+		history: history,
+		updates: make(chan struct{}, 16),
+	}
+}
+
+func (w *watcher) start() {
+	go func() {
+		cfg := jetstream.DefaultConfig()
+		cfg.URL = w.natsURL
+		nc, js, err := jetstream.Connect(cfg)
+		if err != nil {
+			fmt.Printf("JetStream unavailable (%v), falling back to core NATS\n", err)
+			w.runCoreNATS()
+			return
+		}
+		w.nc, w.js = nc, js
+
+		durable := consumerName()
+		sub, err := jetstream.DurableConsumer(js, durable, w.subject)
+		if err != nil {
+			fmt.Printf("error binding durable consumer (%v), falling back to core NATS\n", err)
+			nc.Close()
+			w.runCoreNATS()
+			return
+		}
+		w.sub = sub
+		w.pullLoop(sub)
+	}()
+}
+
+// consumerName derives a durable name from hostname+user so each shell's
+// dirwatch resumes its own position instead of stealing another session's.
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown-host"
+	}
+	username := "unknown-user"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	return fmt.Sprintf("dirwatch-%s-%s", host, username)
+}
+
+// pullLoop repeatedly fetches from sub and feeds both panes until the
+// process exits. Acks immediately: dirwatch is a read-only viewer, so
+// there's no redelivery-on-crash guarantee to uphold here.
+func (w *watcher) pullLoop(sub *nats.Subscription) {
+	for {
+		msgs, err := sub.Fetch(10, nats.MaxWait(5*time.Second))
+		if err != nil {
+			if err == nats.ErrTimeout {
+				continue
+			}
+			fmt.Printf("error fetching messages: %v\n", err)
+			continue
+		}
+		for _, msg := range msgs {
+			w.handle(msg)
+			msg.Ack()
+		}
+	}
+}
+
+func (w *watcher) handle(msg *nats.Msg) {
+	var ev schema.CommandEvent
+	if err := json.Unmarshal(msg.Data, &ev); err != nil {
+		return
+	}
+	if ev.Pwd == "" {
+		return
+	}
+
+	ts := ev.StartTime()
+	if meta, err := msg.Metadata(); err == nil {
+		ts = meta.Timestamp
+	}
+
+	w.history.Add(historyEntry{PWD: ev.Pwd, Timestamp: ts})
+	select {
+	case w.updates <- struct{}{}:
+	default:
+	}
+	select {
+	case dirChan <- ev.Pwd:
+	default:
+	}
+}
+
+// rewind abandons the current consumer and starts an ephemeral one at t,
+// clearing the history pane so it only shows the replayed window.
+func (w *watcher) rewind(t time.Time) error {
+	if w.js == nil {
+		return fmt.Errorf("JetStream unavailable, can't rewind")
+	}
+	sub, err := jetstream.RewindConsumer(w.js, w.subject, t)
+	if err != nil {
+		return err
+	}
+	if w.sub != nil {
+		w.sub.Unsubscribe()
+	}
+	w.sub = sub
+	w.history.Reset()
+	go w.pullLoop(sub)
+	return nil
+}
+
+// setFilter compiles pattern as the PWD filter for the history pane; an
+// empty pattern clears it.
+func (w *watcher) setFilter(pattern string) error {
+	if pattern == "" {
+		w.mu.Lock()
+		w.filterRe = nil
+		w.mu.Unlock()
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.filterRe = re
+	w.mu.Unlock()
+	return nil
+}
+
+// visibleHistory returns the history pane's current rows, filtered if a
+// filter is set.
+func (w *watcher) visibleHistory() []historyEntry {
+	entries := w.history.Snapshot()
+	w.mu.Lock()
+	re := w.filterRe
+	w.mu.Unlock()
+	if re == nil {
+		return entries
+	}
+	filtered := entries[:0:0]
+	for _, e := range entries {
+		if re.MatchString(e.PWD) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// runCoreNATS is the original plain core-NATS subscription, kept as the
+// fallback when JetStream can't be reached (e.g. an older nats-server).
+func (w *watcher) runCoreNATS() {
+	nc, err := nats.Connect(w.natsURL, nats.Timeout(5*time.Second))
+	if err != nil {
+		fmt.Printf("Error connecting to NATS: %v\n", err)
+		return
+	}
+	w.nc = nc
+
+	_, err = nc.Subscribe(w.subject, func(msg *nats.Msg) {
+		w.handle(msg)
+	})
+	if err != nil {
+		fmt.Printf("Error subscribing to NATS: %v\n", err)
+		return
+	}
+
+	for {
+		time.Sleep(time.Second)
+	}
+}
+
 // getFileList returns a list of files and directories at the given path
 func getFileList(path string) ([]FileInfo, error) {
 	dir, err := os.Open(path)
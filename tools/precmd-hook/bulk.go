@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/spool"
+)
+
+// openBulkSpool opens the same durable spool estransport.BulkIndexer reads
+// on startup, so --spool can queue an event fast (no ES round trip, no live
+// connection) and a later --flush-now/--daemon invocation's BulkIndexer
+// replays and drains it, instead of this tool keeping a separate spool
+// format only it understands.
+func openBulkSpool(maxBytes int64) (*spool.Spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = 32 << 20
+	}
+	return spool.Open(estransport.BulkIndexerSpoolDir(), maxBytes)
+}
+
+// bulkFlush connects to ES and starts a BulkIndexer, which replays whatever
+// --spool has queued and flushes it through its own worker pool, then waits
+// up to timeout for that drain to finish before closing the indexer.
+// Anything ES keeps rejecting is left in the spool for the next attempt.
+func bulkFlush(esFlags endpointListFlag, timeout time.Duration) (flushed int, err error) {
+	client, err := connectES(esFlags)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	indexer, err := client.NewBulkIndexer(estransport.BulkIndexerConfig{})
+	if err != nil {
+		return 0, fmt.Errorf("starting bulk indexer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := indexer.Close(ctx); err != nil {
+		return 0, fmt.Errorf("draining bulk indexer: %v", err)
+	}
+
+	_, numFlushed, _ := indexer.Stats()
+	return int(numFlushed), nil
+}
@@ -1,18 +1,20 @@
 package main
 import (
-    "crypto/tls"
-    "crypto/x509"
+    "context"
     "flag"
     "fmt"
     "time"
     "os"
-    "net"
     "strings"
     "strconv"
     "encoding/json"
     "encoding/base64"
-    "io/ioutil"
     "path/filepath"
+
+    "totalrecall/pkg/estransport"
+    "totalrecall/pkg/eventsink"
+    "totalrecall/pkg/netcapture"
+    "totalrecall/pkg/schema"
 )
 
 // PreexecData matches the structure from precmd-hook
@@ -37,23 +39,23 @@ func parseTimestamp(t string) time.Time {
     return ts
 }
 
-func parsePreexecData(encodedData string, config *EnvConfig) (*PreexecData, map[string]string, error) {
+func parsePreexecData(encodedData string, config *EnvConfig) (*PreexecData, map[string]string, map[string]string, error) {
     if encodedData == "" {
-        return nil, nil, fmt.Errorf("no preexec data provided")
+        return nil, nil, nil, fmt.Errorf("no preexec data provided")
     }
-    
+
     // Decode base64
     decoded, err := base64.StdEncoding.DecodeString(encodedData)
     if err != nil {
-        return nil, nil, fmt.Errorf("failed to decode preexec data: %v", err)
+        return nil, nil, nil, fmt.Errorf("failed to decode preexec data: %v", err)
     }
-    
+
     // Parse JSON
     var data PreexecData
     if err := json.Unmarshal(decoded, &data); err != nil {
-        return nil, nil, fmt.Errorf("failed to parse preexec JSON: %v", err)
+        return nil, nil, nil, fmt.Errorf("failed to parse preexec JSON: %v", err)
     }
-    
+
     // Convert environment slice to map and apply filtering
     rawEnv := make(map[string]string)
     for _, envVar := range data.Environment {
@@ -62,11 +64,11 @@ func parsePreexecData(encodedData string, config *EnvConfig) (*PreexecData, map[
             rawEnv[parts[0]] = parts[1]
         }
     }
-    
+
     // Apply configuration-based filtering
-    filteredEnv := config.FilterEnvironment(rawEnv)
-    
-    return &data, filteredEnv, nil
+    filteredEnv, reasons := config.FilterEnvironmentWithReasons(rawEnv)
+
+    return &data, filteredEnv, reasons, nil
 }
 
 // Legacy function for backward compatibility
@@ -105,6 +107,55 @@ func parseEnvironmentString(envData string, config *EnvConfig) (map[string]strin
     return config.FilterEnvironment(rawEnv), nil
 }
 
+// attachNetworkSummary queries the netcapture daemon (if any) started by
+// preexec-hook for this shell session, and aggregates packets observed in
+// [start, end] into the tuples attached to the event. Missing daemon or
+// query errors are swallowed since network capture is always best-effort.
+func attachNetworkSummary(pidFile string, start, end time.Time) []netcapture.Peer {
+    if pidFile == "" {
+        pidFile = defaultCapturePidfilePath()
+    }
+
+    pf, err := netcapture.ReadPidFile(pidFile)
+    if err != nil {
+        return nil
+    }
+
+    peers, err := netcapture.Query(pf.SocketPath, start, end)
+    if err != nil {
+        return nil
+    }
+    return peers
+}
+
+// toNetworkPeers converts netcapture's Peer tuples to the schema's
+// NetworkPeer messages so they can travel inside a CommandEvent.
+func toNetworkPeers(peers []netcapture.Peer) []*schema.NetworkPeer {
+    out := make([]*schema.NetworkPeer, 0, len(peers))
+    for _, p := range peers {
+        out = append(out, &schema.NetworkPeer{
+            RemoteIp:          p.RemoteIP,
+            RemotePort:        int32(p.RemotePort),
+            Proto:             p.Proto,
+            BytesSent:         p.BytesSent,
+            BytesRecv:         p.BytesRecv,
+            FirstSeenUnixNano: p.FirstSeen.UnixNano(),
+            LastSeenUnixNano:  p.LastSeen.UnixNano(),
+            Sni:               p.SNI,
+            Host:              p.Host,
+        })
+    }
+    return out
+}
+
+func defaultCapturePidfilePath() string {
+    root := os.Getenv("TOTALRECALLROOT")
+    if root == "" {
+        root = os.TempDir()
+    }
+    return filepath.Join(root, fmt.Sprintf("netcapture-%d.pid", os.Getppid()))
+}
+
 func getHostname() string {
     hostname, err := os.Hostname()
     if err != nil {
@@ -113,84 +164,63 @@ func getHostname() string {
     return hostname
 }
 
-func getLocalIP() string {
-    addrs, err := net.InterfaceAddrs()
-    if err != nil {
-        return ""
-    }
-    for _, addr := range addrs {
-        if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-            if ipnet.IP.To4() != nil {
-                return ipnet.IP.String()
-            }
-        }
-    }
-    return ""
+// endpointListFlag collects repeated -es flag values in order, letting
+// callers try a Unix-socket proxy first and fall back to a direct
+// connection - the same flag shape export.go/import.go use. Duplicated here
+// rather than shared because this tool is its own "main" package.
+type endpointListFlag []string
+
+func (f *endpointListFlag) String() string {
+	return strings.Join(*f, ",")
 }
 
-func sendViaUnixSocket(data []byte, socketPath string, timeout time.Duration) error {
-	// Connect to unix domain socket
-	conn, err := net.DialTimeout("unix", socketPath, timeout)
-	if err != nil {
-		return fmt.Errorf("failed to connect to proxy socket: %v", err)
+func (f *endpointListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// defaultESEndpoints is the fallback chain used when no -es flags are given.
+var defaultESEndpoints = []string{
+	"unix:///tmp/totalrecall-proxy.sock",
+	"https://localhost:9243",
+}
+
+// connectES resolves esFlags (or defaultESEndpoints when empty) into
+// endpoints and dials the first one that responds.
+func connectES(esFlags endpointListFlag) (*estransport.ProxiedESClient, error) {
+	if len(esFlags) == 0 {
+		esFlags = defaultESEndpoints
 	}
-	defer conn.Close()
 
-	// Set write deadline
-	conn.SetWriteDeadline(time.Now().Add(timeout))
-	
-	// Send data
-	_, err = conn.Write(append(data, '\n'))
-	if err != nil {
-		return fmt.Errorf("failed to send data: %v", err)
+	endpoints := make([]estransport.Endpoint, 0, len(esFlags))
+	for _, raw := range esFlags {
+		ep, err := estransport.ParseEndpoint(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -es endpoint: %v", err)
+		}
+		endpoints = append(endpoints, ep)
 	}
 
-	return nil
+	return estransport.NewESClientWithFallback(endpoints)
 }
 
-func sendDirectTLS(data []byte, host, port string, enableTLS bool, caFile, certFile, keyFile string, timeout time.Duration) error {
-    address := fmt.Sprintf("%s:%s", host, port)
-    
-    if enableTLS {
-        // ... existing TLS connection code ...
-        caCert, err := ioutil.ReadFile(caFile)
-        if err != nil {
-            return fmt.Errorf("error loading CA certificate: %v", err)
-        }
-        caCertPool := x509.NewCertPool()
-        caCertPool.AppendCertsFromPEM(caCert)
-        
-        cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-        if err != nil {
-            return fmt.Errorf("error loading client certificate: %v", err)
-        }
-        
-        tlsConfig := &tls.Config{
-            RootCAs:            caCertPool,
-            Certificates:       []tls.Certificate{cert},
-            InsecureSkipVerify: false,
-        }
-        
-        dialer := &net.Dialer{Timeout: timeout}
-        conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
-        if err != nil {
-            return fmt.Errorf("error connecting with TLS: %v", err)
-        }
-        defer conn.Close()
-        
-        _, err = conn.Write(append(data, '\n'))
-        return err
-    } else {
-        // ... existing non-TLS connection code ...
-        conn, err := net.DialTimeout("tcp", address, timeout)
-        if err != nil {
-            return err
-        }
-        defer conn.Close()
-        
-        _, err = conn.Write(append(data, '\n'))
-        return err
-    }
+// esEventSink adapts a ProxiedESClient to eventsink.EventSink by decoding
+// the JSON-encoded command event and indexing it directly, the same path
+// runConsume's forwardToES uses for events arriving over JetStream.
+type esEventSink struct {
+	client  *estransport.ProxiedESClient
+	timeout time.Duration
+}
+
+func (s esEventSink) Publish(ctx context.Context, data []byte) error {
+	var cmd estransport.Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return fmt.Errorf("decoding command event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.client.IndexCommand(ctx, cmd)
 }
 
 func main() {
@@ -200,29 +230,50 @@ func main() {
     // Legacy flags for backward compatibility
     returnCodePtr := flag.String("return-code", "", "Return code.")
     endTimestampPtr := flag.String("end-timestamp", "", "End timestamp (optional - will use current time if not provided).")
-    hostPtr := flag.String("host", "127.0.0.1", "Fluent-bit TCP host.")
-    portPtr := flag.String("port", "5170", "Fluent-bit TCP port.")
+    var esFlags endpointListFlag
+    flag.Var(&esFlags, "es", "ES endpoint to try, in order. May be repeated; defaults to the proxy socket then the direct HAProxy endpoint.")
     configPtr := flag.String("env-config", "", "Path to environment filtering configuration file.")
     generateConfigPtr := flag.Bool("generate-config", false, "Generate default configuration file and exit.")
     testPtr := flag.Bool("test", false, "Test environment filtering and print results without sending data.")
-    useSocketPtr := flag.Bool("use-socket", false, "Use unix domain socket proxy instead of direct TLS")
-    socketPathPtr := flag.String("socket-path", "/tmp/totalrecall-proxy.sock", "Unix domain socket path")
-     
+    captureNetworkPtr := flag.Bool("capture-network", false, "Attach a network activity summary from the netcapture daemon started by preexec-hook.")
+    captureNetworkPidfilePtr := flag.String("capture-pidfile", "", "Pidfile written by preexec-hook's netcapture daemon (defaults to the same path preexec-hook uses).")
+    spoolPtr := flag.Bool("spool", false, "Append the event to a local spool instead of sending it directly, for a separate --flush-now/--daemon process to bulk-forward.")
+    spoolMaxBytesPtr := flag.Int64("spool-max-bytes", 0, "Spool size cap in bytes for --spool; 0 uses the 32MB default. --flush-now/--daemon do not apply it.")
+    flushNowPtr := flag.Bool("flush-now", false, "Drain every spooled event through a BulkIndexer, then exit.")
+    daemonPtr := flag.Bool("daemon", false, "Run --flush-now on a timer instead of once, as a resident flusher.")
+    flushIntervalPtr := flag.Duration("flush-interval", 10*time.Second, "Interval between sweeps in --daemon mode.")
+    flushTimeoutPtr := flag.Duration("flush-timeout", 30*time.Second, "Max time to wait for a sweep's BulkIndexer to drain.")
+
     timeout, err := time.ParseDuration("3s")
     if err != nil {
 	   fmt.Println("error:", err)
 	   return
     }
-    timeoutPtr := flag.Duration("timeout", timeout, "Fluent bit connection timeout.")
-    
-    // Add TLS certificate flags
-    enableTLSPtr := flag.Bool("tls", false, "Enable TLS connection")
-    caFilePtr := flag.String("tls-ca-file", "certs/ca.crt", "CA certificate file")
-    certFilePtr := flag.String("tls-cert-file", "certs/client.crt", "Client certificate file")
-    keyFilePtr := flag.String("tls-key-file", "certs/client.key", "Client private key file")
-    
+    timeoutPtr := flag.Duration("timeout", timeout, "ES request timeout.")
+
     flag.Parse()
-    
+
+    // Handle spool-and-forward: bulk-ingest whatever --spool has queued, once
+    // (--flush-now) or on a timer (--daemon).
+    if *flushNowPtr || *daemonPtr {
+        sweepOnce := func() {
+            flushed, err := bulkFlush(esFlags, *flushTimeoutPtr)
+            if err != nil {
+                fmt.Println("error flushing spool:", err)
+            } else if flushed > 0 {
+                fmt.Printf("flushed %d spooled events\n", flushed)
+            }
+        }
+
+        sweepOnce()
+        if *daemonPtr {
+            for range time.Tick(*flushIntervalPtr) {
+                sweepOnce()
+            }
+        }
+        return
+    }
+
     // Handle config generation
     if *generateConfigPtr {
         configPath := *configPtr
@@ -284,74 +335,73 @@ func main() {
         return
     }
     
-    var event map[string]interface{}
-    var env map[string]string
-    
     // Parse preexec data
-    preexecData, filteredEnv, err := parsePreexecData(*preexecDataPtr, envConfig)
+    preexecData, filteredEnv, redactionReasons, err := parsePreexecData(*preexecDataPtr, envConfig)
     if err != nil {
         fmt.Println("error parsing preexec data:", err)
         return
     }
-    
-    env = filteredEnv
-    event = make(map[string]interface{})
-    event["command"] = strings.TrimSpace(preexecData.Command)
-    event["start_timestamp"] = preexecData.StartTimestamp
-    event["pwd"] = preexecData.Pwd
-    
+
     // Common processing for both formats
     returnCode, err := strconv.Atoi(*returnCodePtr)
     if err != nil {
         fmt.Println("error:", err)
         return
     }
-    event["return_code"] = returnCode
+
+    var endTimestamp time.Time
     if *endTimestampPtr != "" {
         // Backward compatibility: use provided timestamp
-        event["end_timestamp"] = parseTimestamp(*endTimestampPtr)
+        endTimestamp = parseTimestamp(*endTimestampPtr)
     } else {
         // New behavior: generate timestamp in Go (eliminates gdate dependency)
-        event["end_timestamp"] = time.Now()
+        endTimestamp = time.Now()
     }
-    event["hostname"] = getHostname()
-    
-    // Add IP address if available
-    if ip := getLocalIP(); ip != "" {
-        event["ip_address"] = ip
+
+    ev := schema.NewCommandEvent(strings.TrimSpace(preexecData.Command), preexecData.Pwd, preexecData.StartTimestamp, endTimestamp, returnCode, filteredEnv)
+    ev.Host = getHostname()
+    if len(redactionReasons) > 0 {
+        ev.RedactionReasons = redactionReasons
     }
-    
-    // Only include env in the event if it's not empty
-    if len(env) > 0 {
-        event["env"] = env
+
+    if *captureNetworkPtr {
+        if peers := attachNetworkSummary(*captureNetworkPidfilePtr, preexecData.StartTimestamp, endTimestamp); len(peers) > 0 {
+            ev.Network = toNetworkPeers(peers)
+        }
+    }
+
+    jsonDoc, err := json.Marshal(ev)
+    if err != nil {
+        fmt.Println("error encoding event:", err)
+        return
     }
-    
-    j, err := json.Marshal(event)
-	if err != nil {
-		fmt.Println("error:", err)
-		return
-	}
 
-    // Choose connection method
-    if *useSocketPtr {
-        // Use unix domain socket proxy (fast path)
-        if err := sendViaUnixSocket(j, *socketPathPtr, *timeoutPtr); err != nil {
-            // Fallback to direct TLS if socket proxy is down
-            fmt.Printf("Socket proxy failed, falling back to direct TLS: %v\n", err)
-            sendDirectTLS(j, *hostPtr, *portPtr, *enableTLSPtr, *caFilePtr, *certFilePtr, *keyFilePtr, *timeoutPtr)
+    if *spoolPtr {
+        item, err := json.Marshal(estransport.BulkItem{Body: jsonDoc})
+        if err != nil {
+            fmt.Println("error encoding spooled item:", err)
+            return
         }
-    } else if *enableTLSPtr{
-        // Use direct TLS connection (original behavior)
-        sendDirectTLS(j, *hostPtr, *portPtr, *enableTLSPtr, *caFilePtr, *certFilePtr, *keyFilePtr, *timeoutPtr)
-    } else {
-        // Original non-TLS connection
-        address := fmt.Sprintf("%s:%s", hostPtr, portPtr)
-        conn, err := net.DialTimeout("tcp", address, *timeoutPtr)
+        s, err := openBulkSpool(*spoolMaxBytesPtr)
         if err != nil {
             fmt.Println("error:", err)
             return
         }
-        fmt.Fprintf(conn, string(j) + "\n")
-        conn.Close()
+        if _, err := s.Write(item); err != nil {
+            fmt.Println("error spooling event:", err)
+        }
+        return
+    }
+
+    client, err := connectES(esFlags)
+    if err != nil {
+        fmt.Println("error:", err)
+        return
+    }
+    defer client.Close()
+
+    var sink eventsink.EventSink = esEventSink{client: client, timeout: *timeoutPtr}
+    if err := sink.Publish(context.Background(), jsonDoc); err != nil {
+        fmt.Println("error:", err)
     }
 }
@@ -3,10 +3,17 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
+
+	"totalrecall/pkg/netcapture"
+	"totalrecall/pkg/suggestlog"
 )
 
 // PreexecData holds all the data we need to collect before command execution
@@ -18,14 +25,28 @@ type PreexecData struct {
 }
 
 func main() {
-	// Get command from arguments
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <command>\n", os.Args[0])
+	captureNetwork := flag.Bool("capture-network", false, "Capture per-command network activity via gopacket (requires CAP_NET_RAW).")
+	captureIface := flag.String("capture-iface", "any", "Interface to capture on when --capture-network is set.")
+	pidFile := flag.String("capture-pidfile", defaultPidFilePath(), "Where to write the capture pidfile.")
+	flag.Parse()
+
+	// Get command from positional arguments (flags above are consumed first)
+	args := flag.Args()
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [--capture-network] <command>\n", os.Args[0])
 		os.Exit(1)
 	}
-	
-	command := os.Args[1]
-	
+
+	command := args[0]
+
+	if *captureNetwork {
+		if err := startCapture(*captureIface, *pidFile); err != nil {
+			// Network capture is best-effort: never block the shell prompt
+			// because CAP_NET_RAW is missing or pcap isn't available.
+			fmt.Fprintf(os.Stderr, "warning: network capture not started: %v\n", err)
+		}
+	}
+
 	// Gather all data in one go
 	data := PreexecData{
 		Command:        command,
@@ -33,19 +54,85 @@ func main() {
 		StartTimestamp: time.Now(),
 		Environment:    getFilteredEnvironment(),
 	}
-	
+
+	// Record which command the user actually ran against the suggestions
+	// shelper showed for this pwd, so totalrecall-train can pair them up.
+	if err := suggestlog.NewLogger().Append(suggestlog.Record{
+		Kind:        "accepted",
+		Timestamp:   data.StartTimestamp,
+		ContextHash: suggestlog.ContextHash(data.Pwd),
+		Command:     data.Command,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to log accepted suggestion: %v\n", err)
+	}
+
 	// Marshal to JSON
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error marshaling data: %v\n", err)
 		os.Exit(1)
 	}
-	
+
 	// Base64 encode for safe shell transport
 	encoded := base64.StdEncoding.EncodeToString(jsonData)
 	fmt.Print(encoded)
 }
 
+// startCapture launches `totalrecall netcapture-daemon` detached from this
+// short-lived preexec process, once per shell session (identified by the
+// parent PID), so its pcap handle and ring buffer outlive any single
+// preexec/postexec invocation. postexec later queries the daemon's socket
+// directly via netcapture.Query.
+func startCapture(iface, pidFile string) error {
+	if pf, err := netcapture.ReadPidFile(pidFile); err == nil {
+		if processAlive(pf.PID) {
+			// A capture daemon is already running for this shell; reuse it.
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pidFile), 0755); err != nil {
+		return fmt.Errorf("creating pidfile dir: %v", err)
+	}
+
+	socketPath := strings.TrimSuffix(pidFile, ".pid") + ".sock"
+
+	totalrecallBin, err := exec.LookPath("totalrecall")
+	if err != nil {
+		return fmt.Errorf("locating totalrecall binary: %v", err)
+	}
+
+	cmd := exec.Command(totalrecallBin, "netcapture-daemon",
+		"--iface", iface,
+		"--socket", socketPath,
+		"--pidfile", pidFile,
+	)
+	cmd.Stdout, cmd.Stderr = nil, nil
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting netcapture daemon: %v", err)
+	}
+
+	return nil
+}
+
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
+
+func defaultPidFilePath() string {
+	root := os.Getenv("TOTALRECALLROOT")
+	if root == "" {
+		root = os.TempDir()
+	}
+	return filepath.Join(root, fmt.Sprintf("netcapture-%d.pid", os.Getppid()))
+}
+
 func getPwd() string {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -57,20 +144,20 @@ func getPwd() string {
 func getFilteredEnvironment() []string {
 	env := os.Environ()
 	filtered := make([]string, 0, len(env))
-	
+
 	for _, envVar := range env {
 		// Skip our temporary preexec variables and shell internals
 		if strings.HasPrefix(envVar, "___PREEXEC_") ||
-		   strings.HasPrefix(envVar, "_=") ||
-		   strings.HasPrefix(envVar, "PS1=") ||
-		   strings.HasPrefix(envVar, "PS2=") ||
-		   strings.HasPrefix(envVar, "BASH_") ||
-		   strings.HasPrefix(envVar, "FUNCNAME=") ||
-		   strings.HasPrefix(envVar, "PIPESTATUS=") {
+			strings.HasPrefix(envVar, "_=") ||
+			strings.HasPrefix(envVar, "PS1=") ||
+			strings.HasPrefix(envVar, "PS2=") ||
+			strings.HasPrefix(envVar, "BASH_") ||
+			strings.HasPrefix(envVar, "FUNCNAME=") ||
+			strings.HasPrefix(envVar, "PIPESTATUS=") {
 			continue
 		}
 		filtered = append(filtered, envVar)
 	}
-	
+
 	return filtered
 }
@@ -1,31 +1,32 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"log"
 	"os"
 	"time"
 
 	"github.com/nats-io/nats.go"
-)
 
-// CommandData represents the shell command and environment
-type CommandData struct {
-	Environment map[string]string `json:"environment"`
-	Timestamp   time.Time         `json:"timestamp"`
-}
+	"totalrecall/pkg/encoding"
+	"totalrecall/pkg/eventsink"
+	"totalrecall/pkg/jetstream"
+	"totalrecall/pkg/schema"
+)
 
 func main() {
+	encodingPtr := flag.String("encoding", string(encoding.JSON), "Wire encoding for the published event: json or protobuf.")
+	flag.Parse()
 
-	// NATS connection setup
 	natsURL := os.Getenv("NATS_URL")
 	if natsURL == "" {
-		natsURL = nats.DefaultURL // localhost:4222
+		natsURL = nats.DefaultURL
 	}
 
 	// TLS configuration
 	opts := []nats.Option{}
-	
+
 	// Add TLS options if enabled
 	if os.Getenv("NATS_TLS") == "true" {
 		// If you have client certificates
@@ -35,44 +36,45 @@ func main() {
 				os.Getenv("NATS_KEY"),
 			))
 		}
-		
+
 		// If you have a CA certificate
 		if os.Getenv("NATS_CA") != "" {
 			opts = append(opts, nats.RootCAs(os.Getenv("NATS_CA")))
 		}
 	}
 
-	// Connect to NATS with timeout
-	nc, err := nats.Connect(natsURL, opts...)
+	// Connect and ensure the TOTALRECALL JetStream stream exists, instead of
+	// the previous fire-and-forget core NATS publish.
+	cfg := jetstream.DefaultConfig()
+	cfg.URL = natsURL
+	nc, js, err := jetstream.Connect(cfg, opts...)
 	if err != nil {
-		log.Fatalf("Error connecting to NATS: %v", err)
+		log.Fatalf("Error connecting to NATS JetStream: %v", err)
 	}
 	defer nc.Close()
 
-	// Create the data structure
-	data := CommandData{
-		Environment: map[string]string{
-			"PWD": os.Getenv("PWD"),
-		},
-		Timestamp: time.Now(),
-	}
+	// Build the same CommandEvent shape preexec/postexec publish, so
+	// downstream consumers only ever handle one schema.
+	now := time.Now()
+	ev := schema.NewCommandEvent("", "", now, now, 0, map[string]string{
+		"PWD": os.Getenv("PWD"),
+	})
 
-	// Convert to JSON
-	jsonData, err := json.Marshal(data)
+	enc, err := encoding.New(encoding.Name(*encodingPtr))
 	if err != nil {
-		log.Fatalf("Error marshaling JSON: %v", err)
+		log.Fatalf("Error resolving encoding: %v", err)
 	}
 
-	// Publish to NATS
-	subject := "totalrecall"
-	err = nc.Publish(subject, jsonData)
+	data, err := enc.Marshal(ev)
 	if err != nil {
-		log.Fatalf("Error publishing to NATS: %v", err)
+		log.Fatalf("Error marshaling event: %v", err)
 	}
 
-	// Ensure delivery with flush
-	err = nc.Flush()
-	if err != nil {
-		log.Fatalf("Error flushing NATS connection: %v", err)
+	// Publish to JetStream, at-least-once, and wait for the ack before
+	// exiting so the pwd update is durable across collector restarts.
+	subject := jetstream.SubjectPrefix + ".pwd"
+	var sink eventsink.EventSink = jetstream.Sink{JS: js, Subject: subject, AckTimeout: cfg.AckTimeout}
+	if err := sink.Publish(context.Background(), data); err != nil {
+		log.Fatalf("Error publishing to JetStream: %v", err)
 	}
 }
@@ -2,30 +2,45 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
-    "io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"totalrecall/pkg/dirsuggest"
+	"totalrecall/pkg/metrics"
 )
 
 // Event represents a shell command event
 type Event struct {
-	Command        string                 `json:"command"`
-	ReturnCode     int                    `json:"return_code"`
-	StartTimestamp time.Time              `json:"start_timestamp"`
-	EndTimestamp   time.Time              `json:"end_timestamp"`
-	Pwd            string                 `json:"pwd"`
-	Hostname       string                 `json:"hostname"`
-	IPAddress      string                 `json:"ip_address,omitempty"`
-	Env            map[string]string      `json:"env,omitempty"`
-	ConfigVersion  string                 `json:"_config_version,omitempty"`
+	ID             uint64            `json:"id"`
+	Command        string            `json:"command"`
+	ReturnCode     int               `json:"return_code"`
+	StartTimestamp time.Time         `json:"start_timestamp"`
+	EndTimestamp   time.Time         `json:"end_timestamp"`
+	Pwd            string            `json:"pwd"`
+	Hostname       string            `json:"hostname"`
+	IPAddress      string            `json:"ip_address,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	ConfigVersion  string            `json:"_config_version,omitempty"`
+	PublishedAtNs  int64             `json:"_published_at_unix_nano,omitempty"`
 }
 
 // PubSubClient handles connection to the proxy
@@ -33,6 +48,7 @@ type PubSubClient struct {
 	socketPath string
 	conn       net.Conn
 	scanner    *bufio.Scanner
+	ctx        context.Context
 }
 
 func NewPubSubClient(socketPath string) *PubSubClient {
@@ -41,60 +57,94 @@ func NewPubSubClient(socketPath string) *PubSubClient {
 	}
 }
 
-func (c *PubSubClient) Connect() error {
+// Connect dials the proxy and arranges for ctx's cancellation to unblock any
+// in-flight or future ReadEvent by forcing the underlying conn's read
+// deadline into the past, the same done-channel-to-context substitution
+// Syncthing's util services use instead of os.Exit from a signal goroutine.
+func (c *PubSubClient) Connect(ctx context.Context) error {
 	conn, err := net.Dial("unix", c.socketPath)
 	if err != nil {
 		return fmt.Errorf("failed to connect to %s: %v", c.socketPath, err)
 	}
-	
+
 	c.conn = conn
 	c.scanner = bufio.NewScanner(conn)
+	c.ctx = ctx
+
+	go func() {
+		<-ctx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
 	return nil
 }
 
-func (c *PubSubClient) Subscribe(subscriberID string, filter string) error {
+// Subscribe sends SUBSCRIBE subscriberID, joining filter with a SINCE=
+// clause when sinceID is nonzero so the proxy replays everything after
+// sinceID (see pkg/eventindex) before switching to live tailing.
+func (c *PubSubClient) Subscribe(subscriberID string, filter string, sinceID uint64) error {
 	if c.conn == nil {
 		return fmt.Errorf("not connected")
 	}
-	
+
+	if sinceID > 0 {
+		sinceClause := fmt.Sprintf("SINCE=%d", sinceID)
+		if filter != "" {
+			filter = sinceClause + " " + filter
+		} else {
+			filter = sinceClause
+		}
+	}
+
 	subscribeCmd := fmt.Sprintf("SUBSCRIBE %s", subscriberID)
 	if filter != "" {
 		subscribeCmd += " " + filter
 	}
 	subscribeCmd += "\n"
-	
+
 	_, err := c.conn.Write([]byte(subscribeCmd))
 	return err
 }
 
 func (c *PubSubClient) ReadEvent() (*Event, error) {
 	if !c.scanner.Scan() {
+		// A cancelled ctx forces the read deadline into the past, which
+		// surfaces here as a scanner timeout; report the ctx error instead
+		// so callers can tell a deliberate shutdown from a dropped socket.
+		if c.ctx != nil && c.ctx.Err() != nil {
+			return nil, c.ctx.Err()
+		}
 		if err := c.scanner.Err(); err != nil {
 			return nil, err
 		}
 		return nil, fmt.Errorf("connection closed")
 	}
-	
+
 	line := strings.TrimSpace(c.scanner.Text())
-	
+
 	// Skip empty lines
 	if line == "" {
 		return c.ReadEvent() // Recursively read next event
 	}
-	
+
 	// Skip protocol messages
-	if strings.HasPrefix(line, "SUBSCRIBED") || strings.HasPrefix(line, "PONG") {
+	if strings.HasPrefix(line, "SUBSCRIBED") || strings.HasPrefix(line, "PONG") || line == "HISTORY_DONE" || strings.HasPrefix(line, "LAGGED ") {
 		return c.ReadEvent() // Recursively read next event
 	}
-	
-	// Debug: log what we're trying to parse
-	log.Printf("Debug: Attempting to parse JSON: %s", line)
-	
+
 	var event Event
 	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		metrics.ParseErrorsTotal.Inc()
 		return nil, fmt.Errorf("failed to parse event JSON '%s': %v", line, err)
 	}
-	
+
+	metrics.EventsReceivedTotal.Inc()
+	metrics.CommandDurationSeconds.Observe(event.EndTimestamp.Sub(event.StartTimestamp).Seconds())
+	if event.PublishedAtNs > 0 {
+		latency := time.Since(time.Unix(0, event.PublishedAtNs))
+		metrics.ProxyLatencySeconds.Observe(latency.Seconds())
+	}
+
 	return &event, nil
 }
 
@@ -114,165 +164,462 @@ func (c *PubSubClient) Close() error {
 	return c.conn.Close()
 }
 
-// Simple reactive TUI that displays recent commands
-type ReactiveTUI struct {
-	client       *PubSubClient
-	recentEvents []*Event
-	maxEvents    int
+// lastEventIDPath returns ~/.totalrecall/reactive-tui-cursor, where the TUI
+// remembers the last event ID it displayed so a crash or restart can resume
+// with SUBSCRIBE ... SINCE= instead of dropping back to live-only.
+func lastEventIDPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".totalrecall", "reactive-tui-cursor")
 }
 
-func NewReactiveTUI(socketPath string, maxEvents int) *ReactiveTUI {
-	return &ReactiveTUI{
-		client:    NewPubSubClient(socketPath),
-		maxEvents: maxEvents,
+func readLastEventID() uint64 {
+	data, err := os.ReadFile(lastEventIDPath())
+	if err != nil {
+		return 0
+	}
+	id, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0
 	}
+	return id
 }
 
-func (tui *ReactiveTUI) Start() error {
-	if err := tui.client.Connect(); err != nil {
+func writeLastEventID(id uint64) error {
+	path := lastEventIDPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
-	defer tui.client.Close()
-	
-	// Subscribe to all events
-	if err := tui.client.Subscribe("reactive-tui", ""); err != nil {
-		return err
+	return os.WriteFile(path, []byte(strconv.FormatUint(id, 10)), 0o644)
+}
+
+var (
+	listStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Padding(0, 1)
+
+	detailStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Padding(0, 1)
+
+	selectedRowStyle = lipgloss.NewStyle().
+				Bold(true).
+				Foreground(lipgloss.Color("230")).
+				Background(lipgloss.Color("62"))
+
+	okStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	failStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
+	dimStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))
+	statusStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("230")).
+			Background(lipgloss.Color("24")).
+			Padding(0, 1)
+)
+
+// eventMsg carries the next event, or the terminal error, off the
+// subscriber goroutine and into the bubbletea event loop.
+type eventMsg struct {
+	event *Event
+	err   error
+}
+
+// model is the bubbletea model for the reactive TUI: an append-only event
+// log on the left, a detail pane for the highlighted event on the right,
+// and a status bar that doubles as the search prompt.
+type model struct {
+	client    *PubSubClient
+	events    chan eventMsg
+	allEvents []*Event
+	visible   []int // indices into allEvents passing the current filter/search
+	cursor    int
+
+	searching    bool
+	searchInput  textinput.Model
+	failuresOnly bool
+
+	detail viewport.Model
+	status string
+
+	suggest    *dirsuggest.Model
+	lastCmdDir map[string]string // dir -> most recent command seen there, for Observe's bigram
+
+	width, height int
+	maxEvents     int
+}
+
+func newModel(client *PubSubClient, maxEvents int, suggest *dirsuggest.Model) model {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.CharLimit = 200
+
+	return model{
+		client:      client,
+		events:      make(chan eventMsg, 64),
+		searchInput: search,
+		detail:      viewport.New(0, 0),
+		suggest:     suggest,
+		lastCmdDir:  make(map[string]string),
+		maxEvents:   maxEvents,
+		status:      "watching for shell commands... (/ search, f failures-only, enter copy, q quit)",
 	}
-	
-	fmt.Printf("\033[2J\033[H") // Clear screen
-	fmt.Println("ðŸš€ Total Recall Reactive TUI")
-	fmt.Println("Watching for shell commands...")
-	fmt.Println(strings.Repeat("-", 80))
-	
-	// Handle Ctrl+C gracefully
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	
-	go func() {
-		<-sigChan
-		fmt.Printf("\n\nðŸ‘‹ Shutting down TUI...\n")
-		tui.client.Close()
-		os.Exit(0)
-	}()
-	
-	// Read and display events
-	for {
-		event, err := tui.client.ReadEvent()
-		if err != nil {
-			return fmt.Errorf("error reading event: %v", err)
+}
+
+func (m model) Init() tea.Cmd {
+	return waitForEvent(m.events)
+}
+
+// waitForEvent blocks on the subscriber channel and turns the next message
+// into a tea.Msg; Update re-issues this command after every event so the
+// channel is drained one message at a time instead of buffering in a Cmd.
+func waitForEvent(events chan eventMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		return m, nil
+
+	case eventMsg:
+		if msg.err != nil {
+			if errors.Is(msg.err, context.Canceled) || errors.Is(msg.err, context.DeadlineExceeded) {
+				return m, tea.Quit
+			}
+			m.status = fmt.Sprintf("error: %v", msg.err)
+			return m, nil
 		}
-		
-		tui.addEvent(event)
-		tui.render()
+		m.addEvent(msg.event)
+		m.applyFilter()
+		m.syncDetail()
+		return m, waitForEvent(m.events)
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
 	}
+
+	return m, nil
 }
 
-func (tui *ReactiveTUI) addEvent(event *Event) {
-	tui.recentEvents = append(tui.recentEvents, event)
-	
-	// Keep only recent events
-	if len(tui.recentEvents) > tui.maxEvents {
-		tui.recentEvents = tui.recentEvents[1:]
+func (m *model) layout() {
+	listWidth := m.width * 2 / 5
+	if listWidth < 20 {
+		listWidth = 20
 	}
+	detailWidth := m.width - listWidth - 6 // borders/padding on both panes
+	bodyHeight := m.height - 4             // title line + status bar + borders
+
+	m.detail.Width = detailWidth
+	m.detail.Height = bodyHeight
 }
 
-func (tui *ReactiveTUI) render() {
-	// Move cursor to top and clear screen content
-	fmt.Printf("\033[H")
-	
-	fmt.Printf("ðŸš€ Total Recall Reactive TUI - %s\n", time.Now().Format("15:04:05"))
-	fmt.Printf("Recent commands (last %d):\n", len(tui.recentEvents))
-	fmt.Println(strings.Repeat("-", 80))
-	
-	if len(tui.recentEvents) == 0 {
-		fmt.Println("No commands yet...")
-		return
-	}
-	
-	// Display recent events
-	for i, event := range tui.recentEvents {
-		duration := event.EndTimestamp.Sub(event.StartTimestamp)
-		statusIcon := "âœ…"
-		if event.ReturnCode != 0 {
-			statusIcon = "âŒ"
+func (m *model) addEvent(event *Event) {
+	m.allEvents = append(m.allEvents, event)
+	if len(m.allEvents) > m.maxEvents {
+		m.allEvents = m.allEvents[1:]
+	}
+
+	m.suggest.Observe(event.Pwd, m.lastCmdDir[event.Pwd], event.Command, event.ReturnCode)
+	m.lastCmdDir[event.Pwd] = event.Command
+
+	if event.ID > readLastEventID() {
+		if err := writeLastEventID(event.ID); err != nil {
+			log.Printf("warning: failed to persist last event id: %v", err)
 		}
-		
-		// Truncate long commands
-		command := event.Command
-		if len(command) > 50 {
-			command = command[:47] + "..."
+	}
+}
+
+// applyFilter recomputes visible from allEvents, the failures-only toggle,
+// and the current search query, keeping the cursor on the bottom (most
+// recent) entry unless the user has scrolled up.
+func (m *model) applyFilter() {
+	atBottom := m.cursor >= len(m.visible)-1
+
+	query := strings.ToLower(m.searchInput.Value())
+	visible := m.visible[:0]
+	for i, e := range m.allEvents {
+		if m.failuresOnly && e.ReturnCode == 0 {
+			continue
 		}
-		
-		// Truncate long paths
-		pwd := event.Pwd
-		if len(pwd) > 20 {
-			parts := strings.Split(pwd, "/")
-			if len(parts) > 2 {
-				pwd = ".../" + strings.Join(parts[len(parts)-2:], "/")
-			}
+		if query != "" && !fuzzyMatch(query, strings.ToLower(e.Command)) {
+			continue
 		}
-		
-		fmt.Printf("%2d. %s %-50s %20s (%4.0fms)\n", 
-			i+1, statusIcon, command, pwd, float64(duration.Nanoseconds())/1000000)
-	}
-	
-	// Show current stats
-	fmt.Printf("\nðŸ“Š Stats: %d events displayed\n", len(tui.recentEvents))
-	
-	// Future enhancement suggestions
-	if len(tui.recentEvents) >= 5 {
-		tui.suggestCommands()
+		visible = append(visible, i)
+	}
+	m.visible = visible
+
+	if atBottom || m.cursor >= len(m.visible) {
+		m.cursor = len(m.visible) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
 	}
 }
 
-func (tui *ReactiveTUI) suggestCommands() {
-	fmt.Println("\nðŸ’¡ Suggested commands based on current directory:")
-	
-	if len(tui.recentEvents) == 0 {
-		return
-	}
-	
-	lastEvent := tui.recentEvents[len(tui.recentEvents)-1]
-	currentDir := lastEvent.Pwd
-	
-	// Analyze recent commands in this directory
-	dirCommands := make(map[string]int)
-	for _, event := range tui.recentEvents {
-		if event.Pwd == currentDir && event.ReturnCode == 0 {
-			dirCommands[event.Command]++
+// fuzzyMatch reports whether every rune of query appears in text in order,
+// not necessarily contiguously - the same subsequence match fzf and most
+// editor "quick open" pickers use for incremental search.
+func fuzzyMatch(query, text string) bool {
+	i := 0
+	for _, r := range text {
+		if i >= len(query) {
+			return true
+		}
+		if r == rune(query[i]) {
+			i++
 		}
 	}
-	
-	// Simple heuristics for suggestions
-	suggestions := []string{}
-	
-	// Check if it's a git repo
-	if hasGitCommands := false; !hasGitCommands {
-		for cmd := range dirCommands {
-			if strings.Contains(cmd, "git") {
-				hasGitCommands = true
-				break
+	return i >= len(query)
+}
+
+func (m *model) selectedEvent() *Event {
+	if len(m.visible) == 0 {
+		return nil
+	}
+	return m.allEvents[m.visible[m.cursor]]
+}
+
+func (m *model) syncDetail() {
+	e := m.selectedEvent()
+	var suggestions []dirsuggest.Suggestion
+	if e != nil {
+		suggestions = m.suggest.Suggest(e.Pwd, m.lastCmdDir[e.Pwd], 3)
+	}
+	m.detail.SetContent(renderDetail(e, suggestions))
+}
+
+func (m model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.searching {
+		switch msg.String() {
+		case "esc":
+			m.searching = false
+			m.searchInput.SetValue("")
+			m.searchInput.Blur()
+			m.applyFilter()
+			m.syncDetail()
+			return m, nil
+		case "enter":
+			m.searching = false
+			m.searchInput.Blur()
+			return m, nil
+		default:
+			var cmd tea.Cmd
+			m.searchInput, cmd = m.searchInput.Update(msg)
+			m.applyFilter()
+			m.syncDetail()
+			return m, cmd
+		}
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.client.Close()
+		return m, tea.Quit
+
+	case "/":
+		m.searching = true
+		m.searchInput.Focus()
+		return m, textinput.Blink
+
+	case "f":
+		m.failuresOnly = !m.failuresOnly
+		m.applyFilter()
+		m.syncDetail()
+
+	case "j", "down":
+		if m.cursor < len(m.visible)-1 {
+			m.cursor++
+			m.syncDetail()
+		}
+
+	case "k", "up":
+		if m.cursor > 0 {
+			m.cursor--
+			m.syncDetail()
+		}
+
+	case "g":
+		m.cursor = 0
+		m.syncDetail()
+
+	case "G":
+		m.cursor = len(m.visible) - 1
+		m.syncDetail()
+
+	case "enter":
+		if e := m.selectedEvent(); e != nil {
+			if err := clipboard.WriteAll(e.Command); err != nil {
+				m.status = fmt.Sprintf("copy failed: %v", err)
+			} else {
+				m.status = fmt.Sprintf("copied: %s", e.Command)
 			}
 		}
-		if hasGitCommands {
-			suggestions = append(suggestions, "git status", "git log --oneline -10")
+
+	default:
+		var cmd tea.Cmd
+		m.detail, cmd = m.detail.Update(msg)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+func (m model) View() string {
+	if m.width == 0 {
+		return "connecting...\n"
+	}
+
+	title := fmt.Sprintf("Total Recall - %d event(s)", len(m.allEvents))
+	if m.failuresOnly {
+		title += " [failures only]"
+	}
+
+	list := listStyle.Width(m.width - m.detail.Width - 6).Height(m.detail.Height).Render(m.renderList())
+	detail := detailStyle.Render(m.detail.View())
+	body := lipgloss.JoinHorizontal(lipgloss.Top, list, detail)
+
+	status := m.status
+	if m.searching {
+		status = m.searchInput.View()
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		title,
+		body,
+		statusStyle.Width(m.width).Render(status),
+	)
+}
+
+func (m model) renderList() string {
+	if len(m.visible) == 0 {
+		return dimStyle.Render("no matching commands yet...")
+	}
+
+	var b strings.Builder
+	for row, idx := range m.visible {
+		e := m.allEvents[idx]
+
+		icon := okStyle.Render("OK")
+		if e.ReturnCode != 0 {
+			icon = failStyle.Render("FAIL")
+		}
+
+		line := fmt.Sprintf("%-4s %s", icon, e.Command)
+		if row == m.cursor {
+			line = selectedRowStyle.Render(line)
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// renderDetail formats the full detail pane for the highlighted event: the
+// untruncated command, timing, exit code, location, any captured env, and
+// the top dirsuggest predictions for what runs next in that directory.
+func renderDetail(e *Event, suggestions []dirsuggest.Suggestion) string {
+	if e == nil {
+		return dimStyle.Render("no command selected")
+	}
+
+	duration := e.EndTimestamp.Sub(e.StartTimestamp)
+	status := okStyle.Render("exit 0")
+	if e.ReturnCode != 0 {
+		status = failStyle.Render(fmt.Sprintf("exit %d", e.ReturnCode))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "command:\n  %s\n\n", e.Command)
+	fmt.Fprintf(&b, "status:   %s\n", status)
+	fmt.Fprintf(&b, "duration: %.0fms\n", float64(duration.Nanoseconds())/1e6)
+	fmt.Fprintf(&b, "started:  %s\n", e.StartTimestamp.Format(time.RFC3339))
+	fmt.Fprintf(&b, "cwd:      %s\n", e.Pwd)
+	fmt.Fprintf(&b, "host:     %s\n", e.Hostname)
+	if e.IPAddress != "" {
+		fmt.Fprintf(&b, "ip:       %s\n", e.IPAddress)
+	}
+
+	if len(e.Env) > 0 {
+		b.WriteString("\nenv:\n")
+		for k, v := range e.Env {
+			fmt.Fprintf(&b, "  %s=%s\n", k, v)
 		}
 	}
-	
-	// Check for common development patterns
-	if strings.Contains(currentDir, "src") || strings.Contains(currentDir, "code") {
-		suggestions = append(suggestions, "ls -la", "find . -name '*.go' -o -name '*.py' -o -name '*.js'")
+
+	if len(suggestions) > 0 {
+		b.WriteString("\nsuggested next in this dir:\n")
+		for _, s := range suggestions {
+			fmt.Fprintf(&b, "  %.2f  %s\n", s.Score, s.Command)
+		}
 	}
-	
-	// Show suggestions
-	for i, suggestion := range suggestions {
-		if i >= 3 { // Limit to 3 suggestions
-			break
+
+	return b.String()
+}
+
+// runSubscriber drains events off client into the model's channel until
+// ReadEvent returns an error (the connection closing, ctx being cancelled,
+// or a line that doesn't parse as an event), so the bubbletea Update loop
+// never blocks on I/O.
+func runSubscriber(client *PubSubClient, events chan eventMsg) {
+	for {
+		event, err := client.ReadEvent()
+		events <- eventMsg{event: event, err: err}
+		if err != nil {
+			return
 		}
-		fmt.Printf("   %d. %s\n", i+1, suggestion)
 	}
 }
 
+// Start connects to the proxy and runs the TUI until ctx is cancelled or the
+// user quits, returning cleanly either way: the terminal is restored (via
+// bubbletea's own Quit handling) and the socket is closed with a QUIT
+// instead of the process being torn down from inside a signal goroutine.
+// This also makes the TUI embeddable as a library and exercisable from
+// integration tests driving ctx directly.
+func Start(ctx context.Context, socketPath string, maxEvents int) error {
+	client := NewPubSubClient(socketPath)
+	if err := client.Connect(ctx); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	lastEventID := readLastEventID()
+	// Subscribe to all events, resuming from the last event we saw before a
+	// crash or restart instead of only seeing events published from here on.
+	if err := client.Subscribe("reactive-tui", "", lastEventID); err != nil {
+		return err
+	}
+
+	suggestPath := dirsuggest.DefaultPath()
+	suggest, err := dirsuggest.Load(suggestPath)
+	if err != nil {
+		log.Printf("warning: failed to load dirsuggest model: %v", err)
+		suggest = dirsuggest.NewModel()
+	}
+
+	m := newModel(client, maxEvents, suggest)
+	go runSubscriber(client, m.events)
+
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	_, err = p.Run()
+
+	if saveErr := dirsuggest.Save(suggestPath, suggest); saveErr != nil {
+		log.Printf("warning: failed to save dirsuggest model: %v", saveErr)
+	}
+
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
 // Test client for sending events
 func testPublisher(socketPath string) error {
 	conn, err := net.Dial("unix", socketPath)
@@ -280,7 +627,7 @@ func testPublisher(socketPath string) error {
 		return err
 	}
 	defer conn.Close()
-	
+
 	// Send a test event
 	testEvent := Event{
 		Command:        "echo 'Hello from test publisher'",
@@ -290,32 +637,50 @@ func testPublisher(socketPath string) error {
 		Pwd:            "/tmp",
 		Hostname:       "test-host",
 	}
-	
+
 	data, _ := json.Marshal(testEvent)
 	_, err = conn.Write(append(data, '\n'))
-	
+
 	fmt.Println("Sent test event to proxy")
 	return err
 }
 
 func main() {
 	var (
-		socketPath = flag.String("socket", "/tmp/totalrecall-proxy.sock", "Unix domain socket path")
-		mode       = flag.String("mode", "tui", "Mode: 'tui' for reactive TUI, 'test' for test publisher")
-		maxEvents  = flag.Int("max-events", 20, "Maximum events to display in TUI")
-		debug      = flag.Bool("debug", false, "Enable debug logging")
+		socketPath  = flag.String("socket", "/tmp/totalrecall-proxy.sock", "Unix domain socket path")
+		mode        = flag.String("mode", "tui", "Mode: 'tui' for reactive TUI, 'test' for test publisher")
+		maxEvents   = flag.Int("max-events", 500, "Maximum events to keep in the in-memory history")
+		debug       = flag.Bool("debug", false, "Enable debug logging")
+		metricsAddr = flag.String("metrics-addr", "", "If set, serve Prometheus /metrics and /debug/pprof/* on this address")
 	)
 	flag.Parse()
-	
+
 	// Set up logging
 	if !*debug {
 		log.SetOutput(io.Discard) // Disable debug logs unless explicitly enabled
 	}
-	
+
 	switch *mode {
 	case "tui":
-		tui := NewReactiveTUI(*socketPath, *maxEvents)
-		if err := tui.Start(); err != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+		go func() {
+			<-sigChan
+			cancel()
+		}()
+
+		if *metricsAddr != "" {
+			go func() {
+				if err := metrics.Serve(ctx, *metricsAddr); err != nil {
+					log.Printf("metrics server on %s failed: %v", *metricsAddr, err)
+				}
+			}()
+		}
+
+		if err := Start(ctx, *socketPath, *maxEvents); err != nil && err != context.Canceled {
 			log.Fatalf("TUI failed: %v", err)
 		}
 	case "test":
@@ -5,31 +5,52 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/exec"
 	"sort"
 	"strings"
 	"time"
 
 	"totalrecall/pkg/estransport"
+	"totalrecall/pkg/ranker"
+	"totalrecall/pkg/suggestlog"
 )
 
 // EnhancedShelper provides intelligent command suggestions using the proxy
 type EnhancedShelper struct {
 	client     *estransport.ProxiedESClient
-	socketPath string
+	supervised *estransport.Supervised
+	weights    ranker.Weights
+	log        *suggestlog.Logger
 }
 
-func NewEnhancedShelper(socketPath string) (*EnhancedShelper, error) {
-	// Create ES client with fallback
-	directURLs := []string{"https://localhost:9243"} // HAProxy mTLS endpoint as fallback
-	client, err := estransport.NewESClientWithFallback(socketPath, directURLs, nil)
+func NewEnhancedShelper(endpoints []estransport.Endpoint) (*EnhancedShelper, error) {
+	return NewEnhancedShelperWithFactory(endpoints, estransport.DefaultESFactory)
+}
+
+// NewEnhancedShelperWithFactory is NewEnhancedShelper with an injectable
+// ESFactory so callers can substitute a fake ES client in tests. The
+// endpoints are handed to a Supervised circuit breaker rather than dialed
+// directly, so a proxy socket that just went down doesn't get retried on
+// every search this process makes.
+func NewEnhancedShelperWithFactory(endpoints []estransport.Endpoint, factory estransport.ESFactory) (*EnhancedShelper, error) {
+	supervised := &estransport.Supervised{Endpoints: endpoints, Factory: factory}
+	client, err := supervised.Client()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create ES client: %v", err)
 	}
 
+	weights, err := ranker.LoadWeights(ranker.DefaultPath())
+	if err != nil {
+		return nil, fmt.Errorf("loading ranker weights: %v", err)
+	}
+
 	return &EnhancedShelper{
 		client:     client,
-		socketPath: socketPath,
+		supervised: supervised,
+		weights:    weights,
+		log:        suggestlog.NewLogger(),
 	}, nil
 }
 
@@ -41,10 +62,13 @@ type CommandSuggestion struct {
 	LastUsed    time.Time
 	Directory   string
 	Context     string // Why this command is suggested
+	Features    ranker.Features
 }
 
-// GetRelevantCommands finds commands relevant to the current context
-func (s *EnhancedShelper) GetRelevantCommands(pwd string, envVars map[string]string, limit int) ([]CommandSuggestion, error) {
+// GetRelevantCommands finds commands relevant to the current context.
+// prefix is the in-progress command line, if any, feeding the
+// cmd_prefix_match ranking feature; pass "" when there isn't one.
+func (s *EnhancedShelper) GetRelevantCommands(pwd string, envVars map[string]string, limit int, prefix string) ([]CommandSuggestion, error) {
 	// Build enhanced query with environment context
 	query := s.buildContextualQuery(pwd, envVars, limit)
 
@@ -58,11 +82,38 @@ func (s *EnhancedShelper) GetRelevantCommands(pwd string, envVars map[string]str
 	}
 
 	// Process and rank results
-	suggestions := s.processSearchResults(result, pwd, envVars)
+	suggestions := s.processSearchResults(result, pwd, envVars, prefix)
+
+	if err := s.logSuggestions(pwd, suggestions); err != nil {
+		// The suggestion log only feeds offline training; never block a
+		// suggestion on it.
+		fmt.Printf("warning: failed to log suggestions: %v\n", err)
+	}
 
 	return suggestions, nil
 }
 
+// logSuggestions records what was shown for pwd's context, so
+// totalrecall-train can later pair it against whichever command the user
+// actually ran (tools/precmd-hook records that half).
+func (s *EnhancedShelper) logSuggestions(pwd string, suggestions []CommandSuggestion) error {
+	candidates := make([]suggestlog.Candidate, 0, len(suggestions))
+	for _, sug := range suggestions {
+		candidates = append(candidates, suggestlog.Candidate{
+			Command:  sug.Command,
+			Features: sug.Features,
+			Score:    sug.Score,
+		})
+	}
+
+	return s.log.Append(suggestlog.Record{
+		Kind:        "shown",
+		Timestamp:   time.Now(),
+		ContextHash: suggestlog.ContextHash(pwd),
+		Candidates:  candidates,
+	})
+}
+
 func (s *EnhancedShelper) buildContextualQuery(pwd string, envVars map[string]string, limit int) map[string]interface{} {
 	// Build should clauses for environment variables
 	shouldClauses := make([]map[string]interface{}, 0)
@@ -145,77 +196,110 @@ func (s *EnhancedShelper) getEnvVarBoost(key string) float64 {
 	return 1.5
 }
 
-func (s *EnhancedShelper) processSearchResults(result *estransport.SearchResponse, pwd string, envVars map[string]string) []CommandSuggestion {
+// processSearchResults ranks hits with the ranker model loaded at startup:
+// score = Σ wᵢ·featureᵢ over {es_score, log_freq, recency_days,
+// env_match_count, same_git_repo, cmd_prefix_match}. This replaces the old
+// hand-tuned "ES score + 0.1*frequency + bucketed recency" formula - the
+// weights now adapt as totalrecall-train fits them against which
+// suggestions users actually ran.
+func (s *EnhancedShelper) processSearchResults(result *estransport.SearchResponse, pwd string, envVars map[string]string, prefix string) []CommandSuggestion {
 	// Track command frequency and recency
 	commandStats := make(map[string]*CommandSuggestion)
-	
+	repoRoot := gitRepoRootCache()
+	currentRepo := repoRoot(pwd)
+
 	for _, hit := range result.Hits.Hits {
 		cmd := hit.Source.Command
-		
+
 		if existing, exists := commandStats[cmd]; exists {
 			existing.Frequency++
 			if hit.Source.StartTimestamp.After(existing.LastUsed) {
 				existing.LastUsed = hit.Source.StartTimestamp
-				existing.Score = hit.Score // Update with latest score
+				existing.Features.ESScore = hit.Score
 			}
 		} else {
-			context := s.explainRelevance(hit.Source, envVars)
-			
+			matches := envMatchCount(hit.Source, envVars)
+			sameRepo := 0.0
+			if currentRepo != "" && repoRoot(hit.Source.Pwd) == currentRepo {
+				sameRepo = 1.0
+			}
+
 			commandStats[cmd] = &CommandSuggestion{
 				Command:   cmd,
-				Score:     hit.Score,
 				Frequency: 1,
 				LastUsed:  hit.Source.StartTimestamp,
 				Directory: pwd,
-				Context:   context,
+				Context:   s.explainRelevance(hit.Source, envVars, matches),
+				Features: ranker.Features{
+					ESScore:        hit.Score,
+					EnvMatchCount:  float64(matches),
+					SameGitRepo:    sameRepo,
+					CmdPrefixMatch: cmdPrefixMatch(cmd, prefix),
+				},
 			}
 		}
 	}
-	
-	// Convert to slice and sort by combined relevance
+
+	// Fill in the features that depend on the final frequency/recency, score
+	// with the loaded weights, and sort by that score.
 	suggestions := make([]CommandSuggestion, 0, len(commandStats))
 	for _, suggestion := range commandStats {
-		// Calculate combined score (ES score + frequency + recency)
-		recencyScore := s.calculateRecencyScore(suggestion.LastUsed)
-		frequencyScore := float64(suggestion.Frequency) * 0.1
-		
-		suggestion.Score = suggestion.Score + frequencyScore + recencyScore
+		suggestion.Features.LogFreq = math.Log1p(float64(suggestion.Frequency))
+		suggestion.Features.RecencyDays = time.Since(suggestion.LastUsed).Hours() / 24
+		suggestion.Score = s.weights.Score(suggestion.Features)
 		suggestions = append(suggestions, *suggestion)
 	}
-	
-	// Sort by combined score
+
 	sort.Slice(suggestions, func(i, j int) bool {
 		return suggestions[i].Score > suggestions[j].Score
 	})
-	
+
 	return suggestions
 }
 
-func (s *EnhancedShelper) calculateRecencyScore(lastUsed time.Time) float64 {
-	daysSince := time.Since(lastUsed).Hours() / 24
-	
-	if daysSince < 1 {
-		return 2.0 // Used today
-	} else if daysSince < 7 {
-		return 1.0 // Used this week
-	} else if daysSince < 30 {
-		return 0.5 // Used this month
+// gitRepoRootCache memoizes `git rev-parse --show-toplevel` lookups for one
+// processSearchResults call, since every hit from the same directory would
+// otherwise re-exec git for an identical answer.
+func gitRepoRootCache() func(dir string) string {
+	cache := make(map[string]string)
+	return func(dir string) string {
+		if root, ok := cache[dir]; ok {
+			return root
+		}
+		out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+		root := ""
+		if err == nil {
+			root = strings.TrimSpace(string(out))
+		}
+		cache[dir] = root
+		return root
 	}
-	
-	return 0.0 // Older
 }
 
-func (s *EnhancedShelper) explainRelevance(cmd estransport.Command, currentEnv map[string]string) string {
-	reasons := []string{}
-	
-	// Check environment matches
+// cmdPrefixMatch is the cmd_prefix_match feature: 1 if cmd shares prefix
+// with the command the user is in the middle of typing, else 0.
+func cmdPrefixMatch(cmd, prefix string) float64 {
+	if prefix != "" && strings.HasPrefix(cmd, prefix) {
+		return 1
+	}
+	return 0
+}
+
+// envMatchCount is the env_match_count feature: how many of currentEnv's
+// variables match the value cmd was originally run with.
+func envMatchCount(cmd estransport.Command, currentEnv map[string]string) int {
 	matches := 0
 	for key, currentValue := range currentEnv {
 		if cmdValue, exists := cmd.Env[key]; exists && cmdValue == currentValue {
 			matches++
 		}
 	}
-	
+	return matches
+}
+
+func (s *EnhancedShelper) explainRelevance(cmd estransport.Command, currentEnv map[string]string, matches int) string {
+	reasons := []string{}
+
 	if matches > 0 {
 		reasons = append(reasons, fmt.Sprintf("%d env vars match", matches))
 	}
@@ -284,7 +368,7 @@ func (s *EnhancedShelper) GetCommandHistory(pwd string, hours int, limit int) ([
 }
 
 // Display functions
-func (s *EnhancedShelper) DisplaySuggestions(suggestions []CommandSuggestion, maxResults int) {
+func (s *EnhancedShelper) DisplaySuggestions(suggestions []CommandSuggestion, maxResults int, explain bool) {
 	if len(suggestions) == 0 {
 		fmt.Println("No relevant commands found for the current context.")
 		return
@@ -306,14 +390,21 @@ func (s *EnhancedShelper) DisplaySuggestions(suggestions []CommandSuggestion, ma
 
 		// Format frequency and recency
 		lastUsedStr := formatTimeAgo(suggestion.LastUsed)
-		
-		fmt.Printf("%2d. %-60s (score: %.1f, used %dx, %s)\n", 
+
+		fmt.Printf("%2d. %-60s (score: %.1f, used %dx, %s)\n",
 			count+1, displayCmd, suggestion.Score, suggestion.Frequency, lastUsedStr)
-		
+
 		if suggestion.Context != "" {
 			fmt.Printf("    💡 %s\n", suggestion.Context)
 		}
-		
+
+		if explain {
+			for _, c := range s.weights.Contributions(suggestion.Features) {
+				fmt.Printf("    %-16s value=%-8.3f weight=%-8.3f contribution=%.3f\n",
+					c.Name, c.Value, c.Weight, c.Contribution)
+			}
+		}
+
 		fmt.Println()
 		count++
 	}
@@ -351,16 +442,40 @@ func getCurrentEnv() map[string]string {
 	return env
 }
 
+// defaultESEndpoints is the fallback chain used when no -es flags are
+// given: the proxy socket, then the HAProxy mTLS endpoint directly.
+var defaultESEndpoints = []string{
+	"unix:///tmp/totalrecall-proxy.sock",
+	"https://localhost:9243",
+}
+
+// endpointListFlag collects repeated -es flag values in order, so users can
+// write "-es unix:///tmp/foo.sock -es https+insecure://localhost:9243" to
+// try the socket first and fall back to a direct connection.
+type endpointListFlag []string
+
+func (f *endpointListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *endpointListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
 // Main function
 func main() {
+	var esFlags endpointListFlag
+	flag.Var(&esFlags, "es", "ES endpoint to try, in order (unix:///path, host:port, http(s)://..., https+insecure://...). May be repeated; defaults to the proxy socket then the direct HAProxy endpoint.")
 	var (
-		socketPath   = flag.String("socket", "/tmp/totalrecall-proxy.sock", "Unix domain socket path")
 		numResults   = flag.Int("n", 10, "Number of results to return")
 		pwd          = flag.String("pwd", "", "Working directory (default: current directory)")
 		showHistory  = flag.Bool("history", false, "Show recent command history instead of suggestions")
 		historyHours = flag.Int("hours", 24, "Hours of history to show")
 		testConn     = flag.Bool("test", false, "Test connectivity to ES via proxy")
 		debug        = flag.Bool("debug", false, "Enable debug output")
+		prefix       = flag.String("prefix", "", "In-progress command line, if any, to match suggestions against (feeds cmd_prefix_match)")
+		explain      = flag.Bool("explain", false, "Print each suggestion's feature contributions to its final score")
 	)
 	flag.Parse()
 
@@ -368,6 +483,18 @@ func main() {
 		// Enable debug logging if needed
 	}
 
+	if len(esFlags) == 0 {
+		esFlags = defaultESEndpoints
+	}
+	endpoints := make([]estransport.Endpoint, 0, len(esFlags))
+	for _, raw := range esFlags {
+		ep, err := estransport.ParseEndpoint(raw)
+		if err != nil {
+			log.Fatalf("Error parsing -es endpoint: %v", err)
+		}
+		endpoints = append(endpoints, ep)
+	}
+
 	// Get current directory if not specified
 	if *pwd == "" {
 		var err error
@@ -378,18 +505,16 @@ func main() {
 	}
 
 	// Create enhanced shelper
-	shelper, err := NewEnhancedShelper(*socketPath)
+	shelper, err := NewEnhancedShelper(endpoints)
 	if err != nil {
 		log.Fatalf("Error creating shelper: %v", err)
 	}
 
 	fmt.Printf("🔍 Total Recall Enhanced Shelper\n")
-	fmt.Printf("Using: %s\n", shelper.socketPath)
 	fmt.Printf("Directory: %s\n\n", *pwd)
 
 	if *testConn {
-		directURLs := []string{"https://localhost:9243"}
-		estransport.TestConnectivity(*socketPath, directURLs)
+		estransport.TestConnectivity(endpoints)
 		return
 	}
 
@@ -423,11 +548,11 @@ func main() {
 	}
 
 	// Get command suggestions
-	suggestions, err := shelper.GetRelevantCommands(*pwd, currentEnv, *numResults)
+	suggestions, err := shelper.GetRelevantCommands(*pwd, currentEnv, *numResults, *prefix)
 	if err != nil {
 		log.Fatalf("Error getting suggestions: %v", err)
 	}
 
 	// Display results
-	shelper.DisplaySuggestions(suggestions, *numResults)
+	shelper.DisplaySuggestions(suggestions, *numResults, *explain)
 }
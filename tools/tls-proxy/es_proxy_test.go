@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"totalrecall/pkg/auth"
+)
+
+// newTestESProxy builds an EnhancedTLSProxy fronting esServer with no
+// query cache, for tests that only exercise the streaming reverse-proxy
+// path (handleESRequest/serveES) rather than caching.
+func newTestESProxy(t *testing.T, esServer *httptest.Server) *EnhancedTLSProxy {
+	t.Helper()
+
+	esAddr := strings.TrimPrefix(esServer.URL, "https://")
+	esTLS := &tls.Config{InsecureSkipVerify: true}
+
+	p, err := NewEnhancedTLSProxy(
+		filepath.Join(t.TempDir(), "proxy.sock"),
+		"127.0.0.1:0", esAddr,
+		nil, esTLS,
+		1,
+		filepath.Join(t.TempDir(), "events.log"), 100,
+		auth.NoneAuth{},
+		nil, nil,
+	)
+	if err != nil {
+		t.Fatalf("NewEnhancedTLSProxy: %v", err)
+	}
+	return p
+}
+
+// doESRequest drives reqBytes (a raw HTTP/1.1 request) through
+// handleESRequest over a real net.Pipe, sniffing the first line and
+// wrapping the remainder in a *bufio.Reader exactly as handleClient does,
+// then returns the parsed response. Routing the body through the live pipe
+// (rather than a canned in-memory reader) matters: handleESRequest's
+// http.Server background-reads the connection to detect an early client
+// disconnect, and a reader that returns EOF once its canned bytes are
+// exhausted would look exactly like that, canceling the in-flight request.
+func doESRequest(t *testing.T, p *EnhancedTLSProxy, reqBytes []byte) *http.Response {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+
+	go func() {
+		io.Copy(clientConn, bytes.NewReader(reqBytes))
+	}()
+
+	reader := bufio.NewReader(serverConn)
+	firstLine, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading request line: %v", err)
+	}
+	firstLine = strings.TrimRight(firstLine, "\r\n")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.handleESRequest(serverConn, reader, firstLine)
+	}()
+
+	resp, err := http.ReadResponse(bufio.NewReader(clientConn), nil)
+	if err != nil {
+		t.Fatalf("reading proxied response: %v", err)
+	}
+	t.Cleanup(func() {
+		clientConn.Close()
+		<-done
+	})
+	return resp
+}
+
+// TestHandleESRequestLargeBulkIndex covers a multi-megabyte _bulk request
+// body streaming through the proxy to Elasticsearch unchanged, rather than
+// being truncated or buffered into a small fixed-size window.
+func TestHandleESRequestLargeBulkIndex(t *testing.T) {
+	var gotBody []byte
+	esServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		gotBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ES backend reading body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer esServer.Close()
+
+	p := newTestESProxy(t, esServer)
+
+	// One 4KB-ish bulk action repeated enough times to push the body past
+	// a single TCP read/write buffer.
+	var body bytes.Buffer
+	action := `{"index":{"_index":"logs"}}` + "\n" + `{"msg":"` + strings.Repeat("x", 4096) + `"}` + "\n"
+	for i := 0; i < 600; i++ {
+		body.WriteString(action)
+	}
+	wantLen := body.Len()
+
+	req := "POST /_bulk HTTP/1.1\r\n" +
+		"Host: es\r\n" +
+		"Content-Length: " + strconv.Itoa(wantLen) + "\r\n" +
+		"Content-Type: application/x-ndjson\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" + body.String()
+
+	resp := doESRequest(t, p, []byte(req))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	if len(gotBody) != wantLen {
+		t.Fatalf("ES backend received %d bytes, want %d", len(gotBody), wantLen)
+	}
+	if !bytes.Equal(gotBody, body.Bytes()) {
+		t.Fatal("bulk body was altered in transit")
+	}
+}
+
+// TestHandleESRequestChunkedResponse covers an Elasticsearch response
+// streamed back chunked (no Content-Length) rather than buffered in full,
+// confirming the body survives the hop intact and the chunked
+// Transfer-Encoding - a hop-by-hop header - is stripped before reaching
+// the client.
+func TestHandleESRequestChunkedResponse(t *testing.T) {
+	const chunk = "chunk-of-hits "
+	wantBody := strings.Repeat(chunk, 500)
+
+	esServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("test ES backend's ResponseWriter doesn't support flushing")
+		}
+		for i := 0; i < 500; i++ {
+			io.WriteString(w, chunk)
+			flusher.Flush()
+		}
+	}))
+	defer esServer.Close()
+
+	p := newTestESProxy(t, esServer)
+
+	req := "GET /logs-2024.01.02/_search HTTP/1.1\r\n" +
+		"Host: es\r\n" +
+		"Connection: close\r\n" +
+		"\r\n"
+
+	resp := doESRequest(t, p, []byte(req))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	if te := resp.Header.Get("Transfer-Encoding"); te != "" {
+		t.Errorf("Transfer-Encoding = %q, want stripped as a hop-by-hop header", te)
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading chunked body: %v", err)
+	}
+	if string(got) != wantBody {
+		t.Fatalf("got %d bytes of chunked body, want %d (content mismatch)", len(got), len(wantBody))
+	}
+}
+
+// TestHandleESRequestScrollCursor covers a _search/scroll request - whose
+// JSON body carries an opaque scroll_id that must reach Elasticsearch
+// byte-for-byte, since a corrupted cursor would make the next page of
+// results unreadable - passing through the proxy unmodified.
+func TestHandleESRequestScrollCursor(t *testing.T) {
+	const scrollID = "FGluY2x1ZGVfY29udGV4dF91dWlkDXF1ZXJ5QW5kRmV0Y2gB_totally_opaque_cursor=="
+	wantReqBody := `{"scroll":"1m","scroll_id":"` + scrollID + `"}`
+
+	var gotReqBody []byte
+	esServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		gotReqBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("ES backend reading body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"_scroll_id":"`+scrollID+`","hits":{"hits":[]}}`)
+	}))
+	defer esServer.Close()
+
+	p := newTestESProxy(t, esServer)
+
+	req := "POST /_search/scroll HTTP/1.1\r\n" +
+		"Host: es\r\n" +
+		"Content-Length: " + strconv.Itoa(len(wantReqBody)) + "\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Connection: close\r\n" +
+		"\r\n" + wantReqBody
+
+	resp := doESRequest(t, p, []byte(req))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	if string(gotReqBody) != wantReqBody {
+		t.Fatalf("ES backend saw request body %q, want %q", gotReqBody, wantReqBody)
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading response body: %v", err)
+	}
+	if !strings.Contains(string(got), scrollID) {
+		t.Fatalf("response body %q lost the scroll_id %q", got, scrollID)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"totalrecall/pkg/faultinject"
+	"totalrecall/pkg/subfilter"
+)
+
+// selfSignedTLSListener starts a TLS listener on loopback backed by a
+// freshly generated self-signed cert, for tests that need a real
+// tls.DialWithDialer round trip rather than a fake net.Conn.
+func selfSignedTLSListener(t *testing.T) (net.Listener, *tls.Config) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Finish the handshake and then just block reading, so the
+			// client's TLS dial completes instead of racing an immediate
+			// close; the connection is reaped when ln closes at test end.
+			go func(c net.Conn) {
+				io.Copy(io.Discard, c)
+			}(conn)
+		}
+	}()
+
+	return ln, &tls.Config{InsecureSkipVerify: true}
+}
+
+// TestConnectionPoolBlackholeAndLatency covers the review's "inject
+// blackhole + latency and verify the pool re-establishes healthy
+// connections" requirement: a blackholed target must fail getConnection
+// without dialing, clearing it must let the pool reconnect, and latency
+// must delay BeforeDial by at least the configured minimum.
+func TestConnectionPoolBlackholeAndLatency(t *testing.T) {
+	ln, tlsConfig := selfSignedTLSListener(t)
+	defer ln.Close()
+	addr := ln.Addr().String()
+
+	tests := []struct {
+		name    string
+		setup   func(inj *faultinject.Injector)
+		wantErr bool
+		minWait time.Duration
+	}{
+		{
+			name:    "healthy dial succeeds",
+			setup:   func(inj *faultinject.Injector) {},
+			wantErr: false,
+		},
+		{
+			name: "blackholed target fails without dialing",
+			setup: func(inj *faultinject.Injector) {
+				inj.BlackholeUpstream(addr)
+			},
+			wantErr: true,
+		},
+		{
+			name: "clearing blackhole re-establishes a healthy connection",
+			setup: func(inj *faultinject.Injector) {
+				inj.BlackholeUpstream(addr)
+				inj.ClearBlackhole(addr)
+			},
+			wantErr: false,
+		},
+		{
+			name: "latency delays the dial by at least the configured minimum",
+			setup: func(inj *faultinject.Injector) {
+				inj.SetLatency(20*time.Millisecond, 25*time.Millisecond)
+			},
+			wantErr: false,
+			minWait: 20 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inj := faultinject.New()
+			tt.setup(inj)
+			pool := NewConnectionPool(addr, tlsConfig, 1, inj)
+
+			start := time.Now()
+			conn, err := pool.getConnection()
+			elapsed := time.Since(start)
+
+			if tt.wantErr {
+				if err == nil {
+					conn.Close()
+					t.Fatal("expected getConnection to fail, it succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getConnection failed: %v", err)
+			}
+			defer conn.Close()
+			if elapsed < tt.minWait {
+				t.Fatalf("getConnection returned after %v, want at least %v", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+// newTestHub builds a PubSubHub backed by a scratch event index under dir,
+// for tests that need real Publish/Subscribe fanout without the rest of
+// EnhancedTLSProxy.
+func newTestHub(t *testing.T, faults *faultinject.Injector) *PubSubHub {
+	t.Helper()
+	hub, err := NewPubSubHub(filepath.Join(t.TempDir(), "events.log"), 100, faults)
+	if err != nil {
+		t.Fatalf("NewPubSubHub: %v", err)
+	}
+	return hub
+}
+
+// TestPubSubHubDropsSlowSubscriber covers the review's "verify ... drops
+// dead subscribers correctly" requirement: a subscriber throttled by
+// SlowConsumer to far below the fanout rate must eventually trip its
+// write deadline and be evicted from the hub, while a normal subscriber
+// on the same hub keeps receiving events.
+func TestPubSubHubDropsSlowSubscriber(t *testing.T) {
+	matchAll := func(event map[string]interface{}) bool { return true }
+
+	inj := faultinject.New()
+	hub := newTestHub(t, inj)
+
+	slowServer, slowClient := net.Pipe()
+	defer slowClient.Close()
+	fastServer, fastClient := net.Pipe()
+	defer fastClient.Close()
+
+	// fast's client end is drained continuously so its writes never block;
+	// slow's client end never reads at all, simulating a dead consumer, so
+	// its first throttled write blocks until writeLineRated's 100ms write
+	// deadline trips.
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := fastClient.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	slowSub := hub.Subscribe("slow", slowServer, subfilter.Predicate(matchAll))
+	fastSub := hub.Subscribe("fast", fastServer, subfilter.Predicate(matchAll))
+	slowSub.startLiveTail()
+	fastSub.startLiveTail()
+
+	inj.SlowConsumer("slow", 1) // 1 byte/sec: any real payload blows the 100ms write deadline
+
+	event, err := json.Marshal(map[string]interface{}{"msg": "hello"})
+	if err != nil {
+		t.Fatalf("marshaling event: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		hub.Publish(event)
+
+		n, _, _ := hub.GetStats()
+		if n == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	n, _, _ := hub.GetStats()
+	if n != 1 {
+		t.Fatalf("expected exactly 1 subscriber left after eviction, got %d", n)
+	}
+
+	hub.subMutex.RLock()
+	_, slowStillThere := hub.subscribers["slow"]
+	_, fastStillThere := hub.subscribers["fast"]
+	hub.subMutex.RUnlock()
+
+	if slowStillThere {
+		t.Error("slow subscriber should have been evicted")
+	}
+	if !fastStillThere {
+		t.Error("fast subscriber should not have been evicted")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,12 +15,23 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"totalrecall/pkg/auth"
+	"totalrecall/pkg/eventindex"
+	"totalrecall/pkg/faultinject"
+	"totalrecall/pkg/metrics"
+	"totalrecall/pkg/querycache"
+	"totalrecall/pkg/subfilter"
 )
 
 var debugMode bool
@@ -30,11 +42,109 @@ func debugLog(format string, args ...interface{}) {
 	}
 }
 
+// subscriberQueueSize bounds each subscriber's outbound queue (see
+// Subscriber.outbox), the in-memory analogue of Kafka consumer lag: a
+// subscriber that can't keep up accumulates lag instead of stalling
+// Publish for every other subscriber.
+const subscriberQueueSize = 1000
+
+// maxSubscriberLag is how many consecutive events a subscriber may miss
+// to outbox backpressure before it's dropped outright, so a consumer that
+// never recovers doesn't camp on a full queue forever.
+const maxSubscriberLag = 10 * subscriberQueueSize
+
 type Subscriber struct {
 	id     string
 	conn   net.Conn
 	writer *bufio.Writer
-	filter map[string]string
+	filter subfilter.Predicate
+	mu     sync.Mutex // serializes writes against replayed history and live publishes
+
+	hub    *PubSubHub
+	outbox chan []byte // Publish enqueues here; pump drains it onto the wire
+	lag    int64       // atomic: events dropped since the last successful send
+}
+
+// pump drains sub.outbox onto the wire until it's closed (by Unsubscribe)
+// or a write fails, in which case pump unsubscribes itself - the same
+// dead-subscriber eviction a synchronous write failure used to trigger
+// directly from Publish.
+func (sub *Subscriber) pump() {
+	for data := range sub.outbox {
+		rate := sub.hub.faults.SlowConsumerRate(sub.id)
+		if err := sub.writeLineRated(data, rate); err != nil {
+			debugLog("Failed to send to subscriber %s: %v", sub.id, err)
+			metrics.EventsDroppedTotal.WithLabelValues("write_error").Inc()
+			sub.hub.Unsubscribe(sub.id)
+			return
+		}
+	}
+}
+
+// enqueue hands data to sub's outbox without blocking the publish loop. If
+// the queue is full, it records the miss as lag rather than stalling every
+// other subscriber behind a slow one, and either relays a "LAGGED <n>"
+// notice (best effort - if there's still no room, the next successful
+// send will reflect the growing count) or, once lag has grown past
+// maxSubscriberLag, disconnects the subscriber outright.
+func (sub *Subscriber) enqueue(data []byte) {
+	select {
+	case sub.outbox <- data:
+		return
+	default:
+	}
+
+	lag := atomic.AddInt64(&sub.lag, 1)
+	metrics.EventsDroppedTotal.WithLabelValues("queue_full").Inc()
+
+	if lag > maxSubscriberLag {
+		debugLog("Subscriber %s exceeded max lag (%d), disconnecting", sub.id, lag)
+		// Unsubscribe takes subMutex for writing; enqueue can be called from
+		// Publish, which holds subMutex for reading, so it must not call
+		// Unsubscribe inline here.
+		go sub.hub.Unsubscribe(sub.id)
+		return
+	}
+
+	select {
+	case sub.outbox <- []byte(fmt.Sprintf("LAGGED %d", lag)):
+	default:
+	}
+}
+
+// writeLine writes data to the subscriber as one newline-terminated
+// message, under mu so a historical replay and a concurrent live Publish
+// can't interleave their bytes on the wire.
+func (s *Subscriber) writeLine(data []byte) error {
+	return s.writeLineRated(data, 0)
+}
+
+// writeLineRated behaves like writeLine, but when bytesPerSec is positive
+// (SlowConsumer), paces the write directly against the connection instead
+// of through the buffered writer, so the pacing is actually observed on
+// the wire rather than absorbed by bufio's buffer. Combined with the
+// single absolute write deadline set below, a sufficiently slow pace
+// makes the deadline expire mid-write and trips the same dead-subscriber
+// eviction a genuinely slow client would hit.
+func (s *Subscriber) writeLineRated(data []byte, bytesPerSec int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	defer s.conn.SetWriteDeadline(time.Time{})
+
+	if bytesPerSec <= 0 {
+		if _, err := s.writer.Write(append(data, '\n')); err != nil {
+			return err
+		}
+		return s.writer.Flush()
+	}
+
+	if err := s.writer.Flush(); err != nil {
+		return err
+	}
+	_, err := faultinject.Throttle(s.conn, bytesPerSec).Write(append(data, '\n'))
+	return err
 }
 
 type PubSubHub struct {
@@ -42,20 +152,32 @@ type PubSubHub struct {
 	subMutex    sync.RWMutex
 	totalEvents int64
 	totalSubs   int64
+	index       *eventindex.Index
+	faults      *faultinject.Injector
 }
 
-func NewPubSubHub() *PubSubHub {
+// NewPubSubHub opens indexPath as the durable event index (see
+// pkg/eventindex) that backs SINCE= replay, capped at maxEvents.
+func NewPubSubHub(indexPath string, maxEvents int, faults *faultinject.Injector) (*PubSubHub, error) {
+	idx, err := eventindex.Open(indexPath, maxEvents)
+	if err != nil {
+		return nil, fmt.Errorf("opening event index: %v", err)
+	}
+
 	return &PubSubHub{
 		subscribers: make(map[string]*Subscriber),
-	}
+		index:       idx,
+		faults:      faults,
+	}, nil
 }
 
-func (hub *PubSubHub) Subscribe(id string, conn net.Conn, filter map[string]string) {
+func (hub *PubSubHub) Subscribe(id string, conn net.Conn, filter subfilter.Predicate) *Subscriber {
 	hub.subMutex.Lock()
 	defer hub.subMutex.Unlock()
 
 	if existing, exists := hub.subscribers[id]; exists {
 		existing.conn.Close()
+		close(existing.outbox)
 	}
 
 	subscriber := &Subscriber{
@@ -63,12 +185,117 @@ func (hub *PubSubHub) Subscribe(id string, conn net.Conn, filter map[string]stri
 		conn:   conn,
 		writer: bufio.NewWriter(conn),
 		filter: filter,
+		hub:    hub,
+		outbox: make(chan []byte, subscriberQueueSize),
 	}
 
 	hub.subscribers[id] = subscriber
 	hub.totalSubs++
 
 	debugLog("New subscriber: %s (total: %d)", id, len(hub.subscribers))
+	return subscriber
+}
+
+// startLiveTail begins draining sub's outbox onto the wire. It must be
+// called only after any historical replay has finished writing directly to
+// the connection, so replayed and live events can never interleave: Publish
+// starts enqueueing into outbox the moment Subscribe returns, so outbox
+// itself is the handover queue that accumulates live events published
+// during replay, then drains them in order once replay hands off.
+func (sub *Subscriber) startLiveTail() {
+	go sub.pump()
+}
+
+// sinceCursor is a parsed SINCE=<id|LAST|-N|timestamp> subscribe argument:
+// a last-seen event ID, a request for only the most recent N events, a
+// request to skip replay entirely (LAST), or an RFC3339 timestamp to
+// resume from - never more than one.
+type sinceCursor struct {
+	id        uint64
+	hasID     bool
+	timestamp time.Time
+	hasTime   bool
+	lastN     int
+	hasLastN  bool
+	tailOnly  bool // LAST: no replay, just switch straight to live tailing
+}
+
+// parseSinceCursor interprets a SINCE= value, trying in order: the literal
+// "LAST" (skip replay), "-N" (replay only the most recent N events), a
+// decimal event ID, and finally an RFC3339 timestamp (optionally prefixed
+// with "@" to disambiguate it from a numeric ID) - the forms the request
+// protocol accepts (`SINCE=42`, `SINCE=LAST`, `SINCE=-100`,
+// `SINCE=2024-01-01T00:00:00Z`).
+func parseSinceCursor(value string) *sinceCursor {
+	if value == "LAST" {
+		return &sinceCursor{tailOnly: true}
+	}
+	if strings.HasPrefix(value, "-") {
+		if n, err := strconv.Atoi(value[1:]); err == nil && n > 0 {
+			return &sinceCursor{lastN: n, hasLastN: true}
+		}
+	}
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return &sinceCursor{id: id, hasID: true}
+	}
+	if t, err := time.Parse(time.RFC3339, strings.TrimPrefix(value, "@")); err == nil {
+		return &sinceCursor{timestamp: t, hasTime: true}
+	}
+	debugLog("SINCE=%s is neither LAST, -N, a numeric event ID, nor an RFC3339 timestamp; ignoring", value)
+	return nil
+}
+
+// splitSince pulls a leading "SINCE=<id|timestamp>" clause off filterStr, if
+// present, returning the parsed cursor and the remaining subfilter
+// expression. SINCE is a replay directive, not part of the filter grammar
+// itself, so it's stripped before the rest is handed to subfilter.Compile.
+func splitSince(filterStr string) (*sinceCursor, string) {
+	filterStr = strings.TrimSpace(filterStr)
+	if !strings.HasPrefix(filterStr, "SINCE=") {
+		return nil, filterStr
+	}
+
+	rest := ""
+	value := filterStr[len("SINCE="):]
+	if idx := strings.IndexAny(value, " \t"); idx >= 0 {
+		rest = strings.TrimSpace(value[idx:])
+		value = value[:idx]
+	}
+
+	return parseSinceCursor(value), rest
+}
+
+// replayHistory dispatches every persisted event matching sub's filter and
+// since cursor, oldest first, before handleSubscriber switches it over to
+// live tailing.
+func (hub *PubSubHub) replayHistory(sub *Subscriber, since *sinceCursor) error {
+	var events []eventindex.Event
+	switch {
+	case since.tailOnly:
+		return nil
+	case since.hasLastN:
+		events = hub.index.Last(since.lastN)
+	case since.hasID:
+		events = hub.index.SinceID(since.id)
+	case since.hasTime:
+		events = hub.index.SinceTime(since.timestamp)
+	default:
+		return nil
+	}
+
+	for _, e := range events {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(e.Data, &parsed); err != nil {
+			continue
+		}
+		if !sub.filter(parsed) {
+			continue
+		}
+		if err := sub.writeLine(e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (hub *PubSubHub) Unsubscribe(id string) {
@@ -77,12 +304,20 @@ func (hub *PubSubHub) Unsubscribe(id string) {
 
 	if subscriber, exists := hub.subscribers[id]; exists {
 		subscriber.conn.Close()
+		close(subscriber.outbox)
 		delete(hub.subscribers, id)
 		debugLog("Subscriber disconnected: %s (remaining: %d)", id, len(hub.subscribers))
 	}
 }
 
 func (hub *PubSubHub) Publish(eventData []byte) {
+	stamped := eventData
+	if _, s, err := hub.index.Append(eventData, time.Now()); err != nil {
+		debugLog("Failed to persist event to index: %v", err)
+	} else {
+		stamped = s
+	}
+
 	hub.subMutex.RLock()
 	defer hub.subMutex.RUnlock()
 
@@ -91,62 +326,83 @@ func (hub *PubSubHub) Publish(eventData []byte) {
 		return
 	}
 
-	debugLog("Publishing to %d subscribers: %s", len(hub.subscribers), string(eventData))
+	debugLog("Publishing to %d subscribers: %s", len(hub.subscribers), string(stamped))
 
 	var event map[string]interface{}
-	json.Unmarshal(eventData, &event)
-
-	deadSubs := []string{}
+	if err := json.Unmarshal(stamped, &event); err != nil {
+		debugLog("Failed to parse stamped event for fanout: %v", err)
+		metrics.ParseErrorsTotal.Inc()
+		return
+	}
 
 	for id, subscriber := range hub.subscribers {
-		if !hub.matchesFilter(event, subscriber.filter) {
+		if !subscriber.filter(event) {
+			metrics.EventsDroppedTotal.WithLabelValues("filter_rejected").Inc()
 			continue
 		}
 
-		subscriber.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
-		
-		_, err := subscriber.writer.Write(append(eventData, '\n'))
-		if err == nil {
-			err = subscriber.writer.Flush()
-		}
-
-		subscriber.conn.SetWriteDeadline(time.Time{})
-
-		if err != nil {
-			debugLog("Failed to send to subscriber %s: %v", id, err)
-			deadSubs = append(deadSubs, id)
-		} else {
-			debugLog("Successfully sent to subscriber %s", id)
+		if hub.faults.ShouldDrop() {
+			debugLog("Fault injection: dropping event for subscriber %s", id)
+			metrics.EventsDroppedTotal.WithLabelValues("fault_injected").Inc()
+			continue
 		}
-	}
 
-	for _, id := range deadSubs {
-		hub.Unsubscribe(id)
+		payload := hub.faults.MaybeCorrupt(stamped)
+		subscriber.enqueue(payload)
 	}
 
 	hub.totalEvents++
 }
 
-func (hub *PubSubHub) matchesFilter(event map[string]interface{}, filter map[string]string) bool {
-	if len(filter) == 0 {
-		return true
-	}
-
-	for key, expectedValue := range filter {
-		if actualValue, exists := event[key]; !exists {
-			return false
-		} else if actualValueStr := fmt.Sprintf("%v", actualValue); actualValueStr != expectedValue {
-			return false
-		}
-	}
+func (hub *PubSubHub) GetStats() (int, int64, int64) {
+	hub.subMutex.RLock()
+	defer hub.subMutex.RUnlock()
+	return len(hub.subscribers), hub.totalEvents, hub.totalSubs
+}
 
-	return true
+// SubscriberLag is one subscriber's outbox occupancy and accumulated lag,
+// for reporting alongside the hub-wide stats in printStats.
+type SubscriberLag struct {
+	ID       string
+	QueueLen int
+	QueueCap int
+	Lag      int64
 }
 
-func (hub *PubSubHub) GetStats() (int, int64, int64) {
+// LagStats returns every subscriber's current queue occupancy and lag.
+func (hub *PubSubHub) LagStats() []SubscriberLag {
 	hub.subMutex.RLock()
 	defer hub.subMutex.RUnlock()
-	return len(hub.subscribers), hub.totalEvents, hub.totalSubs
+
+	stats := make([]SubscriberLag, 0, len(hub.subscribers))
+	for id, sub := range hub.subscribers {
+		stats = append(stats, SubscriberLag{
+			ID:       id,
+			QueueLen: len(sub.outbox),
+			QueueCap: cap(sub.outbox),
+			Lag:      atomic.LoadInt64(&sub.lag),
+		})
+	}
+	return stats
+}
+
+// summarizeLag reduces per-subscriber lag stats to the hub-wide peak queue
+// occupancy, peak lag, and count of subscribers currently lagging at all,
+// the aggregate a periodic stats line can show without a row per
+// subscriber.
+func summarizeLag(stats []SubscriberLag) (maxQueueLen int, maxLag int64, laggingSubs int) {
+	for _, s := range stats {
+		if s.QueueLen > maxQueueLen {
+			maxQueueLen = s.QueueLen
+		}
+		if s.Lag > maxLag {
+			maxLag = s.Lag
+		}
+		if s.Lag > 0 {
+			laggingSubs++
+		}
+	}
+	return maxQueueLen, maxLag, laggingSubs
 }
 
 type ConnectionPool struct {
@@ -158,14 +414,16 @@ type ConnectionPool struct {
 	totalSent   int64
 	totalErrors int64
 	mutex       sync.RWMutex
+	faults      *faultinject.Injector
 }
 
-func NewConnectionPool(targetAddr string, tlsConfig *tls.Config, poolSize int) *ConnectionPool {
+func NewConnectionPool(targetAddr string, tlsConfig *tls.Config, poolSize int, faults *faultinject.Injector) *ConnectionPool {
 	return &ConnectionPool{
 		connections: make(chan *tls.Conn, poolSize),
 		targetAddr:  targetAddr,
 		tlsConfig:   tlsConfig,
 		poolSize:    poolSize,
+		faults:      faults,
 	}
 }
 
@@ -175,7 +433,7 @@ func (pool *ConnectionPool) getConnection() (*tls.Conn, error) {
 		conn.SetDeadline(time.Now().Add(100 * time.Millisecond))
 		_, err := conn.Write([]byte{})
 		conn.SetDeadline(time.Time{})
-		
+
 		if err != nil {
 			conn.Close()
 			pool.mutex.Lock()
@@ -187,6 +445,13 @@ func (pool *ConnectionPool) getConnection() (*tls.Conn, error) {
 	default:
 	}
 
+	if err := pool.faults.BeforeDial(pool.targetAddr); err != nil {
+		pool.mutex.Lock()
+		pool.totalErrors++
+		pool.mutex.Unlock()
+		return nil, err
+	}
+
 	dialer := &net.Dialer{Timeout: 3 * time.Second}
 	conn, err := tls.DialWithDialer(dialer, "tcp", pool.targetAddr, pool.tlsConfig)
 	if err != nil {
@@ -224,33 +489,53 @@ func (pool *ConnectionPool) GetStats() (int, int, int64, int64) {
 }
 
 type EnhancedTLSProxy struct {
-	socketPath     string
-	fluentbitPool  *ConnectionPool
-	esHTTPClient   *http.Client
-	esBaseURL      string
-	pubsub         *PubSubHub
-	listener       net.Listener
+	socketPath    string
+	fluentbitPool *ConnectionPool
+	esProxy       *httputil.ReverseProxy
+	esAddr        string
+	pubsub        *PubSubHub
+	listener      net.Listener
+	auth          auth.Auth
+	faults        *faultinject.Injector
+	cache         *querycache.Cache
+	cacheAllow    []string
 }
 
-func NewEnhancedTLSProxy(socketPath string, 
+func NewEnhancedTLSProxy(socketPath string,
 	fluentbitAddr, esAddr string,
 	fluentbitTLS, esTLS *tls.Config,
-	poolSize int) *EnhancedTLSProxy {
-	
-	esHTTPClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: esTLS,
-		},
-		Timeout: 30 * time.Second,
+	poolSize int,
+	eventIndexPath string, eventIndexMaxEvents int,
+	authenticator auth.Auth,
+	cache *querycache.Cache, cacheAllow []string) (*EnhancedTLSProxy, error) {
+
+	esProxy := newESReverseProxy(esAddr, esTLS)
+
+	faults := faultinject.New()
+	faults.OnEvent = func(e faultinject.Event) {
+		debugLog("Fault injected: %s target=%q", e.Kind, e.Target)
 	}
-	
+
+	pubsub, err := NewPubSubHub(eventIndexPath, eventIndexMaxEvents, faults)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubsub hub: %v", err)
+	}
+
+	if authenticator == nil {
+		authenticator = auth.NoneAuth{}
+	}
+
 	return &EnhancedTLSProxy{
 		socketPath:    socketPath,
-		fluentbitPool: NewConnectionPool(fluentbitAddr, fluentbitTLS, poolSize),
-		esHTTPClient:  esHTTPClient,
-		esBaseURL:     fmt.Sprintf("https://%s", esAddr),
-		pubsub:        NewPubSubHub(),
-	}
+		fluentbitPool: NewConnectionPool(fluentbitAddr, fluentbitTLS, poolSize, faults),
+		esProxy:       esProxy,
+		esAddr:        esAddr,
+		pubsub:        pubsub,
+		auth:          authenticator,
+		faults:        faults,
+		cache:         cache,
+		cacheAllow:    cacheAllow,
+	}, nil
 }
 
 func (p *EnhancedTLSProxy) handleClient(clientConn net.Conn) {
@@ -267,39 +552,115 @@ func (p *EnhancedTLSProxy) handleClient(clientConn net.Conn) {
 	firstLine = strings.TrimSpace(firstLine)
 	debugLog("Received first line: %s", firstLine)
 
-	switch {
-	case isHTTPRequest(firstLine):
+	if isHTTPRequest(firstLine) {
 		debugLog("Handling as HTTP request for Elasticsearch")
 		p.handleESRequest(clientConn, reader, firstLine)
-		
+		return
+	}
+
+	// The SUBSCRIBE and fluent-bit-ingest protocols are both line-based, so
+	// either may be preceded by an "AUTH <user> <pass>" line; a connection
+	// that skips it is authenticated with empty credentials plus the
+	// connection itself, which NoneAuth, cert:// (by the peer's uid) and a
+	// misconfigured basicfile/static table accept.
+	principal, authErr := p.auth.Authenticate(auth.Credentials{Conn: clientConn})
+	if strings.HasPrefix(firstLine, "AUTH ") {
+		parts := strings.Fields(firstLine)
+		if len(parts) != 3 {
+			clientConn.Write([]byte("ERROR malformed AUTH, expected: AUTH <user> <pass>\n"))
+			return
+		}
+
+		principal, authErr = p.auth.Authenticate(auth.Credentials{User: parts[1], Pass: parts[2], Conn: clientConn})
+		if authErr != nil {
+			debugLog("Auth failed for %s: %v", parts[1], authErr)
+			clientConn.Write([]byte(fmt.Sprintf("ERROR auth failed: %v\n", authErr)))
+			return
+		}
+
+		firstLine, err = reader.ReadString('\n')
+		if err != nil {
+			debugLog("Failed to read line after AUTH: %v", err)
+			return
+		}
+		firstLine = strings.TrimSpace(firstLine)
+	} else if authErr != nil {
+		clientConn.Write([]byte(fmt.Sprintf("ERROR authentication required, send AUTH <user> <pass>: %v\n", authErr)))
+		return
+	}
+
+	switch {
 	case strings.HasPrefix(firstLine, "SUBSCRIBE"):
 		debugLog("Handling as pub/sub subscription")
 		parts := strings.Fields(firstLine)
 		subscriberID := "anonymous"
 		filterStr := ""
-		
+
 		if len(parts) >= 2 {
 			subscriberID = parts[1]
 		}
 		if len(parts) >= 3 {
 			filterStr = strings.Join(parts[2:], " ")
 		}
-		
+
+		if !principal.Can(auth.CapSubscribe) {
+			clientConn.Write([]byte("ERROR not authorized to subscribe\n"))
+			return
+		}
+		if principal.FilterPrefix != "" && !strings.HasPrefix(filterStr, principal.FilterPrefix) {
+			clientConn.Write([]byte(fmt.Sprintf("ERROR filter must start with %q\n", principal.FilterPrefix)))
+			return
+		}
+
 		p.handleSubscriber(clientConn, subscriberID, filterStr)
-		
+
+	case strings.HasPrefix(firstLine, "FAULT"):
+		debugLog("Handling as FAULT admin command")
+
+		if !principal.Can(auth.CapAdmin) {
+			clientConn.Write([]byte("ERROR not authorized for FAULT\n"))
+			return
+		}
+
+		reply, err := faultinject.ApplyCommand(p.faults, strings.Fields(firstLine)[1:])
+		if err != nil {
+			clientConn.Write([]byte(fmt.Sprintf("ERROR %v\n", err)))
+			return
+		}
+		clientConn.Write([]byte(reply + "\n"))
+
+	case strings.HasPrefix(firstLine, "PURGE"):
+		debugLog("Handling as PURGE admin command")
+
+		if !principal.Can(auth.CapAdmin) {
+			clientConn.Write([]byte("ERROR not authorized for PURGE\n"))
+			return
+		}
+
+		if p.cache != nil {
+			p.cache.Purge()
+		}
+		clientConn.Write([]byte("PURGE ok\n"))
+
 	default:
 		debugLog("Handling as fluent-bit JSON event")
+
+		if !principal.Can(auth.CapPublish) {
+			clientConn.Write([]byte("ERROR not authorized to publish\n"))
+			return
+		}
+
 		if err := p.processFluentbitEvent([]byte(firstLine)); err != nil {
 			debugLog("Failed to process fluent-bit event: %v", err)
 		}
-		
+
 		scanner := bufio.NewScanner(reader)
 		for scanner.Scan() {
 			line := scanner.Bytes()
 			if len(line) == 0 {
 				continue
 			}
-			
+
 			if err := p.processFluentbitEvent(line); err != nil {
 				debugLog("Failed to process fluent-bit event: %v", err)
 			}
@@ -317,122 +678,284 @@ func isHTTPRequest(line string) bool {
 	return false
 }
 
+// hopByHopHeaders are stripped in both directions per RFC 7230 §6.1: they
+// describe one hop of the connection (this client-to-proxy or
+// proxy-to-Elasticsearch leg) and must never be forwarded to the other.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// stripHopHeaders removes hopByHopHeaders from h, plus anything h's own
+// Connection header names (RFC 7230 §6.1 also lets a message nominate
+// additional per-hop headers that way).
+func stripHopHeaders(h http.Header) {
+	for _, token := range strings.Split(h.Get("Connection"), ",") {
+		if token = strings.TrimSpace(token); token != "" {
+			h.Del(token)
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+}
+
+// newESReverseProxy builds the httputil.ReverseProxy that fronts
+// Elasticsearch: an mTLS, HTTP/2-attempting Transport so upstream
+// connections are pooled and kept alive instead of dialed fresh per
+// request, and a Director that strips hop-by-hop headers, adds
+// X-Forwarded-For/Forwarded, and leaves the client-supplied Host header
+// and request body untouched so chunked bodies, bulk-index payloads, and
+// scroll cursors stream straight through rather than being buffered.
+func newESReverseProxy(esAddr string, esTLS *tls.Config) *httputil.ReverseProxy {
+	target := &url.URL{Scheme: "https", Host: esAddr}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	proxy.Transport = &http.Transport{
+		TLSClientConfig:   esTLS,
+		ForceAttemptHTTP2: true,
+	}
+
+	baseDirector := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		baseDirector(req)
+		req.Header.Set("X-Forwarded-For", forwardedFor(req))
+		req.Header.Add("Forwarded", fmt.Sprintf("for=%q;proto=https", forwardedFor(req)))
+		stripHopHeaders(req.Header)
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		stripHopHeaders(resp.Header)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		debugLog("ES reverse proxy error for %s %s: %v", r.Method, r.URL.Path, err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return proxy
+}
+
+// forwardedFor reports the client address to record in X-Forwarded-For and
+// Forwarded, falling back to "unix-socket" since connections arriving over
+// the control-plane unix socket have no meaningful remote IP.
+func forwardedFor(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil && host != "" {
+		return host
+	}
+	return "unix-socket"
+}
+
+// singleConnListener is a net.Listener that hands out exactly one
+// already-accepted net.Conn, then blocks until connState reports it
+// closed, at which point it fails with io.EOF. It's what lets
+// handleESRequest hand a single unix-socket connection to http.Server and
+// have Serve return synchronously once (and only once) that connection is
+// done, instead of http.Server's usual listen-forever loop.
+type singleConnListener struct {
+	conn      net.Conn
+	accepted  bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: conn, closed: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	if !l.accepted {
+		l.accepted = true
+		return l.conn, nil
+	}
+	<-l.closed
+	return nil, io.EOF
+}
+
+func (l *singleConnListener) connState(_ net.Conn, state http.ConnState) {
+	if state == http.StateClosed || state == http.StateHijacked {
+		l.Close()
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr { return l.conn.LocalAddr() }
+
+// prefixConn is a net.Conn whose first reads are served from prefix before
+// falling through to the wrapped connection, so the request line
+// handleClient already consumed while sniffing the protocol can be
+// replayed to http.Server as if it had never been read.
+type prefixConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *prefixConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// handleESRequest hands clientConn to an http.Server running p.esProxy,
+// reconstructing the request line and any bytes already buffered in reader
+// so http.ReadRequest sees the whole message. Serve blocks until the
+// connection is done (see singleConnListener), matching the synchronous,
+// one-goroutine-per-connection style the rest of handleClient's callees
+// use.
 func (p *EnhancedTLSProxy) handleESRequest(clientConn net.Conn, reader *bufio.Reader, firstLine string) {
 	debugLog("Handling HTTP request: %s", firstLine)
-	
-	httpReq, err := p.parseHTTPRequest(firstLine, reader)
-	if err != nil {
-		debugLog("Failed to parse HTTP request: %v", err)
-		p.writeHTTPError(clientConn, 400, fmt.Sprintf("Bad request: %v", err))
-		return
+
+	conn := &prefixConn{
+		Conn: clientConn,
+		r:    io.MultiReader(strings.NewReader(firstLine+"\r\n"), reader),
 	}
-	
-	debugLog("Parsed HTTP request: %s %s", httpReq.Method, httpReq.URL.Path)
-	
-	targetURL := p.esBaseURL + httpReq.URL.Path
-	if httpReq.URL.RawQuery != "" {
-		targetURL += "?" + httpReq.URL.RawQuery
+
+	listener := newSingleConnListener(conn)
+	server := &http.Server{
+		Handler:   http.HandlerFunc(p.serveES),
+		ConnState: listener.connState,
+		// Stash the raw client connection (not the prefixConn wrapper
+		// Accept() sees) in the request context so authenticateHTTP can hand
+		// it to cert://'s peerCredUID check, the same way handleClient's
+		// other protocols pass Conn straight into auth.Credentials.
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, clientConnContextKey, clientConn)
+		},
 	}
-	
-	debugLog("Making HTTPS request to HAProxy: %s %s", httpReq.Method, targetURL)
-	
-	proxyReq, err := http.NewRequest(httpReq.Method, targetURL, httpReq.Body)
+
+	if err := server.Serve(listener); err != nil && err != io.EOF {
+		debugLog("ES reverse proxy connection ended: %v", err)
+	}
+}
+
+// serveES authenticates an ES request via its Proxy-Authorization header,
+// then serves it from p.cache when possible, falling back to p.esProxy.
+func (p *EnhancedTLSProxy) serveES(w http.ResponseWriter, r *http.Request) {
+	principal, err := p.authenticateHTTP(r)
 	if err != nil {
-		debugLog("Failed to create proxy request: %v", err)
-		p.writeHTTPError(clientConn, 500, "Failed to create request")
+		debugLog("Rejecting ES request: %v", err)
+		w.Header().Set("Proxy-Authenticate", `Basic realm="totalrecall"`)
+		http.Error(w, fmt.Sprintf("Proxy authentication required: %v", err), http.StatusProxyAuthRequired)
 		return
 	}
-	
-	for name, values := range httpReq.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(name, value)
-		}
+	if !principal.Can(auth.CapQuery) {
+		http.Error(w, "not authorized to query elasticsearch", http.StatusForbidden)
+		return
 	}
-	
-	proxyReq.Host = "elasticsearch"
-	
-	debugLog("Sending mTLS request to HAProxy...")
-	
-	resp, err := p.esHTTPClient.Do(proxyReq)
-	if err != nil {
-		debugLog("Failed to make mTLS request to HAProxy: %v", err)
-		p.writeHTTPError(clientConn, 502, fmt.Sprintf("ES request failed: %v", err))
+	r.Header.Del("Proxy-Authorization")
+
+	if p.cache == nil || !querycache.Cacheable(r.Method, r.URL.Path, p.cacheAllow) {
+		p.esProxy.ServeHTTP(w, r)
 		return
 	}
-	defer resp.Body.Close()
-	
-	debugLog("Received response from HAProxy: %s", resp.Status)
-	
-	err = p.writeHTTPResponse(clientConn, resp)
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		debugLog("Failed to write response to client: %v", err)
+		http.Error(w, fmt.Sprintf("reading request body: %v", err), http.StatusBadRequest)
 		return
 	}
-	
-	debugLog("HTTP request completed successfully")
-}
+	r.Body.Close()
 
-func (p *EnhancedTLSProxy) parseHTTPRequest(firstLine string, reader *bufio.Reader) (*http.Request, error) {
-	var requestData bytes.Buffer
-	requestData.WriteString(firstLine + "\r\n")
-	
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			return nil, fmt.Errorf("failed to read request: %v", err)
-		}
-		
-		requestData.WriteString(line)
-		
-		if line == "\r\n" || line == "\n" {
-			break
-		}
+	key := querycache.Key(r.Method, r.URL.Path, r.URL.Query(), body)
+
+	if status, header, cached, ok := p.cache.Get(key); ok {
+		debugLog("Query cache hit for %s %s", r.Method, r.URL.Path)
+		copyHeader(w.Header(), header)
+		w.WriteHeader(status)
+		w.Write(cached)
+		return
 	}
-	
-	req, err := http.ReadRequest(bufio.NewReader(&requestData))
+
+	result, err := p.cache.Do(key, func() (querycache.FetchResult, error) {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		rec := newResponseRecorder()
+		p.esProxy.ServeHTTP(rec, r)
+		return querycache.FetchResult{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTTP request: %v", err)
+		http.Error(w, fmt.Sprintf("ES request failed: %v", err), http.StatusBadGateway)
+		return
 	}
-	
-	if req.ContentLength > 0 {
-		body := make([]byte, req.ContentLength)
-		_, err := io.ReadFull(reader, body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read request body: %v", err)
-		}
-		req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if ttl := p.cache.TTL(r.URL.Path, result.Header); ttl > 0 {
+		p.cache.Put(key, result.Status, result.Header, result.Body, ttl)
 	}
-	
-	return req, nil
+
+	copyHeader(w.Header(), result.Header)
+	w.WriteHeader(result.Status)
+	w.Write(result.Body)
 }
 
-func (p *EnhancedTLSProxy) writeHTTPResponse(clientConn net.Conn, resp *http.Response) error {
-	statusLine := fmt.Sprintf("HTTP/1.1 %s\r\n", resp.Status)
-	if _, err := clientConn.Write([]byte(statusLine)); err != nil {
-		return err
-	}
-	
-	for name, values := range resp.Header {
-		for _, value := range values {
-			headerLine := fmt.Sprintf("%s: %s\r\n", name, value)
-			if _, err := clientConn.Write([]byte(headerLine)); err != nil {
-				return err
-			}
+// copyHeader copies every header value from src to dst.
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		for _, v := range values {
+			dst.Add(name, v)
 		}
 	}
-	
-	if _, err := clientConn.Write([]byte("\r\n")); err != nil {
-		return err
+}
+
+// responseRecorder captures a ReverseProxy response in memory instead of
+// streaming it to a client, so serveES can cache it (and still forward it)
+// on a query-cache miss - httputil.ReverseProxy only knows how to write to
+// an http.ResponseWriter, not return a value.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) { r.status = status }
+
+func (r *responseRecorder) Write(b []byte) (int, error) { return r.body.Write(b) }
+
+// clientConnContextKey looks up the client net.Conn handleESRequest stashes
+// in each request's context via http.Server.ConnContext.
+type clientConnContextKeyType struct{}
+
+var clientConnContextKey = clientConnContextKeyType{}
+
+// authenticateHTTP extracts a "Proxy-Authorization: Basic ..." header and
+// authenticates it, falling back to empty credentials (as accepted by
+// NoneAuth, and by cert:// via the underlying connection) when the header
+// is absent.
+func (p *EnhancedTLSProxy) authenticateHTTP(req *http.Request) (*auth.Principal, error) {
+	conn, _ := req.Context().Value(clientConnContextKey).(net.Conn)
+
+	user, pass, ok := parseProxyAuthorization(req.Header.Get("Proxy-Authorization"))
+	if !ok {
+		return p.auth.Authenticate(auth.Credentials{Conn: conn})
 	}
-	
-	_, err := io.Copy(clientConn, resp.Body)
-	return err
+	return p.auth.Authenticate(auth.Credentials{User: user, Pass: pass, Conn: conn})
 }
 
-func (p *EnhancedTLSProxy) writeHTTPError(conn net.Conn, code int, message string) {
-	response := fmt.Sprintf("HTTP/1.1 %d %s\r\nContent-Type: text/plain\r\nContent-Length: %d\r\n\r\n%s",
-		code, http.StatusText(code), len(message), message)
-	conn.Write([]byte(response))
+// parseProxyAuthorization decodes a "Basic base64(user:pass)"
+// Proxy-Authorization header value, the scheme HTTP clients (and curl's
+// --proxy-user) already speak for proxy auth.
+func parseProxyAuthorization(header string) (user, pass string, ok bool) {
+	const prefix = "Basic "
+	if !strings.HasPrefix(header, prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return "", "", false
+	}
+
+	user, pass, ok = strings.Cut(string(decoded), ":")
+	return user, pass, ok
 }
 
 func (p *EnhancedTLSProxy) processFluentbitEvent(data []byte) error {
@@ -443,7 +966,13 @@ func (p *EnhancedTLSProxy) processFluentbitEvent(data []byte) error {
 	}
 	
 	debugLog("Processing fluent-bit event: %s", string(data))
-	
+
+	if p.faults.ShouldDrop() {
+		debugLog("Fault injection: dropping fluent-bit event")
+		metrics.EventsDroppedTotal.WithLabelValues("fault_injected").Inc()
+		return nil
+	}
+
 	conn, err := p.fluentbitPool.getConnection()
 	if err != nil {
 		p.fluentbitPool.mutex.Lock()
@@ -490,21 +1019,28 @@ func (p *EnhancedTLSProxy) processFluentbitEvent(data []byte) error {
 func (p *EnhancedTLSProxy) handleSubscriber(clientConn net.Conn, subscriberID string, filterStr string) {
 	defer clientConn.Close()
 
-	filter := make(map[string]string)
-	if filterStr != "" {
-		pairs := strings.Split(filterStr, ",")
-		for _, pair := range pairs {
-			if kv := strings.SplitN(pair, "=", 2); len(kv) == 2 {
-				filter[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
-			}
-		}
+	since, exprStr := splitSince(filterStr)
+
+	filter, err := subfilter.Compile(exprStr)
+	if err != nil {
+		debugLog("Rejecting subscriber %s: bad filter %q: %v", subscriberID, exprStr, err)
+		clientConn.Write([]byte(fmt.Sprintf("ERROR invalid filter: %v\n", err)))
+		return
 	}
 
-	p.pubsub.Subscribe(subscriberID, clientConn, filter)
+	subscriber := p.pubsub.Subscribe(subscriberID, clientConn, filter)
 	defer p.pubsub.Unsubscribe(subscriberID)
 
 	clientConn.Write([]byte(fmt.Sprintf("SUBSCRIBED %s\n", subscriberID)))
 
+	if since != nil {
+		if err := p.pubsub.replayHistory(subscriber, since); err != nil {
+			debugLog("Failed to replay history to %s: %v", subscriberID, err)
+		}
+		clientConn.Write([]byte("HISTORY_DONE\n"))
+	}
+	subscriber.startLiveTail()
+
 	scanner := bufio.NewScanner(clientConn)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -534,7 +1070,7 @@ func (p *EnhancedTLSProxy) Start(ctx context.Context) error {
 
 	log.Printf("Enhanced TLS proxy listening on %s", p.socketPath)
 	log.Printf("Fluent-bit target: %s", p.fluentbitPool.targetAddr)
-	log.Printf("Elasticsearch target: %s (mTLS)", p.esBaseURL)
+	log.Printf("Elasticsearch target: %s (mTLS)", p.esAddr)
 	if debugMode {
 		log.Printf("Debug mode enabled")
 	}
@@ -564,6 +1100,12 @@ func (p *EnhancedTLSProxy) Start(ctx context.Context) error {
 			}
 		}
 
+		if !p.faults.Accepting() {
+			debugLog("Fault injection: rejecting connection, accept paused")
+			conn.Close()
+			continue
+		}
+
 		go p.handleClient(conn)
 	}
 }
@@ -579,10 +1121,18 @@ func (p *EnhancedTLSProxy) printStats(ctx context.Context) {
 		case <-ticker.C:
 			fbActive, fbPooled, fbSent, fbErrors := p.fluentbitPool.GetStats()
 			subscribers, totalEvents, totalSubs := p.pubsub.GetStats()
+			maxQueueLen, maxLag, laggingSubs := summarizeLag(p.pubsub.LagStats())
+
+			var cacheHits, cacheMisses, cacheEvictions uint64
+			var cacheBytes int64
+			if p.cache != nil {
+				cacheHits, cacheMisses, cacheEvictions, cacheBytes = p.cache.Stats()
+			}
 
-			log.Printf("Stats: FB(conns=%d,pooled=%d,sent=%d,err=%d) ES(https_client) PubSub(subs=%d,events=%d,total_subs=%d)",
+			log.Printf("Stats: FB(conns=%d,pooled=%d,sent=%d,err=%d) ES(https_client) PubSub(subs=%d,events=%d,total_subs=%d,max_queue_len=%d,max_lag=%d,lagging_subs=%d) QueryCache(hits=%d,misses=%d,evictions=%d,bytes=%d)",
 				fbActive, fbPooled, fbSent, fbErrors,
-				subscribers, totalEvents, totalSubs)
+				subscribers, totalEvents, totalSubs, maxQueueLen, maxLag, laggingSubs,
+				cacheHits, cacheMisses, cacheEvictions, cacheBytes)
 		}
 	}
 }
@@ -602,7 +1152,12 @@ func (p *EnhancedTLSProxy) Close() {
 	debugLog("Enhanced TLS proxy closed")
 }
 
-func loadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+// loadTLSConfig builds a tls.Config from a CA/cert/key triple, then layers
+// profile's version/cipher/curve/ALPN settings and serverName on top -
+// serverName replaces the old hardcoded "haproxy" so -fluent-server-name
+// and -es-server-name can diverge when HAProxy fronts each target under a
+// different SNI.
+func loadTLSConfig(caFile, certFile, keyFile, serverName string, profile *tlsProfile) (*tls.Config, error) {
 	caCert, err := ioutil.ReadFile(caFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load CA certificate: %v", err)
@@ -618,15 +1173,30 @@ func loadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
 		return nil, fmt.Errorf("failed to load client certificate: %v", err)
 	}
 
-	return &tls.Config{
+	return profile.configWith(&tls.Config{
 		RootCAs:      caCertPool,
 		Certificates: []tls.Certificate{cert},
-		ServerName:   "haproxy",
-		MinVersion:   tls.VersionTLS12,
-	}, nil
+	}, serverName), nil
+}
+
+// cacheRuleListFlag collects repeated -cache-rule flag values in order, so
+// operators can write "-cache-rule logs-*=30s -cache-rule metrics-*=5s" to
+// give different index patterns different TTLs.
+type cacheRuleListFlag []string
+
+func (f *cacheRuleListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *cacheRuleListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
 }
 
 func main() {
+	var cacheRuleFlags cacheRuleListFlag
+	flag.Var(&cacheRuleFlags, "cache-rule", "Query cache TTL for an index pattern, as <pattern>=<duration> (e.g. logs-*=30s). May be repeated.")
+
 	var (
 		socketPath = flag.String("socket", "/tmp/totalrecall-proxy.sock", "Unix domain socket path")
 		
@@ -645,13 +1215,42 @@ func main() {
 		esCaFile   = flag.String("es-ca-file", "", "ES CA certificate file (defaults to ca-file)")
 		esCertFile = flag.String("es-cert-file", "", "ES client certificate file (defaults to cert-file)")
 		esKeyFile  = flag.String("es-key-file", "", "ES client key file (defaults to key-file)")
-		
+
+		tlsMinVersion    = flag.String("tls-min-version", "1.2", "Minimum TLS version to negotiate (1.0, 1.1, 1.2, 1.3)")
+		tlsMaxVersion    = flag.String("tls-max-version", "1.3", "Maximum TLS version to negotiate (1.0, 1.1, 1.2, 1.3)")
+		tlsCiphers       = flag.String("tls-ciphers", "", "Comma-separated cipher suite names to allow (default: Go's built-in secure set; see -list-ciphers)")
+		tlsCurvesFlag    = flag.String("tls-curves", "", "Comma-separated elliptic curves to prefer (X25519, P256, P384, P521)")
+		tlsALPN          = flag.String("tls-alpn", "", "Comma-separated ALPN protocols to advertise (e.g. h2,http/1.1)")
+		fluentServerName = flag.String("fluent-server-name", "haproxy", "TLS ServerName (SNI) to present when dialing fluent-bit's HAProxy")
+		esServerName     = flag.String("es-server-name", "haproxy", "TLS ServerName (SNI) to present when dialing Elasticsearch's HAProxy")
+		listCiphersFlag  = flag.Bool("list-ciphers", false, "Print every supported cipher suite with its TLS versions and security posture, then exit")
+
+		eventIndexPath = flag.String("event-index", eventindex.DefaultPath(), "Path to the durable event index backing SUBSCRIBE ... SINCE= replay")
+		eventIndexMax  = flag.Int("event-index-max", eventindex.DefaultMaxEvents, "Maximum events retained in the index before the oldest are evicted")
+
+		cacheMaxBytes   = flag.Int64("cache-max-bytes", 64<<20, "Byte budget for the Elasticsearch query cache before LRU eviction kicks in (0 disables the byte cap, not the cache)")
+		cacheDefaultTTL = flag.Duration("cache-default-ttl", 0, "TTL applied to a cacheable query matching no -cache-rule and carrying no Cache-Control header (0 disables caching for it)")
+
 		debug = flag.Bool("debug", false, "Enable debug logging")
+
+		metricsAddr = flag.String("metrics-addr", "", "If set, serve Prometheus /metrics and /debug/pprof/* on this address")
+
+		authSpec = flag.String("auth", "none://", "Auth scheme for the control plane: none://, static://?users=..., basicfile:///path, cert://?uids=...")
 	)
 	flag.Parse()
 
+	if *listCiphersFlag {
+		listCiphers()
+		return
+	}
+
 	debugMode = *debug
 
+	authenticator, err := auth.NewAuth(*authSpec)
+	if err != nil {
+		log.Fatalf("Failed to configure -auth: %v", err)
+	}
+
 	if *esCaFile == "" {
 		*esCaFile = *caFile
 	}
@@ -662,20 +1261,38 @@ func main() {
 		*esKeyFile = *keyFile
 	}
 
-	fluentbitTLS, err := loadTLSConfig(*caFile, *certFile, *keyFile)
+	tlsProf, err := newTLSProfile(*tlsMinVersion, *tlsMaxVersion, *tlsCiphers, *tlsCurvesFlag, *tlsALPN)
+	if err != nil {
+		log.Fatalf("Invalid TLS profile: %v", err)
+	}
+
+	fluentbitTLS, err := loadTLSConfig(*caFile, *certFile, *keyFile, *fluentServerName, tlsProf)
 	if err != nil {
 		log.Fatalf("Failed to load fluent-bit TLS config: %v", err)
 	}
 
-	esTLS, err := loadTLSConfig(*esCaFile, *esCertFile, *esKeyFile)
+	esTLS, err := loadTLSConfig(*esCaFile, *esCertFile, *esKeyFile, *esServerName, tlsProf)
 	if err != nil {
 		log.Fatalf("Failed to load elasticsearch TLS config: %v", err)
 	}
 
+	var cacheRules []querycache.Rule
+	for _, spec := range cacheRuleFlags {
+		rule, err := querycache.ParseRule(spec)
+		if err != nil {
+			log.Fatalf("Invalid -cache-rule: %v", err)
+		}
+		cacheRules = append(cacheRules, rule)
+	}
+	cache := querycache.New(*cacheMaxBytes, *cacheDefaultTTL, cacheRules)
+
 	fluentbitAddr := fmt.Sprintf("%s:%s", *fluentbitHost, *fluentbitPort)
 	esAddr := fmt.Sprintf("%s:%s", *esHost, *esPort)
-	
-	proxy := NewEnhancedTLSProxy(*socketPath, fluentbitAddr, esAddr, fluentbitTLS, esTLS, *poolSize)
+
+	proxy, err := NewEnhancedTLSProxy(*socketPath, fluentbitAddr, esAddr, fluentbitTLS, esTLS, *poolSize, *eventIndexPath, *eventIndexMax, authenticator, cache, nil)
+	if err != nil {
+		log.Fatalf("Failed to create proxy: %v", err)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -688,6 +1305,14 @@ func main() {
 		cancel()
 	}()
 
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, *metricsAddr); err != nil {
+				log.Printf("metrics server on %s failed: %v", *metricsAddr, err)
+			}
+		}()
+	}
+
 	err = proxy.Start(ctx)
 	if err != nil && err != context.Canceled {
 		log.Printf("Proxy error: %v", err)
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tlsProfile is the operator-configurable shape of every tls.Config this
+// proxy builds: the mTLS leg to fluent-bit and the mTLS leg (via
+// httputil.ReverseProxy's Transport) to Elasticsearch. Centralizing it here
+// means -tls-min-version, -tls-ciphers, etc. apply identically to both
+// legs instead of each caller re-deriving a tls.Config by hand.
+type tlsProfile struct {
+	minVersion   uint16
+	maxVersion   uint16
+	cipherSuites []uint16 // nil means "use Go's default suite"
+	curves       []tls.CurveID
+	alpn         []string
+}
+
+// tlsVersions maps the names accepted by -tls-min-version/-tls-max-version
+// to their tls.VersionTLS* constants.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion resolves a -tls-min-version/-tls-max-version value
+// ("1.0".."1.3") to its tls.VersionTLS* constant.
+func parseTLSVersion(s string) (uint16, error) {
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (want one of 1.0, 1.1, 1.2, 1.3)", s)
+	}
+	return v, nil
+}
+
+// allCipherSuites returns every cipher suite Go knows about, secure and
+// insecure alike, so -tls-ciphers and -list-ciphers share one source of
+// truth.
+func allCipherSuites() []*tls.CipherSuite {
+	suites := append([]*tls.CipherSuite{}, tls.CipherSuites()...)
+	return append(suites, tls.InsecureCipherSuites()...)
+}
+
+// parseCipherSuites resolves a comma-separated list of IANA cipher suite
+// names (as tls.CipherSuites()/InsecureCipherSuites() name them, e.g.
+// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256") to their IDs.
+func parseCipherSuites(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	byName := make(map[string]*tls.CipherSuite)
+	for _, suite := range allCipherSuites() {
+		byName[suite.Name] = suite
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		suite, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q (see -list-ciphers)", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// tlsCurves maps the names accepted by -tls-curves to their tls.CurveID
+// constants.
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// parseCurves resolves a comma-separated list of curve names to their
+// tls.CurveID constants.
+func parseCurves(s string) ([]tls.CurveID, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var curves []tls.CurveID
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q (want one of X25519, P256, P384, P521)", name)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// parseALPN splits a comma-separated -tls-alpn value (e.g. "h2,http/1.1")
+// into the protocol list tls.Config.NextProtos expects.
+func parseALPN(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var protos []string
+	for _, proto := range strings.Split(s, ",") {
+		if proto = strings.TrimSpace(proto); proto != "" {
+			protos = append(protos, proto)
+		}
+	}
+	return protos
+}
+
+// newTLSProfile validates and assembles the flag-parsed pieces of a TLS
+// profile, rejecting combinations that can never negotiate: a max below
+// min, or a chosen cipher suite that isn't offered by any protocol version
+// in [min, max] (Go's tls.CipherSuites() reports each suite's
+// SupportedVersions, e.g. TLS 1.3's suites are fixed and unaffected by
+// CipherSuites, so a 1.3-only min/max paired with an explicit non-1.3
+// cipher list is almost certainly a mistake rather than a real
+// restriction).
+func newTLSProfile(minVersionName, maxVersionName, ciphersSpec, curvesSpec, alpnSpec string) (*tlsProfile, error) {
+	minVersion, err := parseTLSVersion(minVersionName)
+	if err != nil {
+		return nil, fmt.Errorf("-tls-min-version: %v", err)
+	}
+	maxVersion, err := parseTLSVersion(maxVersionName)
+	if err != nil {
+		return nil, fmt.Errorf("-tls-max-version: %v", err)
+	}
+	if maxVersion < minVersion {
+		return nil, fmt.Errorf("-tls-max-version %s is below -tls-min-version %s", maxVersionName, minVersionName)
+	}
+
+	ciphers, err := parseCipherSuites(ciphersSpec)
+	if err != nil {
+		return nil, fmt.Errorf("-tls-ciphers: %v", err)
+	}
+	if err := validateCiphersForVersions(ciphers, minVersion, maxVersion); err != nil {
+		return nil, fmt.Errorf("-tls-ciphers: %v", err)
+	}
+
+	curves, err := parseCurves(curvesSpec)
+	if err != nil {
+		return nil, fmt.Errorf("-tls-curves: %v", err)
+	}
+
+	return &tlsProfile{
+		minVersion:   minVersion,
+		maxVersion:   maxVersion,
+		cipherSuites: ciphers,
+		curves:       curves,
+		alpn:         parseALPN(alpnSpec),
+	}, nil
+}
+
+// validateCiphersForVersions fails fast if any requested cipher suite
+// isn't valid for at least one TLS version in [minVersion, maxVersion],
+// rather than letting the handshake fail opaquely at connection time.
+func validateCiphersForVersions(ciphers []uint16, minVersion, maxVersion uint16) error {
+	if len(ciphers) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint16]*tls.CipherSuite)
+	for _, suite := range allCipherSuites() {
+		byID[suite.ID] = suite
+	}
+
+	for _, id := range ciphers {
+		suite := byID[id]
+		var supported bool
+		for _, v := range suite.SupportedVersions {
+			if v >= minVersion && v <= maxVersion {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("cipher suite %s isn't valid for any TLS version in [%s, %s]",
+				suite.Name, tlsVersionName(minVersion), tlsVersionName(maxVersion))
+		}
+	}
+	return nil
+}
+
+// tlsVersionName is the inverse of parseTLSVersion, used for error
+// messages and -list-ciphers output.
+func tlsVersionName(v uint16) string {
+	for name, id := range tlsVersions {
+		if id == v {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// configWith returns a *tls.Config seeded with base's certificates and CA
+// pool, with this profile's version/cipher/curve/ALPN settings and
+// serverName layered on top. base is mutated in place and returned, the
+// same "decorate the struct you already built" pattern loadTLSConfig's
+// callers already expect.
+func (p *tlsProfile) configWith(base *tls.Config, serverName string) *tls.Config {
+	base.ServerName = serverName
+	base.MinVersion = p.minVersion
+	base.MaxVersion = p.maxVersion
+	base.CipherSuites = p.cipherSuites
+	base.CurvePreferences = p.curves
+	base.NextProtos = p.alpn
+	return base
+}
+
+// listCiphers prints every cipher suite Go's crypto/tls knows about, with
+// its IANA name, the TLS versions it's valid for, and a security posture
+// (secure/insecure, plus a dhe/ecdhe key-exchange note), so an operator
+// can choose a -tls-ciphers set without reading Go's source.
+func listCiphers() {
+	suites := allCipherSuites()
+	sort.Slice(suites, func(i, j int) bool { return suites[i].Name < suites[j].Name })
+
+	fmt.Printf("%-50s %-14s %s\n", "NAME", "VERSIONS", "POSTURE")
+	for _, suite := range suites {
+		var versions []string
+		for _, v := range suite.SupportedVersions {
+			versions = append(versions, tlsVersionName(v))
+		}
+
+		posture := "secure"
+		if suite.Insecure {
+			posture = "insecure"
+		}
+		switch {
+		case strings.Contains(suite.Name, "_ECDHE_"):
+			posture += ", ecdhe"
+		case strings.Contains(suite.Name, "_DHE_"):
+			posture += ", dhe"
+		}
+
+		fmt.Printf("%-50s %-14s %s\n", suite.Name, strings.Join(versions, ","), posture)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"totalrecall/pkg/ranker"
+	"totalrecall/pkg/suggestlog"
+)
+
+// runTrain is the `totalrecall train` subcommand. It reads the suggestlog
+// shelper and preexec-hook have been appending to, pairs each "shown"
+// context against whichever command the following "accepted" record for the
+// same context hash says actually ran, and fits pkg/ranker's weights on
+// those pairs via pairwise SGD - entirely offline and local, since the log
+// never leaves the machine it was written on.
+func runTrain(args []string) {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	logPathPtr := fs.String("log", suggestlog.DefaultPath(), "Suggestion log to train from.")
+	outPathPtr := fs.String("out", ranker.DefaultPath(), "Where to write the learned weights.")
+	learningRatePtr := fs.Float64("lr", ranker.DefaultTrainConfig().LearningRate, "SGD learning rate.")
+	epochsPtr := fs.Int("epochs", ranker.DefaultTrainConfig().Epochs, "Passes over the training pairs.")
+	l2Ptr := fs.Float64("l2", ranker.DefaultTrainConfig().L2, "L2 regularization strength.")
+	fs.Parse(args)
+
+	records, err := suggestlog.ReadAll(*logPathPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	pairs := trainingPairs(records)
+	if len(pairs) == 0 {
+		fmt.Println("no (chosen, not-chosen) pairs found; leaving weights unchanged")
+		return
+	}
+
+	initial, err := ranker.LoadWeights(*outPathPtr)
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	cfg := ranker.TrainConfig{LearningRate: *learningRatePtr, Epochs: *epochsPtr, L2: *l2Ptr}
+	weights := ranker.TrainPairwiseSGD(pairs, initial, cfg)
+
+	if err := ranker.SaveWeights(*outPathPtr, weights); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("trained on %d pairs from %d records, wrote weights to %s\n", len(pairs), len(records), *outPathPtr)
+}
+
+// trainingPairs pairs each "shown" record with the "accepted" record that
+// follows it for the same context hash: the accepted command is Chosen, and
+// every other candidate shelper showed for that context is NotChosen. A
+// "shown" record with no later "accepted" record for its context (the user
+// ran nothing shelper suggested, or nothing at all) contributes no pairs.
+func trainingPairs(records []suggestlog.Record) []ranker.Pair {
+	var pairs []ranker.Pair
+	for i, r := range records {
+		if r.Kind != "shown" {
+			continue
+		}
+		var accepted []string
+		for _, next := range records[i+1:] {
+			if next.Kind == "accepted" && next.ContextHash == r.ContextHash {
+				accepted = []string{next.Command}
+				break
+			}
+		}
+		for _, command := range accepted {
+			var chosen *suggestlog.Candidate
+			for i := range r.Candidates {
+				if r.Candidates[i].Command == command {
+					chosen = &r.Candidates[i]
+					break
+				}
+			}
+			if chosen == nil {
+				continue // the accepted command wasn't one shelper suggested
+			}
+
+			for _, c := range r.Candidates {
+				if c.Command == chosen.Command {
+					continue
+				}
+				pairs = append(pairs, ranker.Pair{Chosen: chosen.Features, NotChosen: c.Features})
+			}
+		}
+	}
+	return pairs
+}